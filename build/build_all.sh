@@ -5,6 +5,7 @@ docker build . -f ./build/service/Dockerfile --build-arg "SERVICE=gateway" -t ga
 docker build . -f ./build/service/Dockerfile --build-arg "SERVICE=auth" -t auth_service:latest 
 docker build . -f ./build/service/Dockerfile --build-arg "SERVICE=mail" -t mailer:latest 
 docker build . -f ./build/service/Dockerfile --build-arg "SERVICE=migrator" -t migrator:latest 
+docker build . -f ./build/service/Dockerfile --build-arg "SERVICE=provision" -t provision:latest 
 
 docker build . -f ./build/database/Dockerfile -t database:latest
 docker build . -f ./build/cache/Dockerfile -t cache:latest
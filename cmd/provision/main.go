@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jhamill34/notion-provisioner/internal/app/provision"
+)
+
+func main() {
+	prune := flag.Bool("prune", false, "delete organizations, apps, members and policies missing from the spec")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: provision [-prune] <plan|apply> <spec.yaml>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 || (flag.Arg(0) != "plan" && flag.Arg(0) != "apply") {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := provision.Configure().Run(
+		context.Background(),
+		os.Stdout,
+		flag.Arg(1),
+		flag.Arg(0) == "apply",
+		*prune,
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -14,6 +14,7 @@ echo $DEFAULT_OAUTH_CLIENT_SECRET | docker secret create oauth_client_secret -
 echo $AUTH_TOKEN_SECRET | docker secret create auth_token_secret -
 echo $AUTH_SESSION_SECRET | docker secret create auth_session_secret -
 echo $APP_SESSION_SECRET | docker secret create app_session_secret -
+echo $BLOG_PREVIEW_SECRET | docker secret create blog_preview_secret -
 echo $EMAIL_CREDENTIALS | docker secret create email_credentials - 
 
 set +o allexport 
@@ -2,15 +2,23 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/jhamill34/notion-provisioner/internal/config"
 	"github.com/jhamill34/notion-provisioner/internal/database"
 	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/services/blob"
+	"github.com/jhamill34/notion-provisioner/internal/services/client_credentials"
+	"github.com/jhamill34/notion-provisioner/internal/services/email"
 	"github.com/jhamill34/notion-provisioner/internal/services/rbac"
 	"github.com/jhamill34/notion-provisioner/internal/services/rca_signer"
 	"github.com/jhamill34/notion-provisioner/internal/services/repositories"
+	"github.com/jhamill34/notion-provisioner/internal/services/scim"
 	"github.com/jhamill34/notion-provisioner/internal/transport"
 	"github.com/jhamill34/notion-provisioner/internal/transport/routes"
 )
@@ -36,32 +44,117 @@ func Configure() *App {
 
 	kv := database.NewRedisProvider("APP:", cfg.Cache.Addr.String(), cfg.Cache.Password.String())
 
+	// Policy versions are shared by every service so they live next to pub/sub
+	policyVersions := database.NewRedisProvider(
+		"POLICY:",
+		cfg.PubSub.Addr.String(),
+		cfg.PubSub.Password.String(),
+	)
+
 	permissionModel := config.LoadRbacModel(os.Getenv("RBAC_MODEL_FILE"))
 	accessControlService := rbac.NewCasbinAccessControl(
 		permissionModel,
 		kv,
+		policyVersions,
 		nil,
 		rbac.NewRemotePolicyProvider(
 			cfg.AuthServer.BaseUrl.String()+cfg.AuthServer.PolicyPath,
 			http.DefaultClient,
+			client_credentials.NewTokenSource(
+				http.DefaultClient,
+				cfg.AuthServer.BaseUrl.String()+cfg.AuthServer.TokenPath,
+				cfg.AuthServer.ClientId.String(),
+				cfg.AuthServer.ClientSecret.String(),
+				"policy:read",
+			),
 		),
 	)
 
 	postDao := dao.NewPostDao(db)
-	postService := repositories.NewPostRepository(postDao, accessControlService)
+
+	// Looking up users is kept to its own token so the app server still gets
+	// policies when its client hasn't been granted user:read
+	userDirectory := scim.NewRemoteUserDirectory(
+		cfg.AuthServer.BaseUrl.String()+cfg.AuthServer.UserPath,
+		http.DefaultClient,
+		client_credentials.NewTokenSource(
+			http.DefaultClient,
+			cfg.AuthServer.BaseUrl.String()+cfg.AuthServer.TokenPath,
+			cfg.AuthServer.ClientId.String(),
+			cfg.AuthServer.ClientSecret.String(),
+			"user:read",
+		),
+	)
+
+	postService := repositories.NewPostRepository(
+		postDao,
+		dao.NewMySQLPostSearchDao(db),
+		dao.NewTagDao(db),
+		accessControlService,
+		repositories.NewWebhookEmitter(dao.NewWebhookDao(db)),
+		userDirectory,
+		cfg.Blog.PreviewKey.String(),
+		cfg.Blog.PreviewTTL,
+	)
+
+	templateRepository := repositories.
+		NewTemplateRepository(cfg.Template.Common...).
+		AddTemplates(cfg.Template.Paths...)
+
+	var emailService services.EmailSender
+	if cfg.Email.SmtpDomain != "" {
+		smtpAddr := fmt.Sprintf("%s:%d", cfg.Email.SmtpDomain, cfg.Email.SmtpPort)
+
+		smtpCredentials := strings.Split(cfg.Email.SmtpCredentials.String(), ":")
+		if len(smtpCredentials) != 2 {
+			panic("Invalid email credentials in configuration")
+		}
+
+		emailService = email.NewSmtpSender(
+			smtpAddr,
+			smtpCredentials[0],
+			smtpCredentials[1],
+			cfg.Email.User.String(),
+			cfg.Email.Domain.String(),
+			&tls.Config{
+				ServerName:         cfg.Email.SmtpDomain.String(),
+				InsecureSkipVerify: true,
+			},
+		)
+	}
+
+	commentService := repositories.NewCommentRepository(
+		cfg.Blog.BaseUrl.String(),
+		postDao,
+		dao.NewCommentDao(db),
+		accessControlService,
+		templateRepository,
+		emailService,
+		userDirectory,
+	)
+
+	mediaService := repositories.NewMediaRepository(
+		postDao,
+		dao.NewMediaDao(db),
+		accessControlService,
+		blob.NewFileStore(cfg.Media.Path),
+	)
 
 	subscriber := database.NewRedisSubscriberProvider(
 		cfg.PubSub.Addr.String(),
 		cfg.PubSub.Password.String(),
 	)
 
-	go listenForPolicyInvalidation(context.Background(), subscriber, kv)
+	go accessControlService.ListenForInvalidation(context.Background(), subscriber)
+	go mediaService.ImportPostImages(context.Background())
 
 	return &App{
 		server: transport.NewServer(
 			cfg.Server,
 			routes.NewBlogRoutes(
 				postService,
+				commentService,
+				mediaService,
 				signer,
 			),
 		),
@@ -78,19 +171,3 @@ func (a *App) Start(ctx context.Context) {
 
 	a.server.Start(ctx)
 }
-
-func listenForPolicyInvalidation(
-	ctx context.Context,
-	subscriber database.SubscriberProvider,
-	policyStore database.KeyValueStoreProvider,
-) {
-	channel, err := subscriber.Get().Subscribe(ctx, "policy_invalidate")
-	if err != nil {
-		panic(err)
-	}
-
-	for {
-		msg := <-channel
-		policyStore.Get().Del(ctx, msg)
-	}
-}
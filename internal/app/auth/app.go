@@ -20,6 +20,7 @@ import (
 	"github.com/jhamill34/notion-provisioner/internal/services/rca_signer"
 	"github.com/jhamill34/notion-provisioner/internal/services/repositories"
 	"github.com/jhamill34/notion-provisioner/internal/services/session"
+	"github.com/jhamill34/notion-provisioner/internal/services/webhook"
 	"github.com/jhamill34/notion-provisioner/internal/transport"
 	"github.com/jhamill34/notion-provisioner/internal/transport/routes"
 )
@@ -103,6 +104,37 @@ func Configure() *Auth {
 	)
 
 	userDao := dao.NewUserDao(db)
+	appDao := dao.NewApplicationDao(db)
+	orgDao := dao.NewOrganizationDao(db)
+	policySetDao := dao.NewPolicySetDao(db)
+
+	publisher := database.NewRedisPublisherProvider(
+		cfg.PubSub.Addr.String(),
+		cfg.PubSub.Password.String(),
+	)
+	// Policy versions are shared by every service so they live next to pub/sub
+	policyVersions := database.NewRedisProvider(
+		"POLICY:",
+		cfg.PubSub.Addr.String(),
+		cfg.PubSub.Password.String(),
+	)
+
+	permissionModel := config.LoadRbacModel(os.Getenv("RBAC_MODEL_FILE"))
+	policyProvider := rbac.NewDatabasePolicyProvider(userDao, orgDao, policySetDao)
+	accessControlService := rbac.NewCasbinAccessControl(
+		permissionModel,
+		kv,
+		policyVersions,
+		publisher,
+		policyProvider,
+	)
+
+	auditRepo := repositories.NewAuditRepository(dao.NewAuditLogDao(db), accessControlService)
+
+	webhookDao := dao.NewWebhookDao(db)
+	webhookEmitter := repositories.NewWebhookEmitter(webhookDao)
+	webhookDispatcher := webhook.NewDispatcher(webhookDao, cfg.Webhooks)
+
 	authRepo := repositories.NewAuthRepository(
 		cfg.Server.BaseUrl.String(),
 		userDao,
@@ -112,25 +144,33 @@ func Configure() *Auth {
 		templateRepository,
 		forgotPasswordTokenRepository,
 		inviteService,
+		auditRepo,
+		webhookEmitter,
 	)
 
-	appDao := dao.NewApplicationDao(db)
-	orgDao := dao.NewOrganizationDao(db)
-
-	publisher := database.NewRedisPublisherProvider(
+	subscriber := database.NewRedisSubscriberProvider(
 		cfg.PubSub.Addr.String(),
 		cfg.PubSub.Password.String(),
 	)
-	permissionModel := config.LoadRbacModel(os.Getenv("RBAC_MODEL_FILE"))
-	policyProvider := rbac.NewDatabasePolicyProvider(userDao, orgDao)
-	accessControlService := rbac.NewCasbinAccessControl(
-		permissionModel,
-		kv,
-		publisher,
-		policyProvider,
+
+	policyValidator := rbac.NewResourceRegistry(
+		routes.AuthResources,
+		repositories.UserResources,
+		repositories.OrganizationResources,
+		repositories.ApplicationResources,
+		repositories.PolicySetResources,
+		repositories.PostResources,
+		repositories.CommentResources,
+		repositories.AuditResources,
+		repositories.WebhookResources,
 	)
 
-	userService := repositories.NewUserRepository(userDao, accessControlService)
+	userService := repositories.NewUserRepository(
+		userDao,
+		accessControlService,
+		policyValidator,
+		auditRepo,
+	)
 	appService := repositories.NewApplicationRepository(
 		appDao,
 		accessControlService,
@@ -138,6 +178,7 @@ func Configure() *Auth {
 		authCodeService,
 		signer,
 		cfg.AccessToken,
+		auditRepo,
 	)
 
 	orgRepo := repositories.NewOrganizationRepository(
@@ -145,9 +186,40 @@ func Configure() *Auth {
 		orgDao,
 		userDao,
 		accessControlService,
+		policyValidator,
 		inviteToOrgTokenService,
 		emailService,
 		templateRepository,
+		auditRepo,
+		webhookEmitter,
+	)
+
+	policySetRepo := repositories.NewPolicySetRepository(
+		policySetDao,
+		userDao,
+		orgDao,
+		accessControlService,
+		policyValidator,
+		auditRepo,
+	)
+
+	webhookRepo := repositories.NewWebhookRepository(
+		webhookDao,
+		appDao,
+		orgDao,
+		accessControlService,
+		auditRepo,
+	)
+
+	scimRepo := repositories.NewScimRepository(
+		cfg.Server.BaseUrl.String(),
+		userDao,
+		orgDao,
+		appDao,
+		cfg.PasswordConfig,
+		accessControlService,
+		auditRepo,
+		webhookEmitter,
 	)
 
 	return &Auth{
@@ -168,12 +240,14 @@ func Configure() *Auth {
 				sessionStore,
 				templateRepository,
 				cfg.Notifications,
+				repositories.ClientScopes,
 			),
 			routes.NewUserRoutes(
 				cfg.Notifications,
 				sessionStore,
 				templateRepository,
 				userService,
+				policyValidator,
 			),
 			routes.NewKeyRoutes(
 				&privateKey.PublicKey,
@@ -189,6 +263,38 @@ func Configure() *Auth {
 				sessionStore,
 				templateRepository,
 				orgRepo,
+				policyValidator,
+			),
+			routes.NewPolicySetRoutes(
+				cfg.Notifications,
+				sessionStore,
+				templateRepository,
+				policySetRepo,
+				policyValidator,
+			),
+			routes.NewAuditRoutes(
+				cfg.Notifications,
+				sessionStore,
+				templateRepository,
+				auditRepo,
+			),
+			routes.NewWebhookRoutes(
+				cfg.Notifications,
+				sessionStore,
+				templateRepository,
+				webhookRepo,
+			),
+			routes.NewScimRoutes(
+				signer,
+				scimRepo,
+			),
+			routes.NewApiRoutes(
+				signer,
+				accessControlService,
+				authRepo,
+				userService,
+				orgRepo,
+				appService,
 			),
 		),
 		cleanup: func(_ context.Context) {
@@ -197,6 +303,9 @@ func Configure() *Auth {
 			// publisher.Close()
 		},
 		setup: func(ctx context.Context) {
+			go accessControlService.ListenForInvalidation(ctx, subscriber)
+			go webhookDispatcher.Start(ctx)
+
 			if cfg.DefaultUser != nil {
 				_, err := authRepo.GetUserByUsername(ctx, "ROOT")
 				if err == services.AccountNotFound {
@@ -238,6 +347,16 @@ func Configure() *Auth {
 				if err != nil {
 					panic(err)
 				}
+
+				app, err := appService.GetAppByClientId(newContext, cfg.DefaultApp.ClientId.String())
+				if err != nil {
+					panic(err)
+				}
+
+				err = appService.UpdateScopes(newContext, app.AppId, cfg.DefaultApp.Scopes)
+				if err != nil {
+					panic(err)
+				}
 			}
 		},
 	}
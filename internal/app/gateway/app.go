@@ -7,6 +7,7 @@ import (
 
 	"github.com/jhamill34/notion-provisioner/internal/config"
 	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/services/render"
 	"github.com/jhamill34/notion-provisioner/internal/services/repositories"
 	"github.com/jhamill34/notion-provisioner/internal/services/session"
 	"github.com/jhamill34/notion-provisioner/internal/transport"
@@ -46,6 +47,7 @@ func Configure() *Gateway {
 			routes.NewGatewayRoutes(
 				sessionStore,
 				templateRepository,
+				render.NewRenderer(cfg.Server.BaseUrl.String()),
 				http.DefaultClient,
 				cfg.SessionConfig,
 				cfg.Oauth,
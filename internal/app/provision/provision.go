@@ -0,0 +1,162 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jhamill34/notion-provisioner/internal/config"
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+	"github.com/jhamill34/notion-provisioner/internal/services/provision"
+	"github.com/jhamill34/notion-provisioner/internal/services/rbac"
+	"github.com/jhamill34/notion-provisioner/internal/services/repositories"
+	"github.com/jhamill34/notion-provisioner/internal/transport/routes"
+)
+
+type Provision struct {
+	provisioner *provision.Provisioner
+	cleanup     func()
+}
+
+// Configure builds the same services the auth server uses from its config
+// file. Provisioning never sends email or issues tokens so those
+// dependencies are left out.
+func Configure() *Provision {
+	cfg, err := config.LoadAuthConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		panic(err)
+	}
+
+	db := database.NewMySQLDbProvider(cfg.Database.GetConnectionString())
+	kv := database.NewRedisProvider("AUTH:", cfg.Cache.Addr.String(), cfg.Cache.Password.String())
+
+	userDao := dao.NewUserDao(db)
+	appDao := dao.NewApplicationDao(db)
+	orgDao := dao.NewOrganizationDao(db)
+	policySetDao := dao.NewPolicySetDao(db)
+
+	publisher := database.NewRedisPublisherProvider(
+		cfg.PubSub.Addr.String(),
+		cfg.PubSub.Password.String(),
+	)
+	policyVersions := database.NewRedisProvider(
+		"POLICY:",
+		cfg.PubSub.Addr.String(),
+		cfg.PubSub.Password.String(),
+	)
+
+	permissionModel := config.LoadRbacModel(os.Getenv("RBAC_MODEL_FILE"))
+	policyProvider := rbac.NewDatabasePolicyProvider(userDao, orgDao, policySetDao)
+	accessControlService := rbac.NewCasbinAccessControl(
+		permissionModel,
+		kv,
+		policyVersions,
+		publisher,
+		policyProvider,
+	)
+
+	auditRepo := repositories.NewAuditRepository(dao.NewAuditLogDao(db), accessControlService)
+	webhookEmitter := repositories.NewWebhookEmitter(dao.NewWebhookDao(db))
+
+	policyValidator := rbac.NewResourceRegistry(
+		routes.AuthResources,
+		repositories.UserResources,
+		repositories.OrganizationResources,
+		repositories.ApplicationResources,
+		repositories.PolicySetResources,
+		repositories.PostResources,
+		repositories.CommentResources,
+		repositories.AuditResources,
+		repositories.WebhookResources,
+	)
+
+	authRepo := repositories.NewAuthRepository(
+		cfg.Server.BaseUrl.String(),
+		userDao,
+		cfg.PasswordConfig,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		auditRepo,
+		webhookEmitter,
+	)
+
+	userService := repositories.NewUserRepository(
+		userDao,
+		accessControlService,
+		policyValidator,
+		auditRepo,
+	)
+
+	orgRepo := repositories.NewOrganizationRepository(
+		cfg.Server.BaseUrl.String(),
+		orgDao,
+		userDao,
+		accessControlService,
+		policyValidator,
+		nil,
+		nil,
+		nil,
+		auditRepo,
+		webhookEmitter,
+	)
+
+	appService := repositories.NewApplicationRepository(
+		appDao,
+		accessControlService,
+		cfg.PasswordConfig,
+		nil,
+		nil,
+		cfg.AccessToken,
+		auditRepo,
+	)
+
+	return &Provision{
+		provisioner: provision.NewProvisioner(
+			authRepo,
+			userService,
+			orgRepo,
+			appService,
+			policyValidator,
+		),
+		cleanup: func() {
+			db.Close()
+		},
+	}
+}
+
+// Run prints the plan for the spec and, when apply is set, makes the
+// changes. Everything is done as ROOT.
+func (self *Provision) Run(ctx context.Context, out io.Writer, specFile string, apply, prune bool) error {
+	defer self.cleanup()
+
+	spec, err := config.LoadProvisionSpec(specFile)
+	if err != nil {
+		return err
+	}
+
+	ctx = context.WithValue(ctx, "user_id", "ROOT")
+
+	plan, err := self.provisioner.Plan(ctx, spec, prune)
+	if err != nil {
+		return err
+	}
+
+	plan.Write(out)
+
+	if !apply || plan.Empty() {
+		return nil
+	}
+
+	if err := self.provisioner.Apply(ctx, plan); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\nApplied %d changes.\n", len(plan.Changes))
+
+	return nil
+}
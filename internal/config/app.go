@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,12 +13,36 @@ type AppConfig struct {
 	PubSub     RedisConfig      `yaml:"pubsub"`
 	Cache      RedisConfig      `yaml:"cache"`
 	AuthServer AuthServerConfig `yaml:"auth_server"`
+	Blog       BlogConfig       `yaml:"blog"`
+	Template   TemplateConfig   `yaml:"template"`
+	Media      MediaConfig      `yaml:"media"`
+
+	// Without an SMTP server authors aren't emailed about comments
+	Email EmailParams `yaml:"email"`
+}
+
+// BlogConfig controls the preview links handed out for unpublished posts.
+// BaseUrl is where readers see the blog, it's used for links in emails.
+type BlogConfig struct {
+	BaseUrl    StringFromEnv  `yaml:"base_url"`
+	PreviewKey StringFromFile `yaml:"preview_key"`
+	PreviewTTL time.Duration  `yaml:"preview_ttl"`
+}
+
+// MediaConfig is where uploads are kept, Path is a directory on the local
+// filesystem.
+type MediaConfig struct {
+	Path string `yaml:"path"`
 }
 
 type AuthServerConfig struct {
-	BaseUrl    StringFromEnv `yaml:"base_url"`
-	KeyPath    string        `yaml:"key_path"`
-	PolicyPath string        `yaml:"policy_path"`
+	BaseUrl      StringFromEnv  `yaml:"base_url"`
+	KeyPath      string         `yaml:"key_path"`
+	PolicyPath   string         `yaml:"policy_path"`
+	TokenPath    string         `yaml:"token_path"`
+	UserPath     string         `yaml:"user_path"`
+	ClientId     StringFromFile `yaml:"client_id"`
+	ClientSecret StringFromFile `yaml:"client_secret"`
 }
 
 func LoadAppConfig(filename string) (AppConfig, error) {
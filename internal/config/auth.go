@@ -18,6 +18,7 @@ type App struct {
 	Name         string         `yaml:"name"`
 	Description  string         `yaml:"description"`
 	RedirectUri  StringFromEnv  `yaml:"redirect_uri"`
+	Scopes       []string       `yaml:"scopes"`
 }
 
 type HashParams struct {
@@ -41,6 +42,16 @@ type AccessTokenConfiguration struct {
 	PublicKeyPath  StringFromEnv `yaml:"public_key_path"`
 	PrivateKeyPath StringFromEnv `yaml:"private_key_path"`
 	TTL            time.Duration `yaml:"ttl"`
+	EmbedPolicy    bool          `yaml:"embed_policy"`
+}
+
+type WebhookConfig struct {
+	PollInterval   time.Duration `yaml:"poll_interval"`
+	Timeout        time.Duration `yaml:"timeout"`
+	BatchSize      int           `yaml:"batch_size"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
 }
 
 type AuthConfig struct {
@@ -60,6 +71,7 @@ type AuthConfig struct {
 	AccessToken       AccessTokenConfiguration `yaml:"access_token"`
 	Session           SessionConfig            `yaml:"session"`
 	Email             EmailParams              `yaml:"email"`
+	Webhooks          WebhookConfig            `yaml:"webhooks"`
 }
 
 func LoadAuthConfig(filename string) (AuthConfig, error) {
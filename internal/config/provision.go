@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProvisionSpec is the desired state of the auth database. Users are
+// matched by email, organizations by name and apps by client id.
+type ProvisionSpec struct {
+	Users         []UserSpec         `yaml:"users"`
+	Organizations []OrganizationSpec `yaml:"organizations"`
+	Apps          []App              `yaml:"apps"`
+}
+
+type UserSpec struct {
+	Username string        `yaml:"username"`
+	Email    StringFromEnv `yaml:"email"`
+
+	// Only used when the user is created, existing passwords are left alone.
+	Password *StringFromFile `yaml:"password"`
+	Policies []PolicySpec    `yaml:"policies"`
+}
+
+type OrganizationSpec struct {
+	Name        string          `yaml:"name"`
+	Description string          `yaml:"description"`
+	Members     []StringFromEnv `yaml:"members"`
+	Policies    []PolicySpec    `yaml:"policies"`
+}
+
+type PolicySpec struct {
+	Resource  string `yaml:"resource"`
+	Action    string `yaml:"action"`
+	Effect    string `yaml:"effect"`
+	Condition string `yaml:"condition"`
+}
+
+func LoadProvisionSpec(filename string) (ProvisionSpec, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return ProvisionSpec{}, err
+	}
+	defer file.Close()
+
+	var spec ProvisionSpec
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(&spec)
+	if err != nil {
+		return ProvisionSpec{}, err
+	}
+
+	return spec, nil
+}
@@ -1,14 +1,109 @@
 package database
 
+import "time"
+
 type Post struct {
 	Id        string `db:"id"`
+	Slug      string `db:"slug"`
 	Title     string `db:"title"`
 	Content   string `db:"content"`
 	Author    string `db:"author"`
-	Image     []byte `db:"image"`
-	Thumbnail []byte `db:"thumbnail"`
-	ImageMime *string `db:"image_mime"`
+	ImageId   *string `db:"image_id"`
+	ThumbnailId *string `db:"thumbnail_id"`
+	Status    string `db:"status"`
+	PublishedAt *string `db:"published_at"`
 	CreatedAt string `db:"created_at"`
 	UpdatedAt string `db:"updated_at"`
 }
 
+type Media struct {
+	Id          string  `db:"id"`
+	MimeType    string  `db:"mime_type"`
+	Size        int64   `db:"size"`
+	Width       int     `db:"width"`
+	Height      int     `db:"height"`
+	ThumbnailId *string `db:"thumbnail_id"`
+	CreatedBy   string  `db:"created_by"`
+	CreatedAt   string  `db:"created_at"`
+}
+
+// MediaVariant is a smaller copy of an image at one of the srcset widths.
+type MediaVariant struct {
+	MediaId   string `db:"media_id"`
+	Width     int    `db:"width"`
+	VariantId string `db:"variant_id"`
+}
+
+// LegacyPostImage is an image still stored in the post row from before
+// media had a store of its own. Its type is sniffed from the content, the
+// image_mime column isn't trusted.
+type LegacyPostImage struct {
+	PostId string `db:"id"`
+	Author string `db:"author"`
+	Image  []byte `db:"image"`
+}
+
+
+// PostCursor is a position in the post list, the publish date and id of
+// the post on the edge of a page.
+type PostCursor struct {
+	Date time.Time
+	Id   string
+}
+
+type PostFilter struct {
+	Author string
+	Tag    string
+	Since  time.Time
+	Until  time.Time
+
+	// Only posts published at or before this time, when it's set, along
+	// with any written by VisibleTo
+	PublishedBy time.Time
+	VisibleTo   string
+
+	// Posts older than After or newer than Before
+	After  *PostCursor
+	Before *PostCursor
+}
+
+type Tag struct {
+	Slug       string `db:"slug"`
+	Name       string `db:"name"`
+	Restricted bool   `db:"restricted"`
+}
+
+type PostTag struct {
+	PostId string `db:"post_id"`
+	Tag
+}
+
+type TagCount struct {
+	Tag
+	Count int `db:"count"`
+}
+
+// PostMatch is a post found by a search, higher scores are better matches.
+type PostMatch struct {
+	Post
+	Score float64 `db:"score"`
+}
+
+type PostRevision struct {
+	Id        int64  `db:"id"`
+	PostId    string `db:"post_id"`
+	Title     string `db:"title"`
+	Content   string `db:"content"`
+	Author    string `db:"author"`
+	CreatedAt string `db:"created_at"`
+}
+
+type Comment struct {
+	Id        string  `db:"id"`
+	PostId    string  `db:"post_id"`
+	ParentId  *string `db:"parent_id"`
+	Author    string  `db:"author"`
+	Content   string  `db:"content"`
+	Status    string  `db:"status"`
+	CreatedAt string  `db:"created_at"`
+}
@@ -8,16 +8,19 @@ type UserEntity struct {
 	Email          string    `db:"email"`
 	HashedPassword string    `db:"hashed_password"`
 	Verified       bool      `db:"verified"`
+	Active         bool      `db:"active"`
+	ExternalId     string    `db:"external_id"`
 	CreatedAt      time.Time `db:"created_at"`
 	UpdatedAt      time.Time `db:"updated_at"`
 }
 
 type UserPermissionEntity struct {
-	Id       int    `db:"id"`
-	UserId   string `db:"user_id"`
-	Resource string `db:"resource"`
-	Action   string `db:"action"`
-	Effect   string `db:"effect"`
+	Id        int    `db:"id"`
+	UserId    string `db:"user_id"`
+	Resource  string `db:"resource"`
+	Action    string `db:"action"`
+	Effect    string `db:"effect"`
+	Condition string `db:"cond"`
 }
 
 type ApplicationEntity struct {
@@ -27,6 +30,7 @@ type ApplicationEntity struct {
 	RedirectUri        string    `db:"redirect_uri"`
 	Name               string    `db:"name"`
 	Description        string    `db:"description"`
+	Scopes             string    `db:"scopes"`
 	CreatedAt          time.Time `db:"created_at"`
 	UpdatedAt          time.Time `db:"updated_at"`
 }
@@ -42,14 +46,16 @@ type OrganizationEntity struct {
 	Id          string `db:"id"`
 	Name        string `db:"name"`
 	Description string `db:"description"`
+	ExternalId  string `db:"external_id"`
 }
 
 type OrganizationPermissionEntity struct {
-	Id       int    `db:"id"`
-	OrgId    string `db:"org_id"`
-	Resource string `db:"resource"`
-	Action   string `db:"action"`
-	Effect   string `db:"effect"`
+	Id        int    `db:"id"`
+	OrgId     string `db:"org_id"`
+	Resource  string `db:"resource"`
+	Action    string `db:"action"`
+	Effect    string `db:"effect"`
+	Condition string `db:"cond"`
 }
 
 type OrganizationUserEntity struct {
@@ -57,3 +63,78 @@ type OrganizationUserEntity struct {
 	OrgId  string `db:"org_id"`
 	UserId string `db:"user_id"`
 }
+
+type PolicySetEntity struct {
+	Id          string `db:"id"`
+	Name        string `db:"name"`
+	Description string `db:"description"`
+}
+
+type PolicySetPermissionEntity struct {
+	Id        int    `db:"id"`
+	SetId     string `db:"set_id"`
+	Resource  string `db:"resource"`
+	Action    string `db:"action"`
+	Effect    string `db:"effect"`
+	Condition string `db:"cond"`
+}
+
+// Filter is a single comparison against a column, Operator is one of the
+// SCIM operators (eq, ne, co, sw, ew, pr).
+type Filter struct {
+	Column   string
+	Operator string
+	Value    interface{}
+}
+
+type AuditLogEntity struct {
+	Id        int64     `db:"id"`
+	Actor     string    `db:"actor"`
+	Action    string    `db:"action"`
+	Target    string    `db:"target"`
+	Detail    string    `db:"detail"`
+	Ip        string    `db:"ip"`
+	RequestId string    `db:"request_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type AuditLogFilter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+}
+
+type WebhookEntity struct {
+	Id        string    `db:"id"`
+	OwnerType string    `db:"owner_type"`
+	OwnerId   string    `db:"owner_id"`
+	Url       string    `db:"url"`
+	Secret    string    `db:"secret"`
+	Events    string    `db:"events"`
+	Global    bool      `db:"global"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type WebhookDeliveryEntity struct {
+	Id            int64     `db:"id"`
+	WebhookId     string    `db:"webhook_id"`
+	EventId       string    `db:"event_id"`
+	Event         string    `db:"event"`
+	Payload       string    `db:"payload"`
+	Status        string    `db:"status"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	LastStatus    int       `db:"last_status"`
+	LastError     string    `db:"last_error"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+// PendingDeliveryEntity is a delivery along with what's needed to send it.
+type PendingDeliveryEntity struct {
+	WebhookDeliveryEntity
+	Url    string `db:"url"`
+	Secret string `db:"secret"`
+}
@@ -59,7 +59,7 @@ func (self *ApplicationDao) FindById(
 	var app database.ApplicationEntity
 	err := db.GetContext(ctx, &app, `
 		SELECT 
-			id, client_id, hashed_client_secret, redirect_uri, name, description, created_at, updated_at
+			id, client_id, hashed_client_secret, redirect_uri, name, description, scopes, created_at, updated_at
 		FROM application
 		WHERE id = ?
 	`, id)
@@ -84,7 +84,7 @@ func (self *ApplicationDao) FindByClientId(
 	var app database.ApplicationEntity
 	err := db.GetContext(ctx, &app, `
 		SELECT 
-			id, client_id, hashed_client_secret, redirect_uri, name, description, created_at, updated_at
+			id, client_id, hashed_client_secret, redirect_uri, name, description, scopes, created_at, updated_at
 		FROM application
 		WHERE client_id = ?
 	`, clientId)
@@ -116,6 +116,38 @@ func (self *ApplicationDao) UpdateSecret(ctx context.Context, appId, hashedSecre
 	return nil
 }
 
+func (self *ApplicationDao) Update(ctx context.Context, appId, redirectUri, name, description string) error {
+	db := self.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE application
+		SET redirect_uri = ?, name = ?, description = ?
+		WHERE id = ?
+	`, redirectUri, name, description, appId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (self *ApplicationDao) UpdateScopes(ctx context.Context, appId, scopes string) error {
+	db := self.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE application
+		SET scopes = ?
+		WHERE id = ?
+	`, scopes, appId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (self *ApplicationDao) Delete(ctx context.Context, appId string) error {
 	db := self.databaseProvider.Get()
 
@@ -137,7 +169,7 @@ func (self *ApplicationDao) List(ctx context.Context) ([]database.ApplicationEnt
 	var apps []database.ApplicationEntity
 	err := db.SelectContext(ctx, &apps, `
 		SELECT 
-			id, client_id, hashed_client_secret, redirect_uri, name, description, created_at, updated_at
+			id, client_id, hashed_client_secret, redirect_uri, name, description, scopes, created_at, updated_at
 		FROM application
 	`)
 
@@ -208,3 +240,22 @@ func (self *ApplicationDao) DeleteRefreshToken(
 
 	return nil
 }
+
+// DeleteUserRefreshTokens revokes every refresh token issued to the user.
+func (self *ApplicationDao) DeleteUserRefreshTokens(
+	ctx context.Context,
+	userId string,
+) error {
+	db := self.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM refresh_token
+		WHERE user_id = ?
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package dao
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+)
+
+// AuditLogDao only ever appends to the audit log, there is intentionally
+// no way to change or remove an entry.
+type AuditLogDao struct {
+	databaseProvider database.DatabaseProvider
+}
+
+func NewAuditLogDao(databaseProvider database.DatabaseProvider) *AuditLogDao {
+	return &AuditLogDao{
+		databaseProvider: databaseProvider,
+	}
+}
+
+func (dao *AuditLogDao) Insert(
+	ctx context.Context,
+	entry *database.AuditLogEntity,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, action, target, detail, ip, request_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, entry.Actor, entry.Action, entry.Target, entry.Detail, entry.Ip, entry.RequestId)
+
+	return err
+}
+
+// List returns the newest entries matching the filter first.
+func (dao *AuditLogDao) List(
+	ctx context.Context,
+	filter database.AuditLogFilter,
+	limit int,
+) ([]database.AuditLogEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	where, args := auditLogWhere(filter)
+	args = append(args, limit)
+
+	var entries []database.AuditLogEntity
+	err := db.SelectContext(ctx, &entries, `
+		SELECT id, actor, action, target, detail, ip, request_id, created_at
+		FROM audit_log
+		`+where+`
+		ORDER BY id DESC
+		LIMIT ?
+	`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Each streams every entry matching the filter in the order they were
+// written so large exports don't have to be held in memory.
+func (dao *AuditLogDao) Each(
+	ctx context.Context,
+	filter database.AuditLogFilter,
+	fn func(*database.AuditLogEntity) error,
+) error {
+	db := dao.databaseProvider.Get()
+
+	where, args := auditLogWhere(filter)
+
+	rows, err := db.QueryxContext(ctx, `
+		SELECT id, actor, action, target, detail, ip, request_id, created_at
+		FROM audit_log
+		`+where+`
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry database.AuditLogEntity
+		if err := rows.StructScan(&entry); err != nil {
+			return err
+		}
+
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func auditLogWhere(filter database.AuditLogFilter) (string, []interface{}) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+
+	if filter.Target != "" {
+		conditions = append(conditions, "target = ?")
+		args = append(args, filter.Target)
+	}
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since)
+	}
+
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,100 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/jhamill34/notion-provisioner/internal/database"
+)
+
+type CommentDao struct {
+	databaseProvider database.DatabaseProvider
+}
+
+func NewCommentDao(databaseProvider database.DatabaseProvider) *CommentDao {
+	return &CommentDao{databaseProvider: databaseProvider}
+}
+
+func (self *CommentDao) CreateComment(
+	ctx context.Context,
+	postId string,
+	parentId *string,
+	author, content, status string,
+) (string, error) {
+	db := self.databaseProvider.Get()
+	id := uuid.New().String()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO comment (id, post_id, parent_id, author, content, status)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, id, postId, parentId, author, content, status)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (self *CommentDao) GetComment(ctx context.Context, id string) (*database.Comment, error) {
+	db := self.databaseProvider.Get()
+
+	var comment database.Comment
+	err := db.GetContext(ctx, &comment, `
+		SELECT id, post_id, parent_id, author, content, status, created_at
+		FROM comment
+		WHERE id = ?
+	`, id)
+	if err == sql.ErrNoRows {
+		return nil, database.NotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// ListComments returns every comment on the post whatever its status,
+// oldest first.
+func (self *CommentDao) ListComments(ctx context.Context, postId string) ([]database.Comment, error) {
+	db := self.databaseProvider.Get()
+
+	var comments []database.Comment
+	err := db.SelectContext(ctx, &comments, `
+		SELECT id, post_id, parent_id, author, content, status, created_at
+		FROM comment
+		WHERE post_id = ?
+		ORDER BY created_at, id
+	`, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (self *CommentDao) SetStatus(ctx context.Context, id, status string) error {
+	db := self.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE comment
+		SET status = ?, updated_at = current_timestamp
+		WHERE id = ?
+	`, status, id)
+
+	return err
+}
+
+// DeleteComment removes the comment along with any replies to it.
+func (self *CommentDao) DeleteComment(ctx context.Context, id string) error {
+	db := self.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM comment
+		WHERE id = ?
+	`, id)
+
+	return err
+}
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"strings"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+)
+
+// filterWhere builds a WHERE clause joining every filter with AND. Columns
+// are checked against the allowed set since they end up in the query as is.
+func filterWhere(
+	filters []database.Filter,
+	columns map[string]bool,
+) (string, []interface{}, error) {
+	conditions := make([]string, 0, len(filters))
+	args := make([]interface{}, 0, len(filters))
+
+	for _, filter := range filters {
+		if !columns[filter.Column] {
+			return "", nil, database.InvalidFilter
+		}
+
+		switch filter.Operator {
+		case "eq":
+			conditions = append(conditions, filter.Column+" = ?")
+			args = append(args, filter.Value)
+		case "ne":
+			conditions = append(conditions, filter.Column+" <> ?")
+			args = append(args, filter.Value)
+		case "co", "sw", "ew":
+			value, ok := filter.Value.(string)
+			if !ok {
+				return "", nil, database.InvalidFilter
+			}
+
+			value = escapeLike(value)
+			switch filter.Operator {
+			case "co":
+				value = "%" + value + "%"
+			case "sw":
+				value = value + "%"
+			case "ew":
+				value = "%" + value
+			}
+
+			conditions = append(conditions, filter.Column+" LIKE ?")
+			args = append(args, value)
+		case "pr":
+			conditions = append(conditions, filter.Column+" IS NOT NULL AND "+filter.Column+" <> ''")
+		default:
+			return "", nil, database.InvalidFilter
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
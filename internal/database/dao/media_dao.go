@@ -0,0 +1,200 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+type MediaDao struct {
+	databaseProvider database.DatabaseProvider
+}
+
+func NewMediaDao(databaseProvider database.DatabaseProvider) *MediaDao {
+	return &MediaDao{databaseProvider: databaseProvider}
+}
+
+// CreateMedia saves the media unless it's already been uploaded, the id
+// is the hash of the content so it's the same media either way. Two
+// uploads of the same file can race so existing rows are ignored rather
+// than checked for first. The variants need to have been saved as media
+// first.
+func (self *MediaDao) CreateMedia(ctx context.Context, media *database.Media, variants ...database.MediaVariant) error {
+	db := self.databaseProvider.Get()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT IGNORE INTO media (id, mime_type, size, width, height, thumbnail_id, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, media.Id, media.MimeType, media.Size, media.Width, media.Height, media.ThumbnailId, media.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		_, err = tx.ExecContext(ctx, `
+			INSERT IGNORE INTO media_variant (media_id, width, variant_id)
+			VALUES (?, ?, ?)
+		`, media.Id, variant.Width, variant.VariantId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (self *MediaDao) GetMedia(ctx context.Context, id string) (*database.Media, error) {
+	db := self.databaseProvider.Get()
+
+	var media database.Media
+	err := db.GetContext(ctx, &media, `
+		SELECT id, mime_type, size, width, height, thumbnail_id, created_by, created_at
+		FROM media
+		WHERE id = ?
+	`, id)
+	if err == sql.ErrNoRows {
+		return nil, database.NotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &media, nil
+}
+
+// ListPostMedia returns the media on a post in the order it was added.
+func (self *MediaDao) ListPostMedia(ctx context.Context, postId string) ([]database.Media, error) {
+	db := self.databaseProvider.Get()
+
+	var media []database.Media
+	err := db.SelectContext(ctx, &media, `
+		SELECT
+			media.id, media.mime_type, media.size, media.width, media.height,
+			media.thumbnail_id, media.created_by, media.created_at
+		FROM post_media
+		JOIN media ON media.id = post_media.media_id
+		WHERE post_media.post_id = ?
+		ORDER BY post_media.created_at, media.id
+	`, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// ListVariants returns the variants of each of the media, narrowest first.
+func (self *MediaDao) ListVariants(ctx context.Context, mediaIds ...string) ([]database.MediaVariant, error) {
+	if len(mediaIds) == 0 {
+		return []database.MediaVariant{}, nil
+	}
+
+	db := self.databaseProvider.Get()
+
+	query, args, err := sqlx.In(`
+		SELECT media_id, width, variant_id
+		FROM media_variant
+		WHERE media_id IN (?)
+		ORDER BY media_id, width
+	`, mediaIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []database.MediaVariant
+	if err := db.SelectContext(ctx, &variants, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+// AddPostMedia adds the media to the post, when cover is set it also
+// becomes the post's image.
+func (self *MediaDao) AddPostMedia(ctx context.Context, postId, mediaId string, cover bool) error {
+	db := self.databaseProvider.Get()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.GetContext(ctx, &count, `
+		SELECT COUNT(*) FROM post_media WHERE post_id = ? AND media_id = ?
+	`, postId, mediaId)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO post_media (post_id, media_id)
+			VALUES (?, ?)
+		`, postId, mediaId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cover {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE post
+			SET image_id = ?, updated_at = current_timestamp
+			WHERE id = ?
+		`, mediaId, postId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemovePostMedia takes the media off the post, and off the top of it when
+// it was the post's image. The media itself is kept since other posts may
+// use it.
+func (self *MediaDao) RemovePostMedia(ctx context.Context, postId, mediaId string) error {
+	db := self.databaseProvider.Get()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE post
+		SET image_id = NULL, updated_at = current_timestamp
+		WHERE id = ? AND image_id = ?
+	`, postId, mediaId)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM post_media
+		WHERE post_id = ? AND media_id = ?
+	`, postId, mediaId)
+	if err != nil {
+		return err
+	}
+
+	if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return database.NotFound
+	}
+
+	return tx.Commit()
+}
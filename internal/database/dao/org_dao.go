@@ -41,6 +41,23 @@ func (dao *OrganizationDao) ListUsersOrgs(
 	return orgs, nil
 }
 
+func (dao *OrganizationDao) List(ctx context.Context) ([]database.OrganizationEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var orgs []database.OrganizationEntity
+	err := db.SelectContext(ctx, &orgs, `
+		SELECT id, name, description, external_id
+		FROM organization
+		ORDER BY name
+	`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
 func (dao *OrganizationDao) CreateOrganization(
 	ctx context.Context,
 	id, name, description string,
@@ -75,7 +92,7 @@ func (dao *OrganizationDao) FindById(
 
 	var org database.OrganizationEntity
 	err := db.GetContext(ctx, &org, `
-		SELECT id, name, description
+		SELECT id, name, description, external_id
 		FROM organization 
 		WHERE id = ?
 	`, id)
@@ -99,7 +116,7 @@ func (dao *OrganizationDao) FindByName(
 
 	var org database.OrganizationEntity
 	err := db.GetContext(ctx, &org, `
-		SELECT id, name, description
+		SELECT id, name, description, external_id
 		FROM organization 
 		WHERE name = ?
 	`, name)
@@ -142,7 +159,7 @@ func (dao *OrganizationDao) GetPermissions(
 	var permissions []database.OrganizationPermissionEntity
 	err := db.SelectContext(ctx, &permissions, `
 		SELECT 
-			id, org_id, resource, action, effect
+			id, org_id, resource, action, effect, cond
 		FROM 
 			organization_permission
 		WHERE 
@@ -158,15 +175,15 @@ func (dao *OrganizationDao) GetPermissions(
 
 func (dao *OrganizationDao) CreatePermission(
 	ctx context.Context,
-	orgId, resource, action, effect string,
+	orgId, resource, action, effect, condition string,
 ) error {
 	db := dao.databaseProvider.Get()
 
 	_, err := db.ExecContext(ctx, `
 		INSERT INTO organization_permission
-			(org_id, resource, action, effect)
-		VALUES (?, ?, ?, ?)
-	`, orgId, resource, action, effect)
+			(org_id, resource, action, effect, cond)
+		VALUES (?, ?, ?, ?, ?)
+	`, orgId, resource, action, effect, condition)
 
 	if err != nil {
 		return err
@@ -208,6 +225,8 @@ func (dao *OrganizationDao) GetUsers(
 			user.email as email, 
 			user.hashed_password as hashed_password, 
 			user.verified as verified, 
+			user.active as active, 
+			user.external_id as external_id, 
 			user.created_at as created_at, 
 			user.updated_at as updated_at 
 		FROM user 
@@ -304,3 +323,109 @@ func (dao *OrganizationDao) RemoveAllUsers(
 
 	return nil
 }
+
+func (dao *OrganizationDao) RemoveAllPolicySets(
+	ctx context.Context,
+	orgId string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM organization_policy_set
+		WHERE org_id = ?
+	`, orgId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var organizationFilterColumns = map[string]bool{
+	"id":          true,
+	"name":        true,
+	"external_id": true,
+}
+
+// SearchOrganizations returns a page of the organizations matching every
+// filter along with the total number of matches.
+func (dao *OrganizationDao) SearchOrganizations(
+	ctx context.Context,
+	filters []database.Filter,
+	offset, limit int,
+) ([]database.OrganizationEntity, int, error) {
+	db := dao.databaseProvider.Get()
+
+	where, args, err := filterWhere(filters, organizationFilterColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := db.GetContext(ctx, &total, "SELECT COUNT(*) FROM organization "+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	var orgs []database.OrganizationEntity
+	err = db.SelectContext(ctx, &orgs, `
+		SELECT id, name, description, external_id
+		FROM organization
+		`+where+`
+		ORDER BY name, id
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return orgs, total, nil
+}
+
+func (dao *OrganizationDao) UpdateOrganization(
+	ctx context.Context,
+	id, name, externalId string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	existing, err := dao.FindByName(ctx, name)
+	if err == nil && existing.Id != id {
+		return database.Duplicate
+	}
+
+	if err != nil && err != database.NotFound {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		UPDATE organization
+		SET name = ?, external_id = ?
+		WHERE id = ?
+	`, name, externalId, id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *OrganizationDao) UpdateDescription(
+	ctx context.Context,
+	id, description string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE organization
+		SET description = ?
+		WHERE id = ?
+	`, description, id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
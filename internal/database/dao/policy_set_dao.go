@@ -0,0 +1,493 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+)
+
+type PolicySetDao struct {
+	databaseProvider database.DatabaseProvider
+}
+
+func NewPolicySetDao(databaseProvider database.DatabaseProvider) *PolicySetDao {
+	return &PolicySetDao{
+		databaseProvider: databaseProvider,
+	}
+}
+
+func (dao *PolicySetDao) List(ctx context.Context) ([]database.PolicySetEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var sets []database.PolicySetEntity
+	err := db.SelectContext(ctx, &sets, `
+		SELECT id, name, description
+		FROM policy_set
+		ORDER BY name
+	`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sets, nil
+}
+
+func (dao *PolicySetDao) FindById(
+	ctx context.Context,
+	id string,
+) (*database.PolicySetEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var set database.PolicySetEntity
+	err := db.GetContext(ctx, &set, `
+		SELECT id, name, description
+		FROM policy_set
+		WHERE id = ?
+	`, id)
+
+	if err == sql.ErrNoRows {
+		return nil, database.NotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &set, nil
+}
+
+func (dao *PolicySetDao) FindByName(
+	ctx context.Context,
+	name string,
+) (*database.PolicySetEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var set database.PolicySetEntity
+	err := db.GetContext(ctx, &set, `
+		SELECT id, name, description
+		FROM policy_set
+		WHERE name = ?
+	`, name)
+
+	if err == sql.ErrNoRows {
+		return nil, database.NotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &set, nil
+}
+
+func (dao *PolicySetDao) Create(
+	ctx context.Context,
+	id, name, description string,
+) (*database.PolicySetEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	if _, err := dao.FindByName(ctx, name); err != database.NotFound {
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, database.Duplicate
+	}
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO policy_set (id, name, description)
+		VALUES (?, ?, ?)
+	`, id, name, description)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.PolicySetEntity{
+		Id:          id,
+		Name:        name,
+		Description: description,
+	}, nil
+}
+
+func (dao *PolicySetDao) UpdateDescription(
+	ctx context.Context,
+	id, description string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE policy_set
+		SET description = ?
+		WHERE id = ?
+	`, description, id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes the set along with its policies and every
+// user or organization attachment.
+func (dao *PolicySetDao) Delete(ctx context.Context, id string) error {
+	db := dao.databaseProvider.Get()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM user_policy_set WHERE set_id = ?`,
+		`DELETE FROM organization_policy_set WHERE set_id = ?`,
+		`DELETE FROM policy_set_permission WHERE set_id = ?`,
+		`DELETE FROM policy_set WHERE id = ?`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//==============================================================================
+// Permissions
+//==============================================================================
+
+func (dao *PolicySetDao) GetPermissions(
+	ctx context.Context,
+	setId string,
+) ([]database.PolicySetPermissionEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var permissions []database.PolicySetPermissionEntity
+	err := db.SelectContext(ctx, &permissions, `
+		SELECT
+			id, set_id, resource, action, effect, cond
+		FROM
+			policy_set_permission
+		WHERE
+			set_id = ?
+	`, setId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (dao *PolicySetDao) CreatePermission(
+	ctx context.Context,
+	setId, resource, action, effect, condition string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO policy_set_permission
+			(set_id, resource, action, effect, cond)
+		VALUES (?, ?, ?, ?, ?)
+	`, setId, resource, action, effect, condition)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PolicySetDao) DeletePermission(
+	ctx context.Context,
+	setId string,
+	permissionId int,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM policy_set_permission
+		WHERE set_id = ? AND id = ?
+	`, setId, permissionId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReplacePermissions swaps every policy in the set for the given
+// ones in a single transaction.
+func (dao *PolicySetDao) ReplacePermissions(
+	ctx context.Context,
+	setId string,
+	permissions []database.PolicySetPermissionEntity,
+) error {
+	db := dao.databaseProvider.Get()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM policy_set_permission
+		WHERE set_id = ?
+	`, setId)
+	if err != nil {
+		return err
+	}
+
+	for _, permission := range permissions {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO policy_set_permission
+				(set_id, resource, action, effect, cond)
+			VALUES (?, ?, ?, ?, ?)
+		`, setId, permission.Resource, permission.Action, permission.Effect, permission.Condition)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//==============================================================================
+// Attachments
+//==============================================================================
+
+func (dao *PolicySetDao) ListUserSets(
+	ctx context.Context,
+	userId string,
+) ([]database.PolicySetEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var sets []database.PolicySetEntity
+	err := db.SelectContext(ctx, &sets, `
+		SELECT
+			policy_set.id as id,
+			policy_set.name as name,
+			policy_set.description as description
+		FROM policy_set
+		INNER JOIN user_policy_set ON policy_set.id = user_policy_set.set_id
+		WHERE user_policy_set.user_id = ?
+	`, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sets, nil
+}
+
+func (dao *PolicySetDao) ListOrgSets(
+	ctx context.Context,
+	orgId string,
+) ([]database.PolicySetEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var sets []database.PolicySetEntity
+	err := db.SelectContext(ctx, &sets, `
+		SELECT
+			policy_set.id as id,
+			policy_set.name as name,
+			policy_set.description as description
+		FROM policy_set
+		INNER JOIN organization_policy_set ON policy_set.id = organization_policy_set.set_id
+		WHERE organization_policy_set.org_id = ?
+	`, orgId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sets, nil
+}
+
+func (dao *PolicySetDao) GetUsers(
+	ctx context.Context,
+	setId string,
+) ([]database.UserEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var users []database.UserEntity
+	err := db.SelectContext(ctx, &users, `
+		SELECT
+			user.id as id,
+			user.name as name,
+			user.email as email,
+			user.hashed_password as hashed_password,
+			user.verified as verified,
+			user.active as active,
+			user.external_id as external_id,
+			user.created_at as created_at,
+			user.updated_at as updated_at
+		FROM user
+		INNER JOIN user_policy_set ON user.id = user_policy_set.user_id
+		WHERE user_policy_set.set_id = ?
+	`, setId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (dao *PolicySetDao) GetOrgs(
+	ctx context.Context,
+	setId string,
+) ([]database.OrganizationEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var orgs []database.OrganizationEntity
+	err := db.SelectContext(ctx, &orgs, `
+		SELECT
+			organization.id as id,
+			organization.name as name,
+			organization.description as description
+		FROM organization
+		INNER JOIN organization_policy_set ON organization.id = organization_policy_set.org_id
+		WHERE organization_policy_set.set_id = ?
+	`, setId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// GetAffectedUserIds returns every user that receives the set's policies,
+// either directly or through one of their organizations.
+func (dao *PolicySetDao) GetAffectedUserIds(
+	ctx context.Context,
+	setId string,
+) ([]string, error) {
+	db := dao.databaseProvider.Get()
+
+	var ids []string
+	err := db.SelectContext(ctx, &ids, `
+		SELECT user_id FROM user_policy_set WHERE set_id = ?
+		UNION
+		SELECT organization_user.user_id
+		FROM organization_user
+		INNER JOIN organization_policy_set ON organization_user.org_id = organization_policy_set.org_id
+		WHERE organization_policy_set.set_id = ?
+	`, setId, setId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (dao *PolicySetDao) AttachUser(
+	ctx context.Context,
+	setId, userId string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	var count int
+	err := db.GetContext(ctx, &count, `
+		SELECT COUNT(*) FROM user_policy_set
+		WHERE set_id = ? AND user_id = ?
+	`, setId, userId)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return database.Duplicate
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO user_policy_set
+			(set_id, user_id)
+		VALUES (?, ?)
+	`, setId, userId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PolicySetDao) DetachUser(
+	ctx context.Context,
+	setId, userId string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM user_policy_set
+		WHERE set_id = ? AND user_id = ?
+	`, setId, userId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PolicySetDao) AttachOrg(
+	ctx context.Context,
+	setId, orgId string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	var count int
+	err := db.GetContext(ctx, &count, `
+		SELECT COUNT(*) FROM organization_policy_set
+		WHERE set_id = ? AND org_id = ?
+	`, setId, orgId)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return database.Duplicate
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO organization_policy_set
+			(set_id, org_id)
+		VALUES (?, ?)
+	`, setId, orgId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *PolicySetDao) DetachOrg(
+	ctx context.Context,
+	setId, orgId string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM organization_policy_set
+		WHERE set_id = ? AND org_id = ?
+	`, setId, orgId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
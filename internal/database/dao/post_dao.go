@@ -3,9 +3,11 @@ package dao
 import (
 	"context"
 	"database/sql"
+	"strings"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jmoiron/sqlx"
 )
 
 type PostDao struct {
@@ -16,22 +18,39 @@ func NewPostDao(databaseProvider database.DatabaseProvider) *PostDao {
 	return &PostDao{databaseProvider: databaseProvider}
 }
 
+// CreatePost saves the post along with its first revision. The slug has
+// to be unique.
 func (self *PostDao) CreatePost(
 	ctx context.Context,
-	title, content, author string,
-) (string, error) {
+	id, title, slug, content, author string,
+) error {
 	db := self.databaseProvider.Get()
-	id := uuid.New().String()
 
-	_, err := db.ExecContext(ctx, `
-		INSERT INTO post (id, title, content, author)
-		VALUES (?, ?, ?, ?)
-	`, id, title, content, author)
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
-		return "", err
+		return err
+	}
+	defer tx.Rollback()
+
+	if taken, err := slugTaken(ctx, tx, slug, id); err != nil {
+		return err
+	} else if taken {
+		return database.Duplicate
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO post (id, slug, title, content, author)
+		VALUES (?, ?, ?, ?, ?)
+	`, id, slug, title, content, author)
+	if err != nil {
+		return err
+	}
+
+	if err := insertRevision(ctx, tx, id, title, content, author); err != nil {
+		return err
 	}
 
-	return id, nil
+	return tx.Commit()
 }
 
 func (self *PostDao) GetPost(ctx context.Context, id string) (*database.Post, error) {
@@ -40,7 +59,7 @@ func (self *PostDao) GetPost(ctx context.Context, id string) (*database.Post, er
 	var post database.Post
 	err := db.GetContext(ctx, &post, `
 		SELECT 
-			id, title, content, author, image, image_mime, thumbnail, created_at, updated_at
+			id, slug, title, content, author, image_id, status, published_at, created_at, updated_at
 		FROM post 
 		WHERE id = ?
 	`, id)
@@ -55,26 +74,233 @@ func (self *PostDao) GetPost(ctx context.Context, id string) (*database.Post, er
 	return &post, nil
 }
 
+func (self *PostDao) GetPostBySlug(ctx context.Context, slug string) (*database.Post, error) {
+	db := self.databaseProvider.Get()
+
+	var post database.Post
+	err := db.GetContext(ctx, &post, `
+		SELECT 
+			id, slug, title, content, author, image_id, status, published_at, created_at, updated_at
+		FROM post 
+		WHERE slug = ?
+	`, slug)
+	if err == sql.ErrNoRows {
+		return nil, database.NotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+// FindMovedSlug returns the id of the post that used to have the slug.
+func (self *PostDao) FindMovedSlug(ctx context.Context, slug string) (string, error) {
+	db := self.databaseProvider.Get()
+
+	var postId string
+	err := db.GetContext(ctx, &postId, `
+		SELECT post_id
+		FROM post_slug_history
+		WHERE slug = ?
+	`, slug)
+	if err == sql.ErrNoRows {
+		return "", database.NotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return postId, nil
+}
+
+// SlugInUse is true when a post other than postId has, or used to have,
+// the slug.
+func (self *PostDao) SlugInUse(ctx context.Context, slug, postId string) (bool, error) {
+	return slugTaken(ctx, self.databaseProvider.Get(), slug, postId)
+}
+
+// SetSlug changes the post's slug and keeps the old one so links to it
+// still find the post.
+func (self *PostDao) SetSlug(ctx context.Context, id, slug string) error {
+	db := self.databaseProvider.Get()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.GetContext(ctx, &current, `
+		SELECT slug FROM post WHERE id = ?
+	`, id)
+	if err == sql.ErrNoRows {
+		return database.NotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if current == slug {
+		return nil
+	}
+
+	if taken, err := slugTaken(ctx, tx, slug, id); err != nil {
+		return err
+	} else if taken {
+		return database.Duplicate
+	}
+
+	// Going back to a slug the post used before
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM post_slug_history
+		WHERE slug = ? AND post_id = ?
+	`, slug, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_slug_history (slug, post_id)
+		VALUES (?, ?)
+	`, current, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE post
+		SET slug = ?, updated_at = current_timestamp
+		WHERE id = ?
+	`, slug, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func slugTaken(
+	ctx context.Context,
+	db sqlx.QueryerContext,
+	slug, postId string,
+) (bool, error) {
+	var count int
+	err := sqlx.GetContext(ctx, db, &count, `
+		SELECT
+			(SELECT COUNT(*) FROM post WHERE slug = ? AND id <> ?) +
+			(SELECT COUNT(*) FROM post_slug_history WHERE slug = ? AND post_id <> ?)
+	`, slug, postId, slug, postId)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// UpdatePost overwrites the post and, when something changed, records the
+// new title and content as a revision made by editor.
 func (self *PostDao) UpdatePost(
 	ctx context.Context,
-	id, title, content string,
+	id, title, content, editor string,
 ) error {
 	db := self.databaseProvider.Get()
 
-	_, err := db.ExecContext(ctx, `
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// updated_at is set first so it's compared against the old title and
+	// content, an update that changes nothing leaves every column alone
+	result, err := tx.ExecContext(ctx, `
 		UPDATE post
-		SET title = ?, content = ?
+		SET
+			updated_at = CASE WHEN title <> ? OR content <> ? THEN current_timestamp ELSE updated_at END,
+			title = ?,
+			content = ?
 		WHERE id = ?
-	`, title, content, id)
+	`, title, content, title, content, id)
+	if err != nil {
+		return err
+	}
+
+	// Nothing changed, or there's no such post, so there's nothing to record
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		if _, err := self.GetPost(ctx, id); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	if err := insertRevision(ctx, tx, id, title, content, editor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertRevision(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	postId, title, content, author string,
+) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO post_revision (post_id, title, content, author)
+		VALUES (?, ?, ?, ?)
+	`, postId, title, content, author)
+
+	return err
+}
+
+// ListRevisions returns a post's revisions newest first, without content.
+func (self *PostDao) ListRevisions(ctx context.Context, postId string) ([]database.PostRevision, error) {
+	db := self.databaseProvider.Get()
+
+	var revisions []database.PostRevision
+	err := db.SelectContext(ctx, &revisions, `
+		SELECT id, post_id, title, '' AS content, author, created_at
+		FROM post_revision
+		WHERE post_id = ?
+		ORDER BY id DESC
+	`, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (self *PostDao) GetRevision(
+	ctx context.Context,
+	postId string,
+	id int64,
+) (*database.PostRevision, error) {
+	db := self.databaseProvider.Get()
+
+	var revision database.PostRevision
+	err := db.GetContext(ctx, &revision, `
+		SELECT id, post_id, title, content, author, created_at
+		FROM post_revision
+		WHERE post_id = ? AND id = ?
+	`, postId, id)
 	if err == sql.ErrNoRows {
-		return database.NotFound
+		return nil, database.NotFound
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &revision, nil
 }
 
 func (self *PostDao) DeletePost(ctx context.Context, id string) error {
@@ -95,15 +321,40 @@ func (self *PostDao) DeletePost(ctx context.Context, id string) error {
 	return nil
 }
 
-func (self *PostDao) ListPosts(ctx context.Context) ([]database.Post, error) {
+// POST_DATE is what posts are ordered by, when they were published or, for
+// posts that never were, created.
+const POST_DATE = "COALESCE(published_at, created_at)"
+
+// ListPosts returns up to limit posts matching the filter. Rows come back
+// newest first, or oldest first when paging backwards with filter.Before,
+// so the caller always gets the posts closest to the cursor. Only enough
+// content for a preview and the image's thumbnail are selected.
+func (self *PostDao) ListPosts(
+	ctx context.Context,
+	filter database.PostFilter,
+	limit int,
+) ([]database.Post, error) {
 	db := self.databaseProvider.Get()
 
+	where, args := postWhere(filter)
+	args = append(args, limit)
+
+	order := "DESC"
+	if filter.Before != nil {
+		order = "ASC"
+	}
+
 	var posts []database.Post
 	err := db.SelectContext(ctx, &posts, `
 		SELECT 
-			id, title, content, author, image, image_mime, thumbnail, created_at, updated_at
+			id, slug, title, SUBSTRING(content, 1, 101) AS content, author, image_id,
+			COALESCE((SELECT thumbnail_id FROM media WHERE media.id = post.image_id), image_id) AS thumbnail_id,
+			status, published_at, created_at, updated_at
 		FROM post
-	`)
+		`+where+`
+		ORDER BY `+POST_DATE+` `+order+`, id `+order+`
+		LIMIT ?
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -111,14 +362,100 @@ func (self *PostDao) ListPosts(ctx context.Context) ([]database.Post, error) {
 	return posts, nil
 }
 
-func (self *PostDao) AddImage(ctx context.Context, id string, mimeType string, data []byte, thumbnail []byte) error {
+// ListFeedPosts is ListPosts with the full content of each post, newest
+// first.
+func (self *PostDao) ListFeedPosts(
+	ctx context.Context,
+	filter database.PostFilter,
+	limit int,
+) ([]database.Post, error) {
+	db := self.databaseProvider.Get()
+
+	where, args := postWhere(filter)
+	args = append(args, limit)
+
+	var posts []database.Post
+	err := db.SelectContext(ctx, &posts, `
+		SELECT 
+			id, slug, title, content, author, status, published_at, created_at, updated_at
+		FROM post
+		`+where+`
+		ORDER BY `+POST_DATE+` DESC, id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+func postWhere(filter database.PostFilter) (string, []interface{}) {
+	conditions, args := postConditions(filter)
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func postConditions(filter database.PostFilter) ([]string, []interface{}) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if filter.Author != "" {
+		conditions = append(conditions, "author = ?")
+		args = append(args, filter.Author)
+	}
+
+	if filter.Tag != "" {
+		conditions = append(conditions, "id IN (SELECT post_id FROM post_tag WHERE tag_slug = ?)")
+		args = append(args, filter.Tag)
+	}
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, POST_DATE+" >= ?")
+		args = append(args, filter.Since)
+	}
+
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, POST_DATE+" < ?")
+		args = append(args, filter.Until)
+	}
+
+	if !filter.PublishedBy.IsZero() && filter.VisibleTo != "" {
+		conditions = append(conditions, "((status = 'published' AND published_at <= ?) OR author = ?)")
+		args = append(args, filter.PublishedBy, filter.VisibleTo)
+	} else if !filter.PublishedBy.IsZero() {
+		conditions = append(conditions, "status = 'published' AND published_at <= ?")
+		args = append(args, filter.PublishedBy)
+	}
+
+	if filter.After != nil {
+		conditions = append(conditions, "("+POST_DATE+", id) < (?, ?)")
+		args = append(args, filter.After.Date, filter.After.Id)
+	}
+
+	if filter.Before != nil {
+		conditions = append(conditions, "("+POST_DATE+", id) > (?, ?)")
+		args = append(args, filter.Before.Date, filter.Before.Id)
+	}
+
+	return conditions, args
+}
+
+func (self *PostDao) SetStatus(
+	ctx context.Context,
+	id, status string,
+	publishedAt *time.Time,
+) error {
 	db := self.databaseProvider.Get()
 
 	_, err := db.ExecContext(ctx, `
-		UPDATE post 
-		SET image = ?, image_mime = ?, thumbnail = ?
+		UPDATE post
+		SET status = ?, published_at = ?
 		WHERE id = ?
-	`, data, mimeType, thumbnail, id)
+	`, status, publishedAt, id)
 
 	if err != nil {
 		return err
@@ -126,3 +463,55 @@ func (self *PostDao) AddImage(ctx context.Context, id string, mimeType string, d
 
 	return nil
 }
+
+// ListLegacyImages returns the ids of posts that still have their image
+// stored in the post row.
+func (self *PostDao) ListLegacyImages(ctx context.Context) ([]string, error) {
+	db := self.databaseProvider.Get()
+
+	var ids []string
+	err := db.SelectContext(ctx, &ids, `
+		SELECT id
+		FROM post
+		WHERE image IS NOT NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (self *PostDao) GetLegacyImage(ctx context.Context, id string) (*database.LegacyPostImage, error) {
+	db := self.databaseProvider.Get()
+
+	var image database.LegacyPostImage
+	err := db.GetContext(ctx, &image, `
+		SELECT id, author, image
+		FROM post
+		WHERE id = ? AND image IS NOT NULL
+	`, id)
+	if err == sql.ErrNoRows {
+		return nil, database.NotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// ClearLegacyImage drops the image stored in the post row once it's been
+// moved to the post's media.
+func (self *PostDao) ClearLegacyImage(ctx context.Context, id string) error {
+	db := self.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE post
+		SET image = NULL, image_mime = NULL, thumbnail = NULL
+		WHERE id = ?
+	`, id)
+
+	return err
+}
@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+)
+
+// PostSearchDao finds posts matching a full-text query, best matches first.
+// Each database has its own full-text syntax so there's an implementation
+// for each one.
+type PostSearchDao interface {
+	Search(
+		ctx context.Context,
+		query string,
+		filter database.PostFilter,
+		offset, limit int,
+	) ([]database.PostMatch, error)
+}
+
+// Matches in the title count for more than matches in the content.
+const TITLE_WEIGHT = 2
+
+// MySQLPostSearchDao uses the FULLTEXT indexes on post in natural language
+// mode.
+type MySQLPostSearchDao struct {
+	databaseProvider database.DatabaseProvider
+}
+
+func NewMySQLPostSearchDao(databaseProvider database.DatabaseProvider) *MySQLPostSearchDao {
+	return &MySQLPostSearchDao{databaseProvider: databaseProvider}
+}
+
+// Search implements dao.PostSearchDao.
+func (self *MySQLPostSearchDao) Search(
+	ctx context.Context,
+	query string,
+	filter database.PostFilter,
+	offset, limit int,
+) ([]database.PostMatch, error) {
+	db := self.databaseProvider.Get()
+
+	conditions, filterArgs := postConditions(filter)
+	conditions = append([]string{"MATCH(title, content) AGAINST (? IN NATURAL LANGUAGE MODE)"}, conditions...)
+
+	args := []interface{}{query, query, query}
+	args = append(args, filterArgs...)
+	args = append(args, limit, offset)
+
+	var matches []database.PostMatch
+	err := db.SelectContext(ctx, &matches, `
+		SELECT 
+			id, slug, title, content, author, image_id, status, published_at, created_at, updated_at,
+			MATCH(title) AGAINST (? IN NATURAL LANGUAGE MODE) * `+strconv.Itoa(TITLE_WEIGHT)+`
+				+ MATCH(content) AGAINST (? IN NATURAL LANGUAGE MODE) AS score
+		FROM post
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY score DESC, id
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// var _ PostSearchDao = (*MySQLPostSearchDao)(nil)
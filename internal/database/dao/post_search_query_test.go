@@ -0,0 +1,24 @@
+package dao
+
+import "testing"
+
+func TestFtsQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "gopher", want: `"gopher"`},
+		{query: "gopher  farm", want: `"gopher" OR "farm"`},
+		{query: `say "hi"`, want: `"say" OR """hi"""`},
+		{query: "NOT farm* NEAR(a b)", want: `"NOT" OR "farm*" OR "NEAR(a" OR "b)"`},
+		{query: "", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			if got := ftsQuery(test.query); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
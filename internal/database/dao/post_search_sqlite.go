@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+)
+
+// SqlitePostSearchDao searches an FTS5 table kept in sync with post by
+// triggers, which lets the search be exercised without a MySQL server.
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag, so
+// its tests only run with `go test -tags sqlite_fts5`.
+type SqlitePostSearchDao struct {
+	databaseProvider database.DatabaseProvider
+}
+
+func NewSqlitePostSearchDao(databaseProvider database.DatabaseProvider) *SqlitePostSearchDao {
+	return &SqlitePostSearchDao{databaseProvider: databaseProvider}
+}
+
+// CreateIndex sets up the FTS5 table and the triggers that keep it up to
+// date, then indexes any posts that already exist.
+func (self *SqlitePostSearchDao) CreateIndex(ctx context.Context) error {
+	db := self.databaseProvider.Get()
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS post_fts USING fts5(
+			title, content, content='post', content_rowid='rowid'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS post_fts_insert AFTER INSERT ON post BEGIN
+			INSERT INTO post_fts (rowid, title, content) VALUES (new.rowid, new.title, new.content);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS post_fts_delete AFTER DELETE ON post BEGIN
+			INSERT INTO post_fts (post_fts, rowid, title, content) VALUES ('delete', old.rowid, old.title, old.content);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS post_fts_update AFTER UPDATE OF title, content ON post BEGIN
+			INSERT INTO post_fts (post_fts, rowid, title, content) VALUES ('delete', old.rowid, old.title, old.content);
+			INSERT INTO post_fts (rowid, title, content) VALUES (new.rowid, new.title, new.content);
+		END`,
+		`INSERT INTO post_fts (post_fts) VALUES ('rebuild')`,
+	}
+
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Search implements dao.PostSearchDao.
+func (self *SqlitePostSearchDao) Search(
+	ctx context.Context,
+	query string,
+	filter database.PostFilter,
+	offset, limit int,
+) ([]database.PostMatch, error) {
+	db := self.databaseProvider.Get()
+
+	where, filterArgs := postWhere(filter)
+
+	args := []interface{}{ftsQuery(query)}
+	args = append(args, filterArgs...)
+	args = append(args, limit, offset)
+
+	// bm25 is lower for better matches so it's negated to match MySQL
+	var matches []database.PostMatch
+	err := db.SelectContext(ctx, &matches, `
+		SELECT 
+			id, slug, title, content, author, image_id, status, published_at, created_at, updated_at,
+			match_score AS score
+		FROM post
+		JOIN (
+			SELECT rowid AS match_rowid, -bm25(post_fts, `+strconv.Itoa(TITLE_WEIGHT)+`, 1) AS match_score
+			FROM post_fts
+			WHERE post_fts MATCH ?
+		) ON post.rowid = match_rowid
+		`+where+`
+		ORDER BY score DESC, id
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// ftsQuery quotes every word so punctuation in what the reader typed isn't
+// read as FTS5 query syntax. Any of the words can match, like MySQL's
+// natural language mode.
+func ftsQuery(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+
+	return strings.Join(words, " OR ")
+}
+
+// var _ PostSearchDao = (*SqlitePostSearchDao)(nil)
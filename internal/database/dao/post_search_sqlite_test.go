@@ -0,0 +1,265 @@
+//go:build sqlite_fts5
+
+package dao
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/services/search"
+)
+
+var _ PostSearchDao = (*SqlitePostSearchDao)(nil)
+
+// The MySQL migrations don't run on SQLite, this is just the part of post
+// the search reads.
+const SQLITE_POST_SCHEMA = `
+	CREATE TABLE post (
+		id varchar(36) primary key not null,
+		slug varchar(255) not null,
+		title varchar(255) not null,
+		content text not null,
+		author varchar(36) not null,
+		image_id varchar(64),
+		status varchar(16) not null default 'draft',
+		published_at timestamp null default null,
+		created_at timestamp not null default current_timestamp,
+		updated_at timestamp not null default current_timestamp
+	)
+`
+
+type testPost struct {
+	id      string
+	title   string
+	content string
+	status  string
+}
+
+func newSqliteSearch(t *testing.T, posts ...testPost) *SqlitePostSearchDao {
+	t.Helper()
+
+	provider := database.NewSqliteDbProvider(filepath.Join(t.TempDir(), "search.db"))
+	t.Cleanup(func() { provider.Close() })
+
+	ctx := context.Background()
+	db := provider.Get()
+	if _, err := db.ExecContext(ctx, SQLITE_POST_SCHEMA); err != nil {
+		t.Fatal(err)
+	}
+
+	// Posts that exist before the index is made have to be picked up too
+	insert := func(post testPost) {
+		var publishedAt *time.Time
+		if post.status == "published" {
+			published := time.Now().Add(-time.Hour).UTC()
+			publishedAt = &published
+		}
+
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO post (id, slug, title, content, author, status, published_at)
+			VALUES (?, ?, ?, ?, 'author', ?, ?)
+		`, post.id, post.id, post.title, post.content, post.status, publishedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	half := len(posts) / 2
+	for _, post := range posts[:half] {
+		insert(post)
+	}
+
+	searchDao := NewSqlitePostSearchDao(provider)
+	if err := searchDao.CreateIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, post := range posts[half:] {
+		insert(post)
+	}
+
+	return searchDao
+}
+
+func matchIds(matches []database.PostMatch) []string {
+	ids := make([]string, len(matches))
+	for i := range matches {
+		ids[i] = matches[i].Id
+	}
+
+	return ids
+}
+
+func TestSqlitePostSearch(t *testing.T) {
+	searchDao := newSqliteSearch(
+		t,
+		testPost{"content", "Notes from the week", "We spent most of it tuning the gopher farm.", "published"},
+		testPost{"title", "Gopher farm", "How the whole thing started.", "published"},
+		testPost{"draft", "Gopher drafts", "Not ready for anyone to read.", "draft"},
+		testPost{"other", "Unrelated", "Nothing to see here, it's about cats.", "published"},
+		testPost{"quoted", "Punctuation", `Someone typed "NOT" AND zebra* in the box`, "published"},
+	)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name   string
+		query  string
+		filter database.PostFilter
+		want   []string
+	}{
+		{
+			name:   "title matches rank first",
+			query:  "gopher farm",
+			filter: database.PostFilter{PublishedBy: now},
+			want:   []string{"title", "content"},
+		},
+		{
+			name:  "drafts are found without a publish filter",
+			query: "drafts",
+			want:  []string{"draft"},
+		},
+		{
+			name:   "drafts are hidden when only published posts are wanted",
+			query:  "drafts",
+			filter: database.PostFilter{PublishedBy: now},
+			want:   []string{},
+		},
+		{
+			name:   "authors find their own drafts",
+			query:  "drafts",
+			filter: database.PostFilter{PublishedBy: now, VisibleTo: "author"},
+			want:   []string{"draft"},
+		},
+		{
+			name:   "other users' drafts stay hidden",
+			query:  "drafts",
+			filter: database.PostFilter{PublishedBy: now, VisibleTo: "someone"},
+			want:   []string{},
+		},
+		{
+			name:   "query syntax is treated as words",
+			query:  `"NOT" zebra*`,
+			filter: database.PostFilter{PublishedBy: now},
+			want:   []string{"quoted"},
+		},
+		{
+			name:  "no matches",
+			query: "giraffe",
+			want:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matches, err := searchDao.Search(ctx, test.query, test.filter, 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := matchIds(matches)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got %v, want %v", got, test.want)
+				}
+			}
+
+			for i := 1; i < len(matches); i++ {
+				if matches[i].Score > matches[i-1].Score {
+					t.Errorf("scores out of order: %v", matches)
+				}
+			}
+		})
+	}
+}
+
+func TestSqlitePostSearchFollowsEdits(t *testing.T) {
+	searchDao := newSqliteSearch(
+		t,
+		testPost{"edited", "First title", "The original words.", "published"},
+		testPost{"deleted", "Going away", "Replacement words.", "published"},
+	)
+
+	ctx := context.Background()
+	db := searchDao.databaseProvider.Get()
+
+	if _, err := db.ExecContext(ctx, `UPDATE post SET content = 'Replacement words.' WHERE id = 'edited'`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM post WHERE id = 'deleted'`); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := searchDao.Search(ctx, "original", database.PostFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("old content still matches: %v", matchIds(matches))
+	}
+
+	matches, err = searchDao.Search(ctx, "replacement", database.PostFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := matchIds(matches); len(got) != 1 || got[0] != "edited" {
+		t.Errorf("got %v, want [edited]", got)
+	}
+}
+
+func TestSqlitePostSearchSnippets(t *testing.T) {
+	long := "Filler words to push the match along. "
+	content := ""
+	for len(content) < 400 {
+		content += long
+	}
+	content += "Eventually the Gopher shows up. " + content
+
+	searchDao := newSqliteSearch(
+		t,
+		testPost{"long", "A long post", content, "published"},
+		testPost{"short", "Short", "gopher", "published"},
+	)
+
+	ctx := context.Background()
+	terms := search.Terms("Gopher")
+
+	matches, err := searchDao.Search(ctx, "gopher", database.PostFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 2 {
+		t.Fatalf("got %v, want both posts", matchIds(matches))
+	}
+
+	for _, match := range matches {
+		parts := search.Snippet(match.Content, terms, 200)
+
+		highlighted := make([]string, 0)
+		length := 0
+		for _, part := range parts {
+			length += len(part.Text)
+			if part.Match {
+				highlighted = append(highlighted, part.Text)
+			}
+		}
+
+		if len(highlighted) != 1 || highlighted[0] != "Gopher" && highlighted[0] != "gopher" {
+			t.Errorf("%s: highlighted %q, want the matched word", match.Id, highlighted)
+		}
+
+		if length > 200 {
+			t.Errorf("%s: snippet is %d characters, want at most 200", match.Id, length)
+		}
+	}
+}
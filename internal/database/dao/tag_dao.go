@@ -0,0 +1,176 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+type TagDao struct {
+	databaseProvider database.DatabaseProvider
+}
+
+func NewTagDao(databaseProvider database.DatabaseProvider) *TagDao {
+	return &TagDao{databaseProvider: databaseProvider}
+}
+
+func (self *TagDao) GetTag(ctx context.Context, slug string) (*database.Tag, error) {
+	db := self.databaseProvider.Get()
+
+	var tag database.Tag
+	err := db.GetContext(ctx, &tag, `
+		SELECT slug, name, restricted
+		FROM tag
+		WHERE slug = ?
+	`, slug)
+	if err == sql.ErrNoRows {
+		return nil, database.NotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// FindTags returns the tags that exist out of the slugs given.
+func (self *TagDao) FindTags(ctx context.Context, slugs []string) ([]database.Tag, error) {
+	if len(slugs) == 0 {
+		return []database.Tag{}, nil
+	}
+
+	db := self.databaseProvider.Get()
+
+	query, args, err := sqlx.In(`
+		SELECT slug, name, restricted
+		FROM tag
+		WHERE slug IN (?)
+	`, slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []database.Tag
+	if err := db.SelectContext(ctx, &tags, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// ListPostTags returns the tags on each of the posts, ordered by name.
+func (self *TagDao) ListPostTags(ctx context.Context, postIds ...string) ([]database.PostTag, error) {
+	if len(postIds) == 0 {
+		return []database.PostTag{}, nil
+	}
+
+	db := self.databaseProvider.Get()
+
+	query, args, err := sqlx.In(`
+		SELECT pt.post_id, t.slug, t.name, t.restricted
+		FROM post_tag pt
+		JOIN tag t ON t.slug = pt.tag_slug
+		WHERE pt.post_id IN (?)
+		ORDER BY t.name
+	`, postIds)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []database.PostTag
+	if err := db.SelectContext(ctx, &tags, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// SetPostTags replaces the tags on a post, creating any tags that don't
+// exist yet.
+func (self *TagDao) SetPostTags(ctx context.Context, postId string, tags []database.Tag) error {
+	db := self.databaseProvider.Get()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, tag := range tags {
+		var count int
+		err := tx.GetContext(ctx, &count, `
+			SELECT COUNT(*) FROM tag WHERE slug = ?
+		`, tag.Slug)
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO tag (slug, name)
+				VALUES (?, ?)
+			`, tag.Slug, tag.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM post_tag
+		WHERE post_id = ?
+	`, postId)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO post_tag (post_id, tag_slug)
+			VALUES (?, ?)
+		`, postId, tag.Slug)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CountTags counts the posts published by the given time under each tag,
+// tags without any are left out.
+func (self *TagDao) CountTags(ctx context.Context, publishedBy time.Time) ([]database.TagCount, error) {
+	db := self.databaseProvider.Get()
+
+	var counts []database.TagCount
+	err := db.SelectContext(ctx, &counts, `
+		SELECT t.slug, t.name, t.restricted, COUNT(*) AS count
+		FROM tag t
+		JOIN post_tag pt ON pt.tag_slug = t.slug
+		JOIN post p ON p.id = pt.post_id
+		WHERE p.status = 'published' AND p.published_at <= ?
+		GROUP BY t.slug, t.name, t.restricted
+		ORDER BY t.name
+	`, publishedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (self *TagDao) SetRestricted(ctx context.Context, slug string, restricted bool) error {
+	db := self.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE tag
+		SET restricted = ?
+		WHERE slug = ?
+	`, restricted, slug)
+
+	return err
+}
@@ -23,7 +23,7 @@ func (dao *UserDao) FindById(ctx context.Context, id string) (*database.UserEnti
 	var user database.UserEntity
 	err := db.GetContext(ctx, &user, `
 		SELECT 
-			id, name, email, hashed_password, verified, created_at, updated_at 
+			id, name, email, hashed_password, verified, active, external_id, created_at, updated_at 
 		FROM 
 			user 
 		WHERE 
@@ -47,7 +47,7 @@ func (dao *UserDao) FindByEmail(ctx context.Context, email string) (*database.Us
 	var user database.UserEntity
 	err := db.GetContext(ctx, &user, `
 		SELECT 
-			id, name, email, hashed_password, verified, created_at, updated_at 
+			id, name, email, hashed_password, verified, active, external_id, created_at, updated_at 
 		FROM 
 			user 
 		WHERE 
@@ -74,7 +74,7 @@ func (dao *UserDao) FindByUsername(
 	var user database.UserEntity
 	err := db.GetContext(ctx, &user, `
 		SELECT 
-			id, name, email, hashed_password, verified, created_at, updated_at 
+			id, name, email, hashed_password, verified, active, external_id, created_at, updated_at 
 		FROM 
 			user 
 		WHERE 
@@ -117,6 +117,7 @@ func (dao *UserDao) CreateUser(
 			Email:          email,
 			HashedPassword: hashedPassword,
 			Verified:       verified,
+			Active:         true,
 		}, nil
 	} else {
 		return nil, database.Duplicate
@@ -164,7 +165,7 @@ func (dao *UserDao) GetPermissions(
 	var permissions []database.UserPermissionEntity
 	err := db.SelectContext(ctx, &permissions, `
 		SELECT 
-			id, user_id, resource, action, effect
+			id, user_id, resource, action, effect, cond
 		FROM 
 			user_permission 
 		WHERE 
@@ -180,16 +181,16 @@ func (dao *UserDao) GetPermissions(
 
 func (dao *UserDao) CreatePermission(
 	ctx context.Context,
-	id, resource, action, effect string,
+	id, resource, action, effect, condition string,
 ) error {
 	db := dao.databaseProvider.Get()
 
 	_, err := db.ExecContext(ctx, `
 		INSERT INTO user_permission
-			(user_id, resource, action, effect)
+			(user_id, resource, action, effect, cond)
 		VALUES 
-			(?, ?, ?, ?)
-	`, id, resource, action, effect)
+			(?, ?, ?, ?, ?)
+	`, id, resource, action, effect, condition)
 
 	if err != nil {
 		return err
@@ -223,7 +224,7 @@ func (dao *UserDao) ListUsers(ctx context.Context) ([]database.UserEntity, error
 	var users []database.UserEntity
 	err := db.SelectContext(ctx, &users, `
 		SELECT 
-			id, name, email, verified, created_at, updated_at 
+			id, name, email, verified, active, external_id, created_at, updated_at 
 		FROM 
 			user
 	`)
@@ -234,3 +235,92 @@ func (dao *UserDao) ListUsers(ctx context.Context) ([]database.UserEntity, error
 
 	return users, nil
 }
+
+var userFilterColumns = map[string]bool{
+	"id":          true,
+	"name":        true,
+	"email":       true,
+	"external_id": true,
+	"active":      true,
+}
+
+// SearchUsers returns a page of the users matching every filter along with
+// the total number of matches.
+func (dao *UserDao) SearchUsers(
+	ctx context.Context,
+	filters []database.Filter,
+	offset, limit int,
+) ([]database.UserEntity, int, error) {
+	db := dao.databaseProvider.Get()
+
+	where, args, err := filterWhere(filters, userFilterColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := db.GetContext(ctx, &total, "SELECT COUNT(*) FROM user "+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	var users []database.UserEntity
+	err = db.SelectContext(ctx, &users, `
+		SELECT 
+			id, name, email, verified, active, external_id, created_at, updated_at 
+		FROM 
+			user
+		`+where+`
+		ORDER BY created_at, id
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (dao *UserDao) UpdateUser(
+	ctx context.Context,
+	id, name, email, externalId string,
+) error {
+	db := dao.databaseProvider.Get()
+
+	existing, err := dao.FindByEmail(ctx, email)
+	if err == nil && existing.Id != id {
+		return database.Duplicate
+	}
+
+	if err != nil && err != database.NotFound {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		UPDATE user 
+		SET name = ?, email = ?, external_id = ?, updated_at = current_timestamp
+		WHERE id = ?
+	`, name, email, externalId, id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *UserDao) SetActive(ctx context.Context, id string, active bool) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE user 
+		SET active = ?, updated_at = current_timestamp
+		WHERE id = ?
+	`, active, id)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,344 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type WebhookDao struct {
+	databaseProvider database.DatabaseProvider
+}
+
+func NewWebhookDao(databaseProvider database.DatabaseProvider) *WebhookDao {
+	return &WebhookDao{
+		databaseProvider: databaseProvider,
+	}
+}
+
+func (dao *WebhookDao) List(ctx context.Context) ([]database.WebhookEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var webhooks []database.WebhookEntity
+	err := db.SelectContext(ctx, &webhooks, `
+		SELECT id, owner_type, owner_id, url, secret, events, global, created_at
+		FROM webhook
+		ORDER BY created_at
+	`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (dao *WebhookDao) FindById(
+	ctx context.Context,
+	id string,
+) (*database.WebhookEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var webhook database.WebhookEntity
+	err := db.GetContext(ctx, &webhook, `
+		SELECT id, owner_type, owner_id, url, secret, events, global, created_at
+		FROM webhook
+		WHERE id = ?
+	`, id)
+
+	if err == sql.ErrNoRows {
+		return nil, database.NotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// FindSubscribers returns the webhooks that could receive an event, the
+// global webhooks and the webhooks of the org the event belongs to.
+// Applications don't belong to an org, so an application webhook only sees
+// events when it's global, which only admins can make it. Callers still
+// need to check the event is one the webhook asked for.
+func (dao *WebhookDao) FindSubscribers(
+	ctx context.Context,
+	orgId string,
+) ([]database.WebhookEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var webhooks []database.WebhookEntity
+	err := db.SelectContext(ctx, &webhooks, `
+		SELECT id, owner_type, owner_id, url, secret, events, global, created_at
+		FROM webhook
+		WHERE global = true OR (owner_type = 'org' AND owner_id = ?)
+	`, orgId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (dao *WebhookDao) Create(
+	ctx context.Context,
+	webhook *database.WebhookEntity,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO webhook (id, owner_type, owner_id, url, secret, events, global)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, webhook.Id, webhook.OwnerType, webhook.OwnerId, webhook.Url, webhook.Secret, webhook.Events, webhook.Global)
+
+	return err
+}
+
+func (dao *WebhookDao) Delete(ctx context.Context, id string) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM webhook
+		WHERE id = ?
+	`, id)
+
+	return err
+}
+
+//==============================================================================
+// Deliveries
+//==============================================================================
+
+// Enqueue queues a delivery of the event to each webhook in a single
+// transaction so an event is either queued everywhere or nowhere.
+func (dao *WebhookDao) Enqueue(
+	ctx context.Context,
+	deliveries []database.WebhookDeliveryEntity,
+) error {
+	db := dao.databaseProvider.Get()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, delivery := range deliveries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_delivery
+				(webhook_id, event_id, event, payload, status, next_attempt_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, delivery.WebhookId, delivery.EventId, delivery.Event, delivery.Payload, DeliveryPending, delivery.NextAttemptAt)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListDue returns pending deliveries whose next attempt is due, oldest first.
+func (dao *WebhookDao) ListDue(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) ([]database.PendingDeliveryEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var deliveries []database.PendingDeliveryEntity
+	err := db.SelectContext(ctx, &deliveries, `
+		SELECT
+			webhook_delivery.id as id,
+			webhook_delivery.webhook_id as webhook_id,
+			webhook_delivery.event_id as event_id,
+			webhook_delivery.event as event,
+			webhook_delivery.payload as payload,
+			webhook_delivery.status as status,
+			webhook_delivery.attempts as attempts,
+			webhook_delivery.next_attempt_at as next_attempt_at,
+			webhook_delivery.last_status as last_status,
+			webhook_delivery.last_error as last_error,
+			webhook_delivery.created_at as created_at,
+			webhook_delivery.updated_at as updated_at,
+			webhook.url as url,
+			webhook.secret as secret
+		FROM webhook_delivery
+		INNER JOIN webhook ON webhook.id = webhook_delivery.webhook_id
+		WHERE webhook_delivery.status = ? AND webhook_delivery.next_attempt_at <= ?
+		ORDER BY webhook_delivery.next_attempt_at, webhook_delivery.id
+		LIMIT ?
+	`, DeliveryPending, now, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Claim leases a due delivery until the given time so that only one
+// dispatcher sends it. If the dispatcher dies the lease runs out and the
+// delivery is picked up again. Returns false when someone else got it.
+func (dao *WebhookDao) Claim(
+	ctx context.Context,
+	delivery *database.PendingDeliveryEntity,
+	leaseUntil time.Time,
+) (bool, error) {
+	db := dao.databaseProvider.Get()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET next_attempt_at = ?
+		WHERE id = ? AND status = ? AND attempts = ? AND next_attempt_at = ?
+	`, leaseUntil, delivery.Id, DeliveryPending, delivery.Attempts, delivery.NextAttemptAt)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (dao *WebhookDao) MarkDelivered(
+	ctx context.Context,
+	id int64,
+	status int,
+) error {
+	db := dao.databaseProvider.Get()
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = ?, attempts = attempts + 1, last_status = ?, last_error = ''
+		WHERE id = ?
+	`, DeliveryDelivered, status, id)
+
+	return err
+}
+
+// MarkFailed records a failed attempt and either schedules the next one or,
+// when nextAttempt is nil, moves the delivery to the dead letter list.
+func (dao *WebhookDao) MarkFailed(
+	ctx context.Context,
+	id int64,
+	status int,
+	message string,
+	nextAttempt *time.Time,
+) error {
+	db := dao.databaseProvider.Get()
+
+	if len(message) > 1024 {
+		message = message[:1024]
+	}
+
+	var err error
+	if nextAttempt == nil {
+		_, err = db.ExecContext(ctx, `
+			UPDATE webhook_delivery
+			SET status = ?, attempts = attempts + 1, last_status = ?, last_error = ?
+			WHERE id = ?
+		`, DeliveryDead, status, message, id)
+	} else {
+		_, err = db.ExecContext(ctx, `
+			UPDATE webhook_delivery
+			SET attempts = attempts + 1, last_status = ?, last_error = ?, next_attempt_at = ?
+			WHERE id = ?
+		`, status, message, *nextAttempt, id)
+	}
+
+	return err
+}
+
+// Retry moves a dead delivery back onto the queue with a fresh set of
+// attempts.
+func (dao *WebhookDao) Retry(
+	ctx context.Context,
+	webhookId string,
+	id int64,
+	now time.Time,
+) error {
+	db := dao.databaseProvider.Get()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND webhook_id = ? AND status = ?
+	`, DeliveryPending, now, id, webhookId, DeliveryDead)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return database.NotFound
+	}
+
+	return nil
+}
+
+func (dao *WebhookDao) ListDeliveries(
+	ctx context.Context,
+	webhookId string,
+	limit int,
+) ([]database.WebhookDeliveryEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var deliveries []database.WebhookDeliveryEntity
+	err := db.SelectContext(ctx, &deliveries, `
+		SELECT
+			id, webhook_id, event_id, event, payload, status, attempts,
+			next_attempt_at, last_status, last_error, created_at, updated_at
+		FROM webhook_delivery
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, webhookId, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (dao *WebhookDao) ListDead(
+	ctx context.Context,
+	limit int,
+) ([]database.WebhookDeliveryEntity, error) {
+	db := dao.databaseProvider.Get()
+
+	var deliveries []database.WebhookDeliveryEntity
+	err := db.SelectContext(ctx, &deliveries, `
+		SELECT
+			id, webhook_id, event_id, event, payload, status, attempts,
+			next_attempt_at, last_status, last_error, created_at, updated_at
+		FROM webhook_delivery
+		WHERE status = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, DeliveryDead, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
@@ -5,3 +5,4 @@ import "errors"
 var NotFound = errors.New("entity not found")
 var Duplicate = errors.New("duplicate entity")
 
+var InvalidFilter = errors.New("invalid filter")
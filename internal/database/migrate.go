@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -90,6 +92,33 @@ func getCurrentMigration(db *sqlx.DB, migrationKey string) (string, error) {
 	return version, nil
 }
 
+// migrationLess orders migrations by their numeric prefix so that
+// "10_foo.sql" runs after "9_bar.sql", falling back to the file name.
+func migrationLess(a, b string) bool {
+	numA, numB := migrationNumber(a), migrationNumber(b)
+	if numA != numB {
+		return numA < numB
+	}
+
+	return a < b
+}
+
+func migrationNumber(version string) int {
+	end := strings.IndexFunc(version, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if end == -1 {
+		end = len(version)
+	}
+
+	num, err := strconv.Atoi(version[:end])
+	if err != nil {
+		return -1
+	}
+
+	return num
+}
+
 // TODO: Binary Search
 func findLastMigrationIndex(migrations []migration, version string) (int, error) {
 	if version == "NA" {
@@ -120,7 +149,7 @@ func runMigrations(db *sqlx.DB, migrationKey string, migrations []migration) err
 	}
 
 	sort.SliceStable(migrations, func(a, b int) bool {
-		return migrations[a].version < migrations[b].version
+		return migrationLess(migrations[a].version, migrations[b].version)
 	})
 
 	// Get current version
@@ -17,6 +17,7 @@ type KeyValueStore interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Del(ctx context.Context, key string) error
 	Expire(ctx context.Context, key string, expiration time.Duration) error
+	Incr(ctx context.Context, key string) (int64, error)
 }
 
 type KeyValueStoreProvider interface {
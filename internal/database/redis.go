@@ -77,6 +77,11 @@ func (self *RedisStore) Expire(ctx context.Context, key string, expiration time.
 	return self.redisClient.Expire(ctx, self.prefix+key, expiration).Err()
 }
 
+// Incr implements KeyValueStore.
+func (self *RedisStore) Incr(ctx context.Context, key string) (int64, error) {
+	return self.redisClient.Incr(ctx, self.prefix+key).Result()
+}
+
 // Get implements KeyValueStore.
 func (self *RedisStore) Get(ctx context.Context, key string) (string, error) {
 	return self.redisClient.Get(ctx, self.prefix+key).Result()
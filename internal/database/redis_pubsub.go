@@ -136,18 +136,40 @@ type RedisSubscriber struct {
 }
 
 // Subscribe implements Subscriber.
+// The returned channel is closed when the subscription fails or the context
+// is cancelled. Any message published while nobody is subscribed is lost,
+// so callers should resync whatever state they derive from the channel
+// before subscribing again.
 func (self *RedisSubscriber) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
 	subscriber := self.redisClient.Subscribe(ctx, channel)
+
+	// Wait for the subscription to be confirmed so a broken connection is
+	// reported here instead of on the first message.
+	if _, err := subscriber.Receive(ctx); err != nil {
+		subscriber.Close()
+		return nil, err
+	}
+
 	ch := make(chan string)
 
 	go func() {
+		defer close(ch)
+		defer subscriber.Close()
+
 		for {
 			msg, err := subscriber.ReceiveMessage(ctx)
 			if err != nil {
-				panic(err)
+				if ctx.Err() == nil {
+					log.Printf("Subscription to %s failed: %s", channel, err)
+				}
+				return
 			}
 
-			ch <- msg.Payload
+			select {
+			case ch <- msg.Payload:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
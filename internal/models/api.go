@@ -0,0 +1,25 @@
+package models
+
+// ApiResponse wraps every successful JSON API response. Pagination is
+// only set for lists.
+type ApiResponse struct {
+	Data       interface{}    `json:"data"`
+	Pagination *ApiPagination `json:"pagination,omitempty"`
+}
+
+type ApiPagination struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Total  int `json:"total"`
+}
+
+// ApiError is the body of every failed JSON API response.
+type ApiError struct {
+	Error ApiErrorDetail `json:"error"`
+}
+
+type ApiErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
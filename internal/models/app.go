@@ -1,21 +1,198 @@
 package models
 
+import "time"
+
+const (
+	PostStatusDraft     = "draft"
+	PostStatusPublished = "published"
+	PostStatusArchived  = "archived"
+)
+
+// PostStatuses are every status a post can be in.
+var PostStatuses = []string{
+	PostStatusDraft,
+	PostStatusPublished,
+	PostStatusArchived,
+}
+
 type PostStub struct {
 	Id        string  `json:"id"`
+	Slug      string  `json:"slug"`
 	Title     string  `json:"title"`
-	Date      string  `json:"date"`
-	ImageMime *string `json:"image_mime"`
-	Image     string  `json:"image"`
-	Preview   string  `json:"preview"`
+	Date      string `json:"date"`
+	ImageId   string `json:"image_id,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Preview   string `json:"preview"`
+	Status    string `json:"status"`
+	Scheduled bool   `json:"scheduled"`
+	Tags      []Tag  `json:"tags"`
+}
+
+// PostChanges are the tags and status saved along with a post's content.
+// Nil tags and an empty status leave them as they are.
+type PostChanges struct {
+	Tags      []string
+	Status    string
+	PublishAt time.Time
+}
+
+// PostFilter narrows the post list, Since and Until compare against the
+// publish date.
+type PostFilter struct {
+	Author string
+	Tag    string
+	Since  time.Time
+	Until  time.Time
+}
+
+// PageRequest asks for the page after or before a cursor from a previous
+// page, with neither it's the first page.
+type PageRequest struct {
+	After  string
+	Before string
+	Limit  int
+}
+
+type PostPage struct {
+	Posts []PostStub `json:"posts"`
+	Next  string     `json:"next,omitempty"`
+	Prev  string     `json:"prev,omitempty"`
+}
+
+// Tag groups posts, Restricted tags can only be added to or removed from
+// posts by users allowed to apply them.
+type Tag struct {
+	Slug       string `json:"slug"`
+	Name       string `json:"name"`
+	Restricted bool   `json:"restricted,omitempty"`
+}
+
+type TagCount struct {
+	Tag
+	Count int `json:"count"`
+}
+
+// Highlight is part of a search snippet, Match is set on the words that
+// matched the search.
+type Highlight struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+type PostSearchResult struct {
+	Id        string      `json:"id"`
+	Slug      string      `json:"slug"`
+	Title     string      `json:"title"`
+	Date      string      `json:"date"`
+	Status    string      `json:"status"`
+	Scheduled bool        `json:"scheduled"`
+	Snippet   []Highlight `json:"snippet"`
 }
 
 type PostContent struct {
-	Id        string  `json:"id"`
-	Title     string  `json:"title"`
-	Date      string  `json:"date"`
-	ImageMime *string `json:"image_mime"`
-	Image     string  `json:"image"`
-	Content   string  `json:"content"`
+	Id          string  `json:"id"`
+	Slug        string  `json:"slug"`
+	Title       string  `json:"title"`
+	Date        string `json:"date"`
+	ImageId     string `json:"image_id,omitempty"`
+	Content     string `json:"content"`
+	Status      string `json:"status"`
+	Scheduled   bool   `json:"scheduled"`
+	PublishedAt string `json:"published_at,omitempty"`
+	UpdatedAt   string `json:"updated_at"`
+	Author      string `json:"author"`
+	AuthorName  string `json:"author_name,omitempty"`
+	Tags        []Tag  `json:"tags"`
+}
+
+// Media is an uploaded file, its id is the sha256 of its content so the
+// same file is only ever stored once.
+type Media struct {
+	Id          string         `json:"id"`
+	MimeType    string         `json:"mime_type"`
+	Size        int64          `json:"size"`
+	Width       int            `json:"width"`
+	Height      int            `json:"height"`
+	ThumbnailId string         `json:"thumbnail_id,omitempty"`
+	Variants    []MediaVariant `json:"variants,omitempty"`
+	Cover       bool           `json:"cover,omitempty"`
+}
+
+// MediaVariant is a smaller copy of an image, the srcset entries for it.
+type MediaVariant struct {
+	Id    string `json:"id"`
+	Width int    `json:"width"`
+}
+
+// PostPreview is a signed token that lets anyone holding it read a post
+// before it's published.
+type PostPreview struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// References are the links, images and heading anchors in a post's
+// markdown.
+type References struct {
+	Links   []string
+	Images  []string
+	Anchors []string
+}
+
+type PostRevision struct {
+	Id     int64  `json:"id"`
+	PostId string `json:"post_id"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	Date   string `json:"date"`
+}
+
+// DiffLine is one line of a diff, Op is "+" when the line was added, "-"
+// when it was removed and " " when it's in both.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type PostDiff struct {
+	From  PostRevision `json:"from"`
+	To    PostRevision `json:"to"`
+	Lines []DiffLine   `json:"lines"`
+}
+
+const (
+	CommentStatusPending  = "pending"
+	CommentStatusApproved = "approved"
+	CommentStatusSpam     = "spam"
+)
+
+// CommentStatuses are every status a comment can be in.
+var CommentStatuses = []string{
+	CommentStatusPending,
+	CommentStatusApproved,
+	CommentStatusSpam,
+}
+
+// Comment is left on a post by a signed in user, Content is markdown.
+// Only top level comments have Replies. Mine is set on the current user's
+// own comments.
+type Comment struct {
+	Id       string    `json:"id"`
+	PostId   string    `json:"post_id"`
+	ParentId string    `json:"parent_id,omitempty"`
+	Author   string    `json:"author"`
+	Content  string    `json:"content"`
+	Status   string    `json:"status"`
+	Date     string    `json:"date"`
+	Mine     bool      `json:"mine,omitempty"`
+	Replies  []Comment `json:"replies,omitempty"`
+}
+
+// CommentList is the comments on a post the current user can see,
+// moderators see every comment whatever its status.
+type CommentList struct {
+	Comments  []Comment `json:"comments"`
+	Moderator bool      `json:"moderator"`
 }
 
 type ForwardError struct {
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type User struct {
 	UserId string `json:"user_id"`
 	Name   string `json:"name"`
@@ -13,11 +15,12 @@ type Organization struct {
 }
 
 type App struct {
-	AppId       string `json:"app_id"`
-	ClientId    string `json:"client_id"`
-	RedirectUri string `json:"redirect_uri"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	AppId       string   `json:"app_id"`
+	ClientId    string   `json:"client_id"`
+	RedirectUri string   `json:"redirect_uri"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Scopes      []string `json:"scopes"`
 }
 
 type InviteData struct {
@@ -30,3 +33,31 @@ type EmailWithTokenData struct {
 	Token   string `json:"token"`
 	Id      string `json:"id"`
 }
+
+// AuditEvent describes something security relevant that just happened.
+// The actor defaults to whoever is making the request.
+type AuditEvent struct {
+	Actor  string
+	Action string
+	Target string
+	Detail string
+}
+
+type AuditEntry struct {
+	Id        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Detail    string    `json:"detail,omitempty"`
+	Ip        string    `json:"ip"`
+	RequestId string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+}
@@ -1,18 +1,59 @@
 package models
 
 type Policy struct {
-	PolicyId int    `json:"policy_id"`
-	Resource string `json:"resource"`
-	Action   string `json:"action"`
-	Effect   string `json:"effect"`
+	PolicyId  int    `json:"policy_id"`
+	Resource  string `json:"resource"`
+	Action    string `json:"action"`
+	Effect    string `json:"effect"`
+	Condition string `json:"condition,omitempty"`
+	Set       string `json:"set,omitempty"`
 }
 
+// ResourceAttributes are passed along with a request so that policy
+// conditions can inspect the resource, e.g. `r.attrs.owner == r.sub`.
+// Owner is a user id and Org an organization id, both are converted to
+// principals before being handed to the enforcer.
+type ResourceAttributes struct {
+	Owner      string `json:"owner"`
+	Org        string `json:"org"`
+	Visibility string `json:"visibility"`
+}
+
+// ResourceDefinition describes a resource path, in keyMatch5 syntax,
+// and the actions a service enforces on it.
+type ResourceDefinition struct {
+	Pattern string   `json:"pattern"`
+	Actions []string `json:"actions"`
+}
+
+type PolicySet struct {
+	SetId       string   `json:"set_id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Policies    []Policy `json:"policies"`
+}
+
+// AccessTokenClaims are the claims of every access token. User tokens have
+// the user as their subject. Tokens issued with the client_credentials grant
+// have a Typ of "client", the application as their subject and carry the
+// scopes granted to it in Scope, separated by spaces.
 type AccessTokenClaims struct {
-	Sub string `json:"sub"`
-	Aud string `json:"aud"`
-	Iss string `json:"iss"`
-	Exp int64  `json:"exp"`
-	Iat int64  `json:"iat"`
+	Sub   string       `json:"sub"`
+	Aud   string       `json:"aud"`
+	Iss   string       `json:"iss"`
+	Exp   int64        `json:"exp"`
+	Iat   int64        `json:"iat"`
+	Typ   string       `json:"typ,omitempty"`
+	Scope string       `json:"scope,omitempty"`
+	Pol   *PolicyClaim `json:"pol,omitempty"`
+}
+
+// PolicyClaim identifies the policies a user had when their access token
+// was issued. Services can keep authorizing with a cached copy of the
+// policies as long as it is at the same version and has the same digest.
+type PolicyClaim struct {
+	Version int64  `json:"ver"`
+	Digest  string `json:"dig"`
 }
 
 type PolicyResponse struct {
@@ -25,9 +66,28 @@ type OrgPolicyResponse struct {
 	Policy []Policy `json:"policy"`
 }
 
+type PolicyExplanation struct {
+	UserId   string        `json:"user_id"`
+	Resource string        `json:"resource"`
+	Action   string        `json:"action"`
+	Allowed  bool          `json:"allowed"`
+	Root     bool          `json:"root"`
+	Matched  []PolicyMatch `json:"matched"`
+}
+
+type PolicyMatch struct {
+	Principal string   `json:"principal"`
+	Source    string   `json:"source"`
+	Path      []string `json:"path"`
+	Resource  string   `json:"resource"`
+	Action    string   `json:"action"`
+	Effect    string   `json:"effect"`
+	Condition string   `json:"condition,omitempty"`
+}
+
 type AccessTokenResponse struct {
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 	Expires      int64  `json:"expires"`
 }
 
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ScimUserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimGroupSchema                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimPatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ScimServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+type ScimMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type ScimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// ScimUser is the SCIM representation of a user. Password is only ever
+// read from requests, it is never populated in responses.
+type ScimUser struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id,omitempty"`
+	ExternalId  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *ScimName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []ScimEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Password    string      `json:"password,omitempty"`
+	Meta        *ScimMeta   `json:"meta,omitempty"`
+}
+
+// ScimGroup is the SCIM representation of an organization.
+type ScimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	ExternalId  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []ScimMember `json:"members,omitempty"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// ScimQuery holds the query parameters of a list request. StartIndex is
+// one based as in the spec.
+type ScimQuery struct {
+	Filter             string
+	StartIndex         int
+	Count              int
+	ExcludedAttributes []string
+}
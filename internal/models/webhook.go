@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+const (
+	EventUserRegistered  = "user.registered"
+	EventUserVerified    = "user.verified"
+	EventOrgMemberJoined = "org.member_joined"
+	EventOrgMemberLeft   = "org.member_left"
+	EventPostCreated     = "post.created"
+	EventPostUpdated     = "post.updated"
+	EventPostPublished   = "post.published"
+	EventPostDeleted     = "post.deleted"
+)
+
+// WebhookEvents are every event a webhook can subscribe to.
+var WebhookEvents = []string{
+	EventUserRegistered,
+	EventUserVerified,
+	EventOrgMemberJoined,
+	EventOrgMemberLeft,
+	EventPostCreated,
+	EventPostUpdated,
+	EventPostPublished,
+	EventPostDeleted,
+}
+
+// WebhookEvent is something a producer wants delivered. Every event goes to
+// the global webhooks, events with an OrgId are also delivered to that
+// organization's webhooks.
+type WebhookEvent struct {
+	Type  string
+	OrgId string
+	Data  interface{}
+}
+
+// WebhookPayload is the body posted to a webhook.
+type WebhookPayload struct {
+	Id        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type Webhook struct {
+	WebhookId string    `json:"webhook_id"`
+	OwnerType string    `json:"owner_type"`
+	OwnerId   string    `json:"owner_id"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Global    bool      `json:"global"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	DeliveryId    int64     `json:"delivery_id"`
+	WebhookId     string    `json:"webhook_id"`
+	EventId       string    `json:"event_id"`
+	Event         string    `json:"event"`
+	Payload       string    `json:"payload"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastStatus    int       `json:"last_status"`
+	LastError     string    `json:"last_error"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type UserEventData struct {
+	UserId string `json:"user_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+
+type OrgMemberEventData struct {
+	OrgId  string `json:"org_id"`
+	UserId string `json:"user_id"`
+}
+
+type PostEventData struct {
+	PostId string `json:"post_id"`
+	Title  string `json:"title,omitempty"`
+	Author string `json:"author,omitempty"`
+}
@@ -2,15 +2,37 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"github.com/jhamill34/notion-provisioner/internal/models"
 )
 
 type BlogPostService interface {
-	CreatePost(ctx context.Context, title, content, author string) (*models.PostStub, models.Notifier)
-	GetPost(ctx context.Context, id string) (*models.PostContent, models.Notifier)
-	UpdatePost(ctx context.Context, id, title, content string) (*models.PostStub, models.Notifier)
+	CreatePost(ctx context.Context, title, slug, content, author string, changes models.PostChanges) (*models.PostStub, models.Notifier)
+	GetPost(ctx context.Context, idOrSlug string) (*models.PostContent, models.Notifier)
+	UpdatePost(ctx context.Context, id, title, slug, content string, changes models.PostChanges) (*models.PostStub, models.Notifier)
 	DeletePost(ctx context.Context, id string) models.Notifier
-	ListPosts(ctx context.Context) []models.PostStub
-	AddImage(ctx context.Context, id string, mimeType string, image []byte) models.Notifier
+	ListPosts(ctx context.Context, filter models.PostFilter, page models.PageRequest) (*models.PostPage, models.Notifier)
+	SearchPosts(ctx context.Context, query string) ([]models.PostSearchResult, models.Notifier)
+	FeedPosts(ctx context.Context, filter models.PostFilter) ([]models.PostContent, models.Notifier)
+
+	SetPostTags(ctx context.Context, id string, tags []string) ([]models.Tag, models.Notifier)
+	ListTags(ctx context.Context) []models.TagCount
+	GetTag(ctx context.Context, slug string) (*models.Tag, models.Notifier)
+	UpdateTag(ctx context.Context, slug string, restricted bool) (*models.Tag, models.Notifier)
+	SetPostStatus(ctx context.Context, id, status string, publishAt time.Time) (*models.PostStub, models.Notifier)
+	NewPreview(ctx context.Context, id string) (*models.PostPreview, models.Notifier)
+	GetPostPreview(ctx context.Context, idOrSlug, token string) (*models.PostContent, models.Notifier)
+	SetPostSlug(ctx context.Context, id, slug string) (*models.PostStub, models.Notifier)
+
+	ListRevisions(ctx context.Context, id string) ([]models.PostRevision, models.Notifier)
+	DiffRevisions(ctx context.Context, id string, from, to int64) (*models.PostDiff, models.Notifier)
+	RestoreRevision(ctx context.Context, id string, revisionId int64) (*models.PostStub, models.Notifier)
+}
+
+type BlogCommentService interface {
+	ListComments(ctx context.Context, postId string) (*models.CommentList, models.Notifier)
+	CreateComment(ctx context.Context, postId, parentId, content string) (*models.Comment, models.Notifier)
+	SetCommentStatus(ctx context.Context, postId, commentId, status string) (*models.Comment, models.Notifier)
+	DeleteComment(ctx context.Context, postId, commentId string) models.Notifier
 }
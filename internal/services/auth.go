@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"io"
 
 	"github.com/jhamill34/notion-provisioner/internal/models"
 )
@@ -36,27 +37,54 @@ type UserService interface {
 	ListUsers(ctx context.Context) ([]models.User, models.Notifier)
 	GetUser(ctx context.Context, id string) (*models.User, models.Notifier)
 	ListPolicies(ctx context.Context, id string) ([]models.Policy, models.Notifier)
-	CreatePolicy(ctx context.Context, id, resource, action, effect string) models.Notifier
+	CreatePolicy(ctx context.Context, id, resource, action, effect, condition string) models.Notifier
 	DeletePolicy(ctx context.Context, id string, policyId int) models.Notifier
+	ExplainPolicy(
+		ctx context.Context,
+		id, resource, action string,
+	) (*models.PolicyExplanation, models.Notifier)
 }
 
 type OrganizationService interface {
-	CreateOrganization(ctx context.Context, userId, name, description string) models.Notifier
+	CreateOrganization(ctx context.Context, userId, name, description string) (*models.Organization, models.Notifier)
 	GetOrganizationBydId(ctx context.Context, id string) (*models.Organization, models.Notifier)
+	UpdateOrganization(ctx context.Context, id, description string) models.Notifier
 	DeleteOrganization(ctx context.Context, id string) models.Notifier
+	ListOrganizations(ctx context.Context) ([]models.Organization, models.Notifier)
 
 	ListPolicies(ctx context.Context, id string) ([]models.Policy, models.Notifier)
-	CreatePolicy(ctx context.Context, orgId, resource, action, effect string) models.Notifier
+	CreatePolicy(ctx context.Context, orgId, resource, action, effect, condition string) models.Notifier
 	DeletePolicy(ctx context.Context, orgId string, policyId int) models.Notifier
 
 	ListUsers(ctx context.Context, orgId string) ([]models.User, models.Notifier)
 	InviteUser(ctx context.Context, orgId, email string) models.Notifier
+	AddUser(ctx context.Context, orgId, userId string) models.Notifier
 	Join(ctx context.Context, tokenId, token, userId string) models.Notifier
 	RemoveUser(ctx context.Context, orgId, userId string) models.Notifier
 
 	ListUsersOrgs(ctx context.Context, userId string) ([]models.Organization, models.Notifier)
 }
 
+type PolicySetService interface {
+	ListSets(ctx context.Context) ([]models.PolicySet, models.Notifier)
+	GetSet(ctx context.Context, id string) (*models.PolicySet, models.Notifier)
+	CreateSet(ctx context.Context, name, description string) (*models.PolicySet, models.Notifier)
+	DeleteSet(ctx context.Context, id string) models.Notifier
+
+	CreatePolicy(ctx context.Context, id, resource, action, effect, condition string) models.Notifier
+	DeletePolicy(ctx context.Context, id string, policyId int) models.Notifier
+
+	ListUsers(ctx context.Context, id string) ([]models.User, models.Notifier)
+	ListOrgs(ctx context.Context, id string) ([]models.Organization, models.Notifier)
+	AttachToUser(ctx context.Context, id, userId string) models.Notifier
+	DetachFromUser(ctx context.Context, id, userId string) models.Notifier
+	AttachToOrg(ctx context.Context, id, orgId string) models.Notifier
+	DetachFromOrg(ctx context.Context, id, orgId string) models.Notifier
+
+	Export(ctx context.Context, id string) ([]byte, models.Notifier)
+	Import(ctx context.Context, document []byte) (*models.PolicySet, models.Notifier)
+}
+
 type ApplicationService interface {
 	CreateApp(
 		ctx context.Context,
@@ -64,9 +92,11 @@ type ApplicationService interface {
 	) (*models.App, models.Notifier)
 	GetApp(ctx context.Context, id string) (*models.App, models.Notifier)
 	GetAppByClientId(ctx context.Context, clientId string) (*models.App, models.Notifier)
+	UpdateApp(ctx context.Context, id, redirectUri, name, description string) models.Notifier
 	DeleteApp(ctx context.Context, id string) models.Notifier
 	ListApps(ctx context.Context) ([]models.App, models.Notifier)
 	NewSecret(ctx context.Context, id string) (string, models.Notifier)
+	SetSecret(ctx context.Context, id, clientSecret string) models.Notifier
 	NewAuthCode(ctx context.Context, userId, clientId string) string
 	GetAuthCode(ctx context.Context, code string) (string, string, models.Notifier)
 	ValidateAppSecret(ctx context.Context, id, secret string) (*models.App, models.Notifier)
@@ -74,6 +104,12 @@ type ApplicationService interface {
 		ctx context.Context,
 		userId, clientId, refreshToken string,
 	) (*models.AccessTokenResponse, models.Notifier)
+	NewClientToken(
+		ctx context.Context,
+		clientId, clientSecret string,
+		scopes []string,
+	) (*models.AccessTokenResponse, models.Notifier)
+	UpdateScopes(ctx context.Context, id string, scopes []string) models.Notifier
 	VerifyAccessToken(ctx context.Context, accessToken string) bool
 	FindRefreshToken(ctx context.Context, refreshToken string) (string, string, models.Notifier)
 }
@@ -88,3 +124,42 @@ type TokenClaimsService interface {
 	CreateWithClaims(ctx context.Context, id string, data interface{}) string
 	Destroy(ctx context.Context, id string)
 }
+
+type AuditService interface {
+	Record(ctx context.Context, event models.AuditEvent)
+	List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, models.Notifier)
+	Export(ctx context.Context, filter models.AuditFilter, w io.Writer) models.Notifier
+}
+
+type WebhookService interface {
+	ListWebhooks(ctx context.Context) ([]models.Webhook, models.Notifier)
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, models.Notifier)
+	CreateWebhook(
+		ctx context.Context,
+		ownerType, ownerId, url string,
+		events []string,
+	) (*models.Webhook, string, models.Notifier)
+	DeleteWebhook(ctx context.Context, id string) models.Notifier
+
+	ListDeliveries(ctx context.Context, id string) ([]models.WebhookDelivery, models.Notifier)
+	ListDeadDeliveries(ctx context.Context) ([]models.WebhookDelivery, models.Notifier)
+	RetryDelivery(ctx context.Context, id string, deliveryId int64) models.Notifier
+}
+
+// ScimService provisions users and organizations for SCIM clients. Groups
+// in SCIM are organizations here.
+type ScimService interface {
+	ListUsers(ctx context.Context, query models.ScimQuery) (*models.ScimListResponse, models.Notifier)
+	GetUser(ctx context.Context, id string) (*models.ScimUser, models.Notifier)
+	CreateUser(ctx context.Context, user *models.ScimUser) (*models.ScimUser, models.Notifier)
+	ReplaceUser(ctx context.Context, id string, user *models.ScimUser) (*models.ScimUser, models.Notifier)
+	PatchUser(ctx context.Context, id string, operations []models.ScimPatchOperation) (*models.ScimUser, models.Notifier)
+	DeactivateUser(ctx context.Context, id string) models.Notifier
+
+	ListGroups(ctx context.Context, query models.ScimQuery) (*models.ScimListResponse, models.Notifier)
+	GetGroup(ctx context.Context, id string) (*models.ScimGroup, models.Notifier)
+	CreateGroup(ctx context.Context, group *models.ScimGroup) (*models.ScimGroup, models.Notifier)
+	ReplaceGroup(ctx context.Context, id string, group *models.ScimGroup) (*models.ScimGroup, models.Notifier)
+	PatchGroup(ctx context.Context, id string, operations []models.ScimPatchOperation) (*models.ScimGroup, models.Notifier)
+	DeleteGroup(ctx context.Context, id string) models.Notifier
+}
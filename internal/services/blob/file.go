@@ -0,0 +1,114 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jhamill34/notion-provisioner/internal/services"
+)
+
+// FileStore keeps blobs on the local filesystem, spread over directories
+// named after the first two characters of each key. It's also what an
+// S3 compatible store can be checked against without a bucket.
+type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) *FileStore {
+	return &FileStore{root: root}
+}
+
+// Put implements services.BlobStore. The blob is written next to where it
+// goes and renamed into place so readers never see half of it.
+func (self *FileStore) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := self.path(key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// Get implements services.BlobStore.
+func (self *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := self.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, services.BlobNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Exists implements services.BlobStore.
+func (self *FileStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := self.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// path only allows keys made of lower case hex so a key can't point
+// outside of the root.
+func (self *FileStore) path(key string) (string, error) {
+	if len(key) < 3 {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	for _, r := range key {
+		if !(r >= '0' && r <= '9') && !(r >= 'a' && r <= 'f') {
+			return "", fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+
+	return filepath.Join(self.root, key[:2], key), nil
+}
+
+// var _ services.BlobStore = (*FileStore)(nil)
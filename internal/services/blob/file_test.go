@@ -0,0 +1,159 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jhamill34/notion-provisioner/internal/services"
+)
+
+const TEST_KEY = "ab12cd34ef"
+
+func readBlob(t *testing.T, store *FileStore, key string) string {
+	t.Helper()
+
+	r, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestFileStoreRejectsKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "parent directory", key: "../" + TEST_KEY},
+		{name: "nested parent directory", key: "ab/../../" + TEST_KEY},
+		{name: "upper case", key: strings.ToUpper(TEST_KEY)},
+		{name: "not hex", key: "ab12cd34eg"},
+		{name: "too short", key: "ab"},
+		{name: "empty", key: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent := t.TempDir()
+			root := filepath.Join(parent, "root")
+			store := NewFileStore(root)
+			ctx := context.Background()
+
+			if err := store.Put(ctx, test.key, strings.NewReader("data")); err == nil {
+				t.Error("Put accepted the key")
+			}
+
+			if _, err := store.Get(ctx, test.key); err == nil || err == services.BlobNotFound {
+				t.Errorf("Get returned %v, want an invalid key error", err)
+			}
+
+			if _, err := store.Exists(ctx, test.key); err == nil {
+				t.Error("Exists accepted the key")
+			}
+
+			// Nothing should have been written, inside the root or out of it
+			entries, err := os.ReadDir(parent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("found %d entries after a rejected key", len(entries))
+			}
+		})
+	}
+}
+
+func TestFileStorePut(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "new key", writes: []string{"first"}, want: "first"},
+		{name: "existing key keeps the first blob", writes: []string{"first", "second"}, want: "first"},
+		{name: "empty blob", writes: []string{""}, want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			store := NewFileStore(root)
+			ctx := context.Background()
+
+			for _, write := range test.writes {
+				if err := store.Put(ctx, TEST_KEY, strings.NewReader(write)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := readBlob(t, store, TEST_KEY); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+
+			exists, err := store.Exists(ctx, TEST_KEY)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exists {
+				t.Error("Exists is false after Put")
+			}
+
+			// Only the blob is left behind, no temporary uploads
+			entries, err := os.ReadDir(filepath.Join(root, TEST_KEY[:2]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != TEST_KEY {
+				t.Errorf("got %v, want only %s", entries, TEST_KEY)
+			}
+		})
+	}
+}
+
+func TestFileStoreMissing(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(store *FileStore)
+	}{
+		{name: "empty store", setup: func(store *FileStore) {}},
+		{
+			name: "other key in the same directory",
+			setup: func(store *FileStore) {
+				if err := store.Put(context.Background(), "ab99", strings.NewReader("other")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewFileStore(t.TempDir())
+			ctx := context.Background()
+			test.setup(store)
+
+			if _, err := store.Get(ctx, TEST_KEY); err != services.BlobNotFound {
+				t.Errorf("Get returned %v, want services.BlobNotFound", err)
+			}
+
+			exists, err := store.Exists(ctx, TEST_KEY)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists {
+				t.Error("Exists is true for a missing key")
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package client_credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhamill34/notion-provisioner/internal/models"
+)
+
+// Refresh the token a little early so requests in flight don't race the
+// expiration.
+const EXPIRY_LEEWAY = 30 * time.Second
+
+// TokenSource fetches access tokens for the service itself using the
+// client credentials grant and reuses them until they are about to expire.
+type TokenSource struct {
+	httpClient   *http.Client
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	scopes       []string
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewTokenSource(
+	httpClient *http.Client,
+	tokenUrl string,
+	clientId string,
+	clientSecret string,
+	scopes ...string,
+) *TokenSource {
+	return &TokenSource{
+		httpClient:   httpClient,
+		tokenUrl:     tokenUrl,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+	}
+}
+
+func (self *TokenSource) Token(ctx context.Context) (string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.token != "" && time.Now().Before(self.expiresAt) {
+		return self.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", self.clientId)
+	form.Set("client_secret", self.clientSecret)
+	if len(self.scopes) > 0 {
+		form.Set("scope", strings.Join(self.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", self.tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := self.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("client credentials request failed with status %d", res.StatusCode)
+	}
+
+	var tokenResponse models.AccessTokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&tokenResponse); err != nil {
+		return "", err
+	}
+
+	self.token = tokenResponse.AccessToken
+	self.expiresAt = time.Now().Add(time.Duration(tokenResponse.Expires)*time.Second - EXPIRY_LEEWAY)
+
+	return self.token, nil
+}
@@ -0,0 +1,116 @@
+package diff
+
+import "strings"
+
+const (
+	Equal  = " "
+	Insert = "+"
+	Delete = "-"
+)
+
+// Past this many cells the LCS table is too big to be worth building and
+// the whole middle of the text is shown as replaced instead.
+const MAX_CELLS = 4_000_000
+
+type Line struct {
+	Op   string
+	Text string
+}
+
+// Lines is a line by line diff that turns from into to. It finds the
+// longest common subsequence of the lines that differ once any shared
+// prefix and suffix are set aside.
+func Lines(from, to string) []Line {
+	a := splitLines(from)
+	b := splitLines(to)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(a)+len(b))
+	for _, text := range a[:prefix] {
+		lines = append(lines, Line{Equal, text})
+	}
+
+	lines = append(lines, middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Equal, text})
+	}
+
+	return lines
+}
+
+func middle(a, b []string) []Line {
+	lines := make([]Line, 0, len(a)+len(b))
+
+	if len(a)*len(b) > MAX_CELLS {
+		for _, text := range a {
+			lines = append(lines, Line{Delete, text})
+		}
+		for _, text := range b {
+			lines = append(lines, Line{Insert, text})
+		}
+		return lines
+	}
+
+	// lengths[i][j] is the LCS length of a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, Line{Equal, a[i]})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			lines = append(lines, Line{Delete, a[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		lines = append(lines, Line{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, Line{Insert, b[j]})
+	}
+
+	return lines
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func numbered(prefix string, count int) string {
+	lines := make([]string, count)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s %d", prefix, i)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func ops(lines []Line) string {
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString(line.Op)
+	}
+
+	return out.String()
+}
+
+// sides rebuilds the text on either side of the diff.
+func sides(lines []Line) (string, string) {
+	from := make([]string, 0)
+	to := make([]string, 0)
+	for _, line := range lines {
+		if line.Op != Insert {
+			from = append(from, line.Text)
+		}
+		if line.Op != Delete {
+			to = append(to, line.Text)
+		}
+	}
+
+	return strings.Join(from, "\n"), strings.Join(to, "\n")
+}
+
+func TestLines(t *testing.T) {
+	// Too many differing lines to build the table for
+	big := int(MAX_CELLS/2000) + 1
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		ops  string
+	}{
+		{name: "both empty", from: "", to: "", ops: ""},
+		{name: "equal", from: "a\nb\nc", to: "a\nb\nc", ops: "   "},
+		{name: "trailing newline is ignored", from: "a\nb\n", to: "a\nb", ops: "  "},
+		{name: "windows line endings", from: "a\r\nb", to: "a\nb", ops: "  "},
+		{name: "everything inserted", from: "", to: "a\nb", ops: "++"},
+		{name: "everything deleted", from: "a\nb", to: "", ops: "--"},
+		{name: "insert in the middle", from: "a\nc", to: "a\nb\nc", ops: " + "},
+		{name: "delete at the end", from: "a\nb\nc", to: "a\nb", ops: "  -"},
+		{name: "change in the middle", from: "a\nb\nc", to: "a\nx\nc", ops: " -+ "},
+		{
+			name: "common lines between changes are kept",
+			from: "a\nb\nshared\nc\nd",
+			to:   "a\nx\nshared\ny\nd",
+			ops:  " -+ -+ ",
+		},
+		{
+			name: "over the cell limit is replaced whole",
+			from: "start\n" + numbered("old", big) + "\nend",
+			to:   "start\n" + numbered("new", 2000) + "\nend",
+			ops:  " " + strings.Repeat(Delete, big) + strings.Repeat(Insert, 2000) + " ",
+		},
+		{
+			name: "over the cell limit keeps the shared prefix and suffix",
+			from: numbered("same", 3) + "\n" + numbered("old", big),
+			to:   numbered("same", 3) + "\n" + numbered("new", 2000),
+			ops:  "   " + strings.Repeat(Delete, big) + strings.Repeat(Insert, 2000),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := Lines(test.from, test.to)
+
+			if got := ops(lines); got != test.ops {
+				if len(got) > 40 {
+					t.Fatalf("got %d lines, want %d", len(got), len(test.ops))
+				}
+				t.Fatalf("got ops %q, want %q", got, test.ops)
+			}
+
+			from, to := sides(lines)
+			wantFrom := strings.TrimSuffix(strings.ReplaceAll(test.from, "\r\n", "\n"), "\n")
+			wantTo := strings.TrimSuffix(strings.ReplaceAll(test.to, "\r\n", "\n"), "\n")
+			if from != wantFrom || to != wantTo {
+				t.Errorf("the diff doesn't rebuild both sides")
+			}
+		})
+	}
+}
@@ -18,3 +18,9 @@ type EmailAuthHandler interface {
 	Authenticate(ctx context.Context, username, password string) bool
 }
 
+
+// UserDirectory finds where to reach a user, services other than the auth
+// server only know users by id.
+type UserDirectory interface {
+	GetEmail(ctx context.Context, id string) (string, error)
+}
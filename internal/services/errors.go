@@ -25,6 +25,7 @@ var PasswordMismatch *AuthServiceError = NewAuthServiceError("Password mismatch"
 var EmailAlreadyInUse *AuthServiceError = NewAuthServiceError("Email already in use")
 var AccountAlreadyVerified *AuthServiceError = NewAuthServiceError("Account already verified")
 var AccountNotFound *AuthServiceError = NewAuthServiceError("Account not found")
+var AccountDisabled *AuthServiceError = NewAuthServiceError("Account is disabled")
 
 //==================================================
 
@@ -42,6 +43,25 @@ func NewPostServiceError(message string) *UserServiceError {
 
 var PostNotFound *UserServiceError = NewUserServiceError("Post not found")
 var InvalidMimeType *UserServiceError = NewUserServiceError("Invalid mime type")
+var InvalidPostStatus *UserServiceError = NewPostServiceError("Invalid post status")
+var InvalidPreviewToken *UserServiceError = NewPostServiceError("Preview link is invalid or has expired")
+var RevisionNotFound *UserServiceError = NewPostServiceError("Revision not found")
+var InvalidCursor *UserServiceError = NewPostServiceError("Invalid page cursor")
+var EmptySearchQuery *UserServiceError = NewPostServiceError("Enter something to search for")
+var TagNotFound *UserServiceError = NewPostServiceError("Tag not found")
+var InvalidTag *UserServiceError = NewPostServiceError("Tags need a letter or number and can't be longer than 64 characters")
+var TooManyTags *UserServiceError = NewPostServiceError("Too many tags")
+var InvalidSlug *UserServiceError = NewPostServiceError("Slugs need a letter or number and can't be a reserved word")
+var SlugInUse *UserServiceError = NewPostServiceError("Another post already uses that slug")
+var CommentNotFound *UserServiceError = NewPostServiceError("Comment not found")
+var EmptyComment *UserServiceError = NewPostServiceError("Comments can't be empty")
+var CommentTooLong *UserServiceError = NewPostServiceError("Comments can't be longer than 5000 characters")
+var InvalidCommentParent *UserServiceError = NewPostServiceError("Replies can only be made to approved top level comments")
+var InvalidCommentStatus *UserServiceError = NewPostServiceError("Invalid comment status")
+var MediaNotFound *UserServiceError = NewPostServiceError("Media not found")
+var InvalidMedia *UserServiceError = NewPostServiceError("Uploads need to be a PNG, JPEG or GIF image")
+var MediaTooLarge *UserServiceError = NewPostServiceError("Uploads can't be larger than 16MB")
+var ImageTooLarge *UserServiceError = NewPostServiceError("Images can't be more than 40 megapixels")
 
 //==================================================
 
@@ -76,6 +96,9 @@ func NewAppServiceError(message string) *AppServiceError {
 var AppNotFound *AppServiceError = NewAppServiceError("User not found")
 var InvalidAuthCode *AppServiceError = NewAppServiceError("Invalid auth code")
 var InvalidRefreshToken *AppServiceError = NewAppServiceError("Invalid refresh token")
+var InvalidClientCredentials *AppServiceError = NewAppServiceError("Invalid client credentials")
+var UnknownScope *AppServiceError = NewAppServiceError("Unknown scope")
+var ScopeNotGranted *AppServiceError = NewAppServiceError("Scope has not been granted to this app")
 
 //==================================================
 
@@ -142,4 +165,90 @@ func NewOrganizationServiceError(message string) *OrganizationServiceError {
 }
 
 var OrganizationNotFound *OrganizationServiceError = NewOrganizationServiceError("Organization not found")
+var OrganizationNameInUse *OrganizationServiceError = NewOrganizationServiceError("Organization name already in use")
 
+
+//==================================================
+
+type PolicySetServiceError struct {
+	Message string
+}
+
+func (self *PolicySetServiceError) Notify() *models.Notification {
+	return &models.Notification{Message: self.Message}
+}
+
+func NewPolicySetServiceError(message string) *PolicySetServiceError {
+	return &PolicySetServiceError{Message: message}
+}
+
+var PolicySetNotFound *PolicySetServiceError = NewPolicySetServiceError("Policy set not found")
+var PolicySetNameInUse *PolicySetServiceError = NewPolicySetServiceError("Policy set name already in use")
+var PolicySetAlreadyAttached *PolicySetServiceError = NewPolicySetServiceError("Policy set is already attached")
+var InvalidPolicySetDocument *PolicySetServiceError = NewPolicySetServiceError("Invalid policy set document")
+
+//==================================================
+
+type PolicyValidationError struct {
+	Message string
+}
+
+func (self *PolicyValidationError) Notify() *models.Notification {
+	return &models.Notification{Message: self.Message}
+}
+
+func NewPolicyValidationError(message string) *PolicyValidationError {
+	return &PolicyValidationError{Message: message}
+}
+
+var InvalidPolicyEffect *PolicyValidationError = NewPolicyValidationError("Effect must be either allow or deny")
+var UnknownPolicyResource *PolicyValidationError = NewPolicyValidationError("Resource does not match any known resource")
+
+//==================================================
+
+type WebhookServiceError struct {
+	Message string
+}
+
+func (self *WebhookServiceError) Notify() *models.Notification {
+	return &models.Notification{Message: self.Message}
+}
+
+func NewWebhookServiceError(message string) *WebhookServiceError {
+	return &WebhookServiceError{Message: message}
+}
+
+var WebhookNotFound *WebhookServiceError = NewWebhookServiceError("Webhook not found")
+var DeliveryNotFound *WebhookServiceError = NewWebhookServiceError("Delivery not found or not in the dead letter list")
+var InvalidWebhookUrl *WebhookServiceError = NewWebhookServiceError("Webhook URL must be an absolute http or https URL")
+var PrivateWebhookUrl *WebhookServiceError = NewWebhookServiceError("Webhook URL must point to a public address")
+var InvalidWebhookOwner *WebhookServiceError = NewWebhookServiceError("Webhooks belong to either an application or an organization")
+var UnknownWebhookEvent *WebhookServiceError = NewWebhookServiceError("Unknown webhook event")
+var NoWebhookEvents *WebhookServiceError = NewWebhookServiceError("Select at least one event")
+
+//==================================================
+
+// ScimServiceError carries the HTTP status and scimType a SCIM client
+// expects alongside the message.
+type ScimServiceError struct {
+	Status   int
+	ScimType string
+	Message  string
+}
+
+func (self *ScimServiceError) Notify() *models.Notification {
+	return &models.Notification{Message: self.Message}
+}
+
+func NewScimServiceError(status int, scimType, message string) *ScimServiceError {
+	return &ScimServiceError{Status: status, ScimType: scimType, Message: message}
+}
+
+var ScimUserNotFound *ScimServiceError = NewScimServiceError(404, "", "User not found")
+var ScimGroupNotFound *ScimServiceError = NewScimServiceError(404, "", "Group not found")
+var ScimUserExists *ScimServiceError = NewScimServiceError(409, "uniqueness", "A user with that userName or email already exists")
+var ScimGroupExists *ScimServiceError = NewScimServiceError(409, "uniqueness", "A group with that displayName already exists")
+var ScimEmailRequired *ScimServiceError = NewScimServiceError(400, "invalidValue", "Users need an email address")
+var ScimUserNameRequired *ScimServiceError = NewScimServiceError(400, "invalidValue", "userName is required")
+var ScimDisplayNameRequired *ScimServiceError = NewScimServiceError(400, "invalidValue", "displayName is required")
+var ScimRootImmutable *ScimServiceError = NewScimServiceError(400, "mutability", "The root user can't be changed through SCIM")
@@ -0,0 +1,183 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// Feed is what the RSS and Atom documents are written from. Links are
+// absolute, Url is where the feed itself is served.
+type Feed struct {
+	Title       string
+	Description string
+	Link        string
+	Url         string
+	Updated     time.Time
+	Entries     []Entry
+}
+
+// Entry is a post in the feed, Content is HTML. Id should never change
+// for the post, even when its link does. Author is left out when empty.
+type Entry struct {
+	Id         string
+	Title      string
+	Link       string
+	Author     string
+	Published  time.Time
+	Updated    time.Time
+	Categories []string
+	Content    string
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        rssGuid  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// WriteRss writes the feed as RSS 2.0.
+func WriteRss(w io.Writer, feed *Feed) error {
+	items := make([]rssItem, len(feed.Entries))
+	for i, entry := range feed.Entries {
+		items[i] = rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			Guid:        rssGuid{Value: entry.Id},
+			PubDate:     entry.Published.UTC().Format(time.RFC1123Z),
+			Categories:  entry.Categories,
+			Description: entry.Content,
+		}
+	}
+
+	return write(w, rssDocument{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         feed.Title,
+			Link:          feed.Link,
+			Description:   feed.Description,
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+			Self:          atomLink{Href: feed.Url, Rel: "self", Type: "application/rss+xml"},
+			Items:         items,
+		},
+	})
+}
+
+type atomDocument struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Author     *atomAuthor    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteAtom writes the feed as Atom 1.0.
+func WriteAtom(w io.Writer, feed *Feed) error {
+	entries := make([]atomEntry, len(feed.Entries))
+	for i, entry := range feed.Entries {
+		categories := make([]atomCategory, len(entry.Categories))
+		for j, category := range entry.Categories {
+			categories[j] = atomCategory{Term: category}
+		}
+
+		var author *atomAuthor
+		if entry.Author != "" {
+			author = &atomAuthor{Name: entry.Author}
+		}
+
+		entries[i] = atomEntry{
+			Id:         entry.Id,
+			Title:      entry.Title,
+			Published:  entry.Published.UTC().Format(time.RFC3339),
+			Updated:    entry.Updated.UTC().Format(time.RFC3339),
+			Link:       atomLink{Href: entry.Link, Rel: "alternate", Type: "text/html"},
+			Author:     author,
+			Categories: categories,
+			Content:    atomContent{Type: "html", Value: entry.Content},
+		}
+	}
+
+	return write(w, atomDocument{
+		Id:       feed.Url,
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		Updated:  feed.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: feed.Url, Rel: "self", Type: "application/atom+xml"},
+			{Href: feed.Link, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: entries,
+	})
+}
+
+func write(w io.Writer, document interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
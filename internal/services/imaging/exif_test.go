@@ -0,0 +1,153 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+// lettered draws rows of letters, one pixel each, so where a pixel ends
+// up can be read back with letters.
+func lettered(rows ...string) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, letter := range []byte(row) {
+			img.SetNRGBA(x, y, color.NRGBA{R: letter, A: 255})
+		}
+	}
+
+	return img
+}
+
+func letters(img image.Image) string {
+	bounds := img.Bounds()
+	rows := make([]string, 0, bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := make([]byte, 0, bounds.Dx())
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			row = append(row, byte(r>>8))
+		}
+		rows = append(rows, string(row))
+	}
+
+	return strings.Join(rows, "/")
+}
+
+func encodeJpeg(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+// withExif puts an APP1 segment holding just the orientation right after
+// the JPEG's start of image marker.
+func withExif(jpegData []byte, order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], ORIENTATION_TAG)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	app1 := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	data := append([]byte{}, jpegData[:2]...)
+	data = append(data, app1...)
+	return append(data, jpegData[2:]...)
+}
+
+func TestReadOrientation(t *testing.T) {
+	plain := encodeJpeg(t, lettered("ab"))
+
+	type test struct {
+		name string
+		data []byte
+		want int
+	}
+
+	tests := []test{
+		{name: "no exif", data: plain, want: 1},
+		{name: "not a jpeg", data: []byte("\x89PNG\r\n\x1a\n"), want: 1},
+		{name: "empty", data: []byte{}, want: 1},
+		{name: "out of range", data: withExif(plain, binary.BigEndian, 9), want: 1},
+		{name: "zero", data: withExif(plain, binary.LittleEndian, 0), want: 1},
+		{
+			name: "segment cut short",
+			data: withExif(plain, binary.BigEndian, 6)[:20],
+			want: 1,
+		},
+	}
+
+	for orientation := 1; orientation <= 8; orientation++ {
+		tests = append(
+			tests,
+			test{
+				name: "little endian " + string(rune('0'+orientation)),
+				data: withExif(plain, binary.LittleEndian, uint16(orientation)),
+				want: orientation,
+			},
+			test{
+				name: "big endian " + string(rune('0'+orientation)),
+				data: withExif(plain, binary.BigEndian, uint16(orientation)),
+				want: orientation,
+			},
+		)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ReadOrientation(bytes.NewReader(test.data)); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	src := lettered("abc", "def")
+
+	tests := []struct {
+		orientation int
+		want        string
+	}{
+		{orientation: 0, want: "abc/def"},
+		{orientation: 1, want: "abc/def"},
+		{orientation: 2, want: "cba/fed"},
+		{orientation: 3, want: "fed/cba"},
+		{orientation: 4, want: "def/abc"},
+		{orientation: 5, want: "ad/be/cf"},
+		{orientation: 6, want: "da/eb/fc"},
+		{orientation: 7, want: "fc/eb/da"},
+		{orientation: 8, want: "cf/be/ad"},
+		{orientation: 9, want: "abc/def"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(rune('0'+test.orientation)), func(t *testing.T) {
+			if got := letters(Orient(src, test.orientation)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
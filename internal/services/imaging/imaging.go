@@ -0,0 +1,127 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+)
+
+var Unsupported = errors.New("unsupported image format")
+var TooManyPixels = errors.New("image has too many pixels")
+var Invalid = errors.New("invalid image")
+
+// FORMATS maps the mime types that can be decoded to the format name
+// image.DecodeConfig gives them.
+var FORMATS = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/gif":  "gif",
+}
+
+const JPEG_QUALITY = 90
+
+// Sniff finds the mime type of an image from its first 512 bytes, it's
+// only ever one of FORMATS.
+func Sniff(header []byte) (string, bool) {
+	mimeType := http.DetectContentType(header)
+	_, ok := FORMATS[mimeType]
+
+	return mimeType, ok
+}
+
+// Decode reads the image in r, whatever it claims to be. The size is
+// checked before any pixels are decoded so a small file can't expand into
+// more than maxPixels. JPEGs are turned the way their EXIF orientation
+// says, GIFs are decoded to their first frame.
+func Decode(r io.ReadSeeker, maxPixels int) (image.Image, string, error) {
+	header := make([]byte, 512)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, "", Invalid
+	}
+
+	mimeType, ok := Sniff(header[:n])
+	if !ok {
+		return nil, "", Unsupported
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	config, format, err := image.DecodeConfig(r)
+	if err != nil || format != FORMATS[mimeType] {
+		return nil, "", Invalid
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, "", Invalid
+	}
+
+	if config.Width > maxPixels/config.Height {
+		return nil, "", TooManyPixels
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	var img image.Image
+	switch mimeType {
+	case "image/png":
+		img, err = png.Decode(r)
+	case "image/jpeg":
+		img, err = jpeg.Decode(r)
+	case "image/gif":
+		img, err = gif.Decode(r)
+	}
+
+	if err != nil {
+		return nil, "", Invalid
+	}
+
+	if mimeType == "image/jpeg" {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, "", err
+		}
+
+		img = Orient(img, ReadOrientation(r))
+	}
+
+	return img, mimeType, nil
+}
+
+// Resize scales the image down to width, keeping its aspect ratio.
+func Resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Rect, src, bounds, draw.Over, nil)
+
+	return dst
+}
+
+// Encode writes the image as mimeType. Only the pixels are written so
+// nothing else from the original file, like EXIF, is kept.
+func Encode(w io.Writer, img image.Image, mimeType string) error {
+	switch mimeType {
+	case "image/png":
+		return png.Encode(w, img)
+	case "image/jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: JPEG_QUALITY})
+	case "image/gif":
+		return gif.Encode(w, img, nil)
+	}
+
+	return Unsupported
+}
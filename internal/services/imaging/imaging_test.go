@@ -0,0 +1,168 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func solid(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	return img
+}
+
+func encodePng(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func encodeGif(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := gif.Encode(&buffer, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+// withPngSize rewrites the size in the PNG's header, and its checksum, so
+// it claims to be bigger than its pixels.
+func withPngSize(data []byte, width, height uint32) []byte {
+	data = append([]byte{}, data...)
+
+	// 8 byte signature, then the IHDR chunk's length and type
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	jpegData := encodeJpeg(t, solid(64, 64))
+
+	tests := []struct {
+		name      string
+		data      []byte
+		maxPixels int
+		mimeType  string
+		width     int
+		height    int
+		err       error
+	}{
+		{
+			name:      "png",
+			data:      encodePng(t, solid(4, 3)),
+			maxPixels: 100,
+			mimeType:  "image/png",
+			width:     4,
+			height:    3,
+		},
+		{
+			name:      "jpeg",
+			data:      jpegData,
+			maxPixels: 64 * 64,
+			mimeType:  "image/jpeg",
+			width:     64,
+			height:    64,
+		},
+		{
+			name:      "gif",
+			data:      encodeGif(t, solid(5, 2)),
+			maxPixels: 100,
+			mimeType:  "image/gif",
+			width:     5,
+			height:    2,
+		},
+		{
+			name:      "jpeg is turned upright",
+			data:      withExif(encodeJpeg(t, solid(8, 2)), binary.BigEndian, 6),
+			maxPixels: 100,
+			mimeType:  "image/jpeg",
+			width:     2,
+			height:    8,
+		},
+		{
+			name:      "one pixel over the limit",
+			data:      encodePng(t, solid(4, 3)),
+			maxPixels: 11,
+			err:       TooManyPixels,
+		},
+		{
+			name:      "header claims too many pixels",
+			data:      withPngSize(encodePng(t, solid(1, 1)), 1<<20, 1<<20),
+			maxPixels: 100_000_000,
+			err:       TooManyPixels,
+		},
+		{
+			name:      "header claims no pixels",
+			data:      withPngSize(encodePng(t, solid(1, 1)), 0, 1),
+			maxPixels: 100,
+			err:       Invalid,
+		},
+		{
+			name:      "truncated jpeg",
+			data:      jpegData[:len(jpegData)/2],
+			maxPixels: 64 * 64,
+			err:       Invalid,
+		},
+		{
+			name:      "truncated header",
+			data:      jpegData[:8],
+			maxPixels: 64 * 64,
+			err:       Invalid,
+		},
+		{
+			name:      "empty",
+			data:      []byte{},
+			maxPixels: 100,
+			err:       Invalid,
+		},
+		{
+			name:      "not an image",
+			data:      []byte("just some text"),
+			maxPixels: 100,
+			err:       Unsupported,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, mimeType, err := Decode(bytes.NewReader(test.data), test.maxPixels)
+			if err != test.err {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if test.err != nil {
+				return
+			}
+
+			if mimeType != test.mimeType {
+				t.Errorf("got %s, want %s", mimeType, test.mimeType)
+			}
+
+			if img.Bounds().Dx() != test.width || img.Bounds().Dy() != test.height {
+				t.Errorf("got %v, want %dx%d", img.Bounds().Size(), test.width, test.height)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/jhamill34/notion-provisioner/internal/models"
+)
+
+var BlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps the bytes of uploaded media. Keys are the hash of what's
+// stored under them so a key never has to be overwritten, Put can do
+// nothing when the key is already there.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Get returns BlobNotFound when nothing is stored under the key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+type MediaService interface {
+	// UploadPostMedia finds the type of the upload from its content.
+	UploadPostMedia(ctx context.Context, postId string, r io.Reader, cover bool) (*models.Media, models.Notifier)
+	ListPostMedia(ctx context.Context, postId string) ([]models.Media, models.Notifier)
+	RemovePostMedia(ctx context.Context, postId, mediaId string) models.Notifier
+	OpenMedia(ctx context.Context, id string) (*models.Media, io.ReadCloser, models.Notifier)
+}
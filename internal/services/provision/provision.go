@@ -0,0 +1,792 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jhamill34/notion-provisioner/internal/config"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+)
+
+const (
+	ActionCreate = "+"
+	ActionUpdate = "~"
+	ActionDelete = "-"
+)
+
+// Change is a single object that needs to be created, updated or deleted
+// to make the database match the spec. Details describe what the change
+// does to the object and are only used for display.
+type Change struct {
+	Action   string
+	Resource string
+	Details  []string
+
+	apply func(ctx context.Context) models.Notifier
+}
+
+type Plan struct {
+	Changes []Change
+}
+
+// Empty is true when the database already matches the spec.
+func (self *Plan) Empty() bool {
+	return len(self.Changes) == 0
+}
+
+// Write prints the plan as a diff followed by a summary.
+func (self *Plan) Write(w io.Writer) {
+	counts := map[string]int{}
+	for _, change := range self.Changes {
+		counts[change.Action]++
+
+		fmt.Fprintf(w, "%s %s\n", change.Action, change.Resource)
+		for _, detail := range change.Details {
+			fmt.Fprintf(w, "    %s\n", detail)
+		}
+	}
+
+	if self.Empty() {
+		fmt.Fprintln(w, "No changes. The database matches the spec.")
+		return
+	}
+
+	fmt.Fprintf(
+		w,
+		"\nPlan: %d to add, %d to change, %d to destroy.\n",
+		counts[ActionCreate],
+		counts[ActionUpdate],
+		counts[ActionDelete],
+	)
+}
+
+// Provisioner reconciles a config.ProvisionSpec against the auth database.
+// Everything goes through the service layer so the context it's given
+// needs a "user_id" that's allowed to manage users, orgs and apps.
+type Provisioner struct {
+	authService     services.AuthService
+	userService     services.UserService
+	orgService      services.OrganizationService
+	appService      services.ApplicationService
+	policyValidator services.PolicyValidator
+}
+
+func NewProvisioner(
+	authService services.AuthService,
+	userService services.UserService,
+	orgService services.OrganizationService,
+	appService services.ApplicationService,
+	policyValidator services.PolicyValidator,
+) *Provisioner {
+	return &Provisioner{
+		authService:     authService,
+		userService:     userService,
+		orgService:      orgService,
+		appService:      appService,
+		policyValidator: policyValidator,
+	}
+}
+
+// Plan works out the changes needed to make the database match the spec.
+// Nothing is deleted unless prune is set, in which case organizations and
+// apps missing from the spec are removed along with any members and
+// policies the spec doesn't list. Users are never deleted.
+func (self *Provisioner) Plan(
+	ctx context.Context,
+	spec config.ProvisionSpec,
+	prune bool,
+) (*Plan, error) {
+	if err := self.validate(spec); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+
+	users, err := self.planUsers(ctx, spec.Users, prune)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, users...)
+
+	orgs, err := self.planOrganizations(ctx, spec, prune)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, orgs...)
+
+	apps, err := self.planApps(ctx, spec.Apps, prune)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes = append(plan.Changes, apps...)
+
+	return plan, nil
+}
+
+// Apply makes the changes in the plan, stopping at the first one that fails.
+func (self *Provisioner) Apply(ctx context.Context, plan *Plan) error {
+	for _, change := range plan.Changes {
+		if err := change.apply(ctx); err != nil {
+			return fmt.Errorf("%s %s: %s", change.Action, change.Resource, err.Notify().Message)
+		}
+	}
+
+	return nil
+}
+
+func (self *Provisioner) validate(spec config.ProvisionSpec) error {
+	emails := map[string]bool{}
+	for _, user := range spec.Users {
+		email := user.Email.String()
+		if email == "" {
+			return fmt.Errorf("user %q: email is required", user.Username)
+		}
+		if emails[email] {
+			return fmt.Errorf("user %q is listed more than once", email)
+		}
+		emails[email] = true
+
+		for _, policy := range user.Policies {
+			if err := self.validatePolicy(policy); err != nil {
+				return fmt.Errorf("user %q: %s", email, err)
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	for _, org := range spec.Organizations {
+		if org.Name == "" {
+			return fmt.Errorf("organization name is required")
+		}
+		if names[org.Name] {
+			return fmt.Errorf("organization %q is listed more than once", org.Name)
+		}
+		names[org.Name] = true
+
+		for _, policy := range org.Policies {
+			if err := self.validatePolicy(policy); err != nil {
+				return fmt.Errorf("organization %q: %s", org.Name, err)
+			}
+		}
+	}
+
+	clientIds := map[string]bool{}
+	for _, app := range spec.Apps {
+		clientId := app.ClientId.String()
+		if clientId == "" || app.ClientSecret.String() == "" {
+			return fmt.Errorf("app %q: client_id and client_secret are required", app.Name)
+		}
+		if clientIds[clientId] {
+			return fmt.Errorf("app %q is listed more than once", clientId)
+		}
+		clientIds[clientId] = true
+	}
+
+	return nil
+}
+
+func (self *Provisioner) validatePolicy(policy config.PolicySpec) error {
+	err := self.policyValidator.Validate(
+		policy.Resource,
+		policy.Action,
+		effect(policy),
+		policy.Condition,
+	)
+	if err != nil {
+		return fmt.Errorf("policy %s: %s", describePolicy(policy), err.Notify().Message)
+	}
+
+	return nil
+}
+
+//==============================================================================
+// Users
+//==============================================================================
+
+func (self *Provisioner) planUsers(
+	ctx context.Context,
+	specs []config.UserSpec,
+	prune bool,
+) ([]Change, error) {
+	changes := make([]Change, 0)
+
+	for _, spec := range specs {
+		spec := spec
+		email := spec.Email.String()
+		resource := fmt.Sprintf("user %q", email)
+
+		user, err := self.authService.GetUserByEmail(ctx, email)
+		if err == services.AccountNotFound {
+			if spec.Username == "" || spec.Password == nil || spec.Password.String() == "" {
+				return nil, fmt.Errorf("%s: username and password are required to create a user", resource)
+			}
+
+			details := []string{"username: " + spec.Username}
+			for _, policy := range spec.Policies {
+				details = append(details, "+ policy "+describePolicy(policy))
+			}
+
+			changes = append(changes, Change{
+				Action:   ActionCreate,
+				Resource: resource,
+				Details:  details,
+				apply: func(ctx context.Context) models.Notifier {
+					err := self.authService.CreateUser(ctx, spec.Username, email, spec.Password.String(), true)
+					if err != nil {
+						return err
+					}
+
+					user, err := self.authService.GetUserByEmail(ctx, email)
+					if err != nil {
+						return err
+					}
+
+					for _, policy := range spec.Policies {
+						err := self.userService.CreatePolicy(
+							ctx,
+							user.UserId,
+							policy.Resource,
+							policy.Action,
+							effect(policy),
+							policy.Condition,
+						)
+						if err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			})
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", resource, err.Notify().Message)
+		}
+
+		current, err := self.userService.ListPolicies(ctx, user.UserId)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", resource, err.Notify().Message)
+		}
+
+		missing, extra := diffPolicies(spec.Policies, current)
+		if !prune {
+			extra = nil
+		}
+
+		if len(missing) == 0 && len(extra) == 0 {
+			continue
+		}
+
+		userId := user.UserId
+		changes = append(changes, Change{
+			Action:   ActionUpdate,
+			Resource: resource,
+			Details:  policyDetails(missing, extra),
+			apply: func(ctx context.Context) models.Notifier {
+				for _, policy := range missing {
+					err := self.userService.CreatePolicy(
+						ctx,
+						userId,
+						policy.Resource,
+						policy.Action,
+						effect(policy),
+						policy.Condition,
+					)
+					if err != nil {
+						return err
+					}
+				}
+
+				for _, policy := range extra {
+					if err := self.userService.DeletePolicy(ctx, userId, policy.PolicyId); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			},
+		})
+	}
+
+	return changes, nil
+}
+
+//==============================================================================
+// Organizations
+//==============================================================================
+
+func (self *Provisioner) planOrganizations(
+	ctx context.Context,
+	spec config.ProvisionSpec,
+	prune bool,
+) ([]Change, error) {
+	actorId, _ := ctx.Value("user_id").(string)
+
+	// Members can be existing users or users created earlier in the plan.
+	planned := map[string]bool{}
+	for _, user := range spec.Users {
+		planned[user.Email.String()] = true
+	}
+
+	current, err := self.orgService.ListOrganizations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing organizations: %s", err.Notify().Message)
+	}
+
+	existing := make(map[string]models.Organization, len(current))
+	for _, org := range current {
+		existing[org.Name] = org
+	}
+
+	changes := make([]Change, 0)
+	for _, orgSpec := range spec.Organizations {
+		orgSpec := orgSpec
+		resource := fmt.Sprintf("organization %q", orgSpec.Name)
+
+		emails := make([]string, len(orgSpec.Members))
+		for i, member := range orgSpec.Members {
+			emails[i] = member.String()
+		}
+
+		for _, email := range emails {
+			if planned[email] {
+				continue
+			}
+
+			if _, err := self.authService.GetUserByEmail(ctx, email); err != nil {
+				return nil, fmt.Errorf("%s: member %q: %s", resource, email, err.Notify().Message)
+			}
+		}
+
+		org, ok := existing[orgSpec.Name]
+		if !ok {
+			details := []string{"description: " + orgSpec.Description}
+			for _, email := range emails {
+				details = append(details, "+ member "+email)
+			}
+			for _, policy := range orgSpec.Policies {
+				details = append(details, "+ policy "+describePolicy(policy))
+			}
+
+			changes = append(changes, Change{
+				Action:   ActionCreate,
+				Resource: resource,
+				Details:  details,
+				apply: func(ctx context.Context) models.Notifier {
+					org, err := self.orgService.CreateOrganization(ctx, actorId, orgSpec.Name, orgSpec.Description)
+					if err != nil {
+						return err
+					}
+
+					if err := self.addMembers(ctx, org.OrgId, emails); err != nil {
+						return err
+					}
+
+					return self.createOrgPolicies(ctx, org.OrgId, orgSpec.Policies)
+				},
+			})
+			continue
+		}
+
+		delete(existing, orgSpec.Name)
+
+		users, err := self.orgService.ListUsers(ctx, org.OrgId)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", resource, err.Notify().Message)
+		}
+
+		members := make(map[string]string, len(users))
+		for _, user := range users {
+			members[user.Email] = user.UserId
+		}
+
+		details := make([]string, 0)
+		if org.Description != orgSpec.Description {
+			details = append(details, fmt.Sprintf("description: %q -> %q", org.Description, orgSpec.Description))
+		}
+
+		addMembers := make([]string, 0)
+		for _, email := range emails {
+			if _, ok := members[email]; ok {
+				delete(members, email)
+				continue
+			}
+
+			addMembers = append(addMembers, email)
+			details = append(details, "+ member "+email)
+		}
+
+		removeMembers := make([]string, 0)
+		if prune {
+			stale := make([]string, 0, len(members))
+			for email, userId := range members {
+				// Whoever is provisioning is added to every org they create.
+				if userId != actorId {
+					stale = append(stale, email)
+				}
+			}
+			sort.Strings(stale)
+
+			for _, email := range stale {
+				removeMembers = append(removeMembers, members[email])
+				details = append(details, "- member "+email)
+			}
+		}
+
+		policies, err := self.orgService.ListPolicies(ctx, org.OrgId)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", resource, err.Notify().Message)
+		}
+
+		missing, extra := diffPolicies(orgSpec.Policies, policies)
+		if !prune {
+			extra = nil
+		}
+		details = append(details, policyDetails(missing, extra)...)
+
+		if len(details) == 0 {
+			continue
+		}
+
+		orgId := org.OrgId
+		updateDescription := org.Description != orgSpec.Description
+		changes = append(changes, Change{
+			Action:   ActionUpdate,
+			Resource: resource,
+			Details:  details,
+			apply: func(ctx context.Context) models.Notifier {
+				if updateDescription {
+					if err := self.orgService.UpdateOrganization(ctx, orgId, orgSpec.Description); err != nil {
+						return err
+					}
+				}
+
+				if err := self.addMembers(ctx, orgId, addMembers); err != nil {
+					return err
+				}
+
+				for _, userId := range removeMembers {
+					if err := self.orgService.RemoveUser(ctx, orgId, userId); err != nil {
+						return err
+					}
+				}
+
+				if err := self.createOrgPolicies(ctx, orgId, missing); err != nil {
+					return err
+				}
+
+				for _, policy := range extra {
+					if err := self.orgService.DeletePolicy(ctx, orgId, policy.PolicyId); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			},
+		})
+	}
+
+	if prune {
+		for _, org := range current {
+			if _, ok := existing[org.Name]; !ok {
+				continue
+			}
+
+			orgId := org.OrgId
+			changes = append(changes, Change{
+				Action:   ActionDelete,
+				Resource: fmt.Sprintf("organization %q", org.Name),
+				apply: func(ctx context.Context) models.Notifier {
+					return self.orgService.DeleteOrganization(ctx, orgId)
+				},
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+func (self *Provisioner) addMembers(ctx context.Context, orgId string, emails []string) models.Notifier {
+	for _, email := range emails {
+		user, err := self.authService.GetUserByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		if err := self.orgService.AddUser(ctx, orgId, user.UserId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (self *Provisioner) createOrgPolicies(
+	ctx context.Context,
+	orgId string,
+	policies []config.PolicySpec,
+) models.Notifier {
+	for _, policy := range policies {
+		err := self.orgService.CreatePolicy(
+			ctx,
+			orgId,
+			policy.Resource,
+			policy.Action,
+			effect(policy),
+			policy.Condition,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//==============================================================================
+// Applications
+//==============================================================================
+
+func (self *Provisioner) planApps(
+	ctx context.Context,
+	specs []config.App,
+	prune bool,
+) ([]Change, error) {
+	current, err := self.appService.ListApps(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing apps: %s", err.Notify().Message)
+	}
+
+	existing := make(map[string]models.App, len(current))
+	for _, app := range current {
+		existing[app.ClientId] = app
+	}
+
+	changes := make([]Change, 0)
+	for _, spec := range specs {
+		spec := spec
+		clientId := spec.ClientId.String()
+		resource := fmt.Sprintf("app %q", clientId)
+
+		app, ok := existing[clientId]
+		if !ok {
+			changes = append(changes, Change{
+				Action:   ActionCreate,
+				Resource: resource,
+				Details: []string{
+					"name: " + spec.Name,
+					"description: " + spec.Description,
+					"redirect_uri: " + spec.RedirectUri.String(),
+					"scopes: " + strings.Join(spec.Scopes, " "),
+				},
+				apply: func(ctx context.Context) models.Notifier {
+					app, err := self.appService.CreateApp(
+						ctx,
+						clientId,
+						spec.ClientSecret.String(),
+						spec.RedirectUri.String(),
+						spec.Name,
+						spec.Description,
+					)
+					if err != nil {
+						return err
+					}
+
+					return self.appService.UpdateScopes(ctx, app.AppId, spec.Scopes)
+				},
+			})
+			continue
+		}
+
+		delete(existing, clientId)
+
+		details := make([]string, 0)
+		updateApp := false
+		if app.Name != spec.Name {
+			updateApp = true
+			details = append(details, fmt.Sprintf("name: %q -> %q", app.Name, spec.Name))
+		}
+		if app.Description != spec.Description {
+			updateApp = true
+			details = append(details, fmt.Sprintf("description: %q -> %q", app.Description, spec.Description))
+		}
+		if app.RedirectUri != spec.RedirectUri.String() {
+			updateApp = true
+			details = append(details, fmt.Sprintf("redirect_uri: %q -> %q", app.RedirectUri, spec.RedirectUri.String()))
+		}
+
+		updateScopes := !sameScopes(app.Scopes, spec.Scopes)
+		if updateScopes {
+			details = append(details, fmt.Sprintf(
+				"scopes: %q -> %q",
+				strings.Join(app.Scopes, " "),
+				strings.Join(spec.Scopes, " "),
+			))
+		}
+
+		_, err := self.appService.ValidateAppSecret(ctx, app.AppId, spec.ClientSecret.String())
+		updateSecret := err == services.AccessDenied
+		if err != nil && !updateSecret {
+			return nil, fmt.Errorf("%s: %s", resource, err.Notify().Message)
+		}
+		if updateSecret {
+			details = append(details, "client_secret: (changed)")
+		}
+
+		if len(details) == 0 {
+			continue
+		}
+
+		appId := app.AppId
+		changes = append(changes, Change{
+			Action:   ActionUpdate,
+			Resource: resource,
+			Details:  details,
+			apply: func(ctx context.Context) models.Notifier {
+				if updateApp {
+					err := self.appService.UpdateApp(
+						ctx,
+						appId,
+						spec.RedirectUri.String(),
+						spec.Name,
+						spec.Description,
+					)
+					if err != nil {
+						return err
+					}
+				}
+
+				if updateScopes {
+					if err := self.appService.UpdateScopes(ctx, appId, spec.Scopes); err != nil {
+						return err
+					}
+				}
+
+				if updateSecret {
+					if err := self.appService.SetSecret(ctx, appId, spec.ClientSecret.String()); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			},
+		})
+	}
+
+	if prune {
+		for _, app := range current {
+			if _, ok := existing[app.ClientId]; !ok {
+				continue
+			}
+
+			appId := app.AppId
+			changes = append(changes, Change{
+				Action:   ActionDelete,
+				Resource: fmt.Sprintf("app %q", app.ClientId),
+				Details:  []string{"name: " + app.Name},
+				apply: func(ctx context.Context) models.Notifier {
+					return self.appService.DeleteApp(ctx, appId)
+				},
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+func sameScopes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := make(map[string]bool, len(a))
+	for _, scope := range a {
+		set[scope] = true
+	}
+
+	for _, scope := range b {
+		if !set[scope] {
+			return false
+		}
+	}
+
+	return true
+}
+
+//==============================================================================
+
+func effect(policy config.PolicySpec) string {
+	if policy.Effect == "" {
+		return "allow"
+	}
+
+	return policy.Effect
+}
+
+func policyKey(resource, action, effect, condition string) string {
+	return strings.Join([]string{resource, action, effect, condition}, "\x00")
+}
+
+func describePolicy(policy config.PolicySpec) string {
+	description := fmt.Sprintf("%s %s %s", effect(policy), policy.Action, policy.Resource)
+	if policy.Condition != "" {
+		description += " when " + policy.Condition
+	}
+
+	return description
+}
+
+// diffPolicies returns the policies in the spec that don't exist yet and
+// the existing policies that aren't in the spec.
+func diffPolicies(
+	specs []config.PolicySpec,
+	current []models.Policy,
+) ([]config.PolicySpec, []models.Policy) {
+	existing := make(map[string]bool, len(current))
+	for _, policy := range current {
+		existing[policyKey(policy.Resource, policy.Action, policy.Effect, policy.Condition)] = true
+	}
+
+	wanted := make(map[string]bool, len(specs))
+	missing := make([]config.PolicySpec, 0)
+	for _, policy := range specs {
+		key := policyKey(policy.Resource, policy.Action, effect(policy), policy.Condition)
+		if !existing[key] && !wanted[key] {
+			missing = append(missing, policy)
+		}
+		wanted[key] = true
+	}
+
+	extra := make([]models.Policy, 0)
+	for _, policy := range current {
+		if !wanted[policyKey(policy.Resource, policy.Action, policy.Effect, policy.Condition)] {
+			extra = append(extra, policy)
+		}
+	}
+
+	return missing, extra
+}
+
+func policyDetails(missing []config.PolicySpec, extra []models.Policy) []string {
+	details := make([]string, 0, len(missing)+len(extra))
+	for _, policy := range missing {
+		details = append(details, "+ policy "+describePolicy(policy))
+	}
+
+	for _, policy := range extra {
+		details = append(details, "- policy "+describePolicy(config.PolicySpec{
+			Resource:  policy.Resource,
+			Action:    policy.Action,
+			Effect:    policy.Effect,
+			Condition: policy.Condition,
+		}))
+	}
+
+	return details
+}
@@ -5,6 +5,10 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/casbin/casbin/v2"
@@ -17,102 +21,311 @@ import (
 
 const PREFIX = "policy:"
 
+const VERSION_PREFIX = "version:"
+
+// ENFORCER_TTL matches how long policies are kept in the key value store so
+// a missed invalidation message can't keep a stale enforcer around forever.
+const ENFORCER_TTL = 5 * time.Minute
+
 type PolicyProvider interface {
 	GetPolicies(ctx context.Context, id string) (models.PolicyResponse, error)
 }
 
+// CasbinAccessControl caches each user's policies in the key value store
+// and their compiled enforcer in process. Both are tagged with the user's
+// policy version, a counter in the versions store shared by every service
+// that is bumped whenever the user's policies change.
 type CasbinAccessControl struct {
-	model          string
+	model          model.Model
 	keyValueStore  database.KeyValueStoreProvider
+	versions       database.KeyValueStoreProvider
 	publisher      database.PublisherProvider
 	policyProvider PolicyProvider
+
+	mu        sync.RWMutex
+	enforcers map[string]cachedEnforcer
+	known     map[string]int64
+	lastSweep time.Time
+}
+
+type cachedEnforcer struct {
+	enforcer  *casbin.Enforcer
+	version   int64
+	digest    string
+	expiresAt time.Time
 }
 
 func NewCasbinAccessControl(
 	modelDef string,
 	keyValueStore database.KeyValueStoreProvider,
+	versions database.KeyValueStoreProvider,
 	publisher database.PublisherProvider,
 	poliPolicyProvider PolicyProvider,
 ) *CasbinAccessControl {
+	m, err := model.NewModelFromString(modelDef)
+	if err != nil {
+		panic(err)
+	}
+
 	return &CasbinAccessControl{
-		model:          modelDef,
+		model:          m,
 		keyValueStore:  keyValueStore,
+		versions:       versions,
 		publisher:      publisher,
 		policyProvider: poliPolicyProvider,
+		enforcers:      make(map[string]cachedEnforcer),
+		known:          make(map[string]int64),
+		lastSweep:      time.Now(),
 	}
 }
 
-func (self *CasbinAccessControl) getEnforcer(ctx context.Context, id string) *casbin.Enforcer {
-	var p models.PolicyResponse
+// getEnforcer returns the compiled enforcer for the user, building it from
+// their policies only when there isn't a live one cached in process for the
+// latest version we have heard about. When the request carries a policy
+// claim for the user its version is trusted instead of asking the versions
+// store, so a matching cached copy is used without any network calls.
+func (self *CasbinAccessControl) getEnforcer(
+	ctx context.Context,
+	id string,
+) (*casbin.Enforcer, error) {
+	claim := policyClaim(ctx, id)
 
-	result, err := self.keyValueStore.Get().Get(ctx, PREFIX+id)
-	if err == redis.Nil {
-		p, err = self.policyProvider.GetPolicies(ctx, id)
-		if err != nil {
-			panic(err)
-		}
+	self.mu.RLock()
+	cached, ok := self.enforcers[id]
+	latest := self.known[id]
+	self.mu.RUnlock()
+
+	if claim != nil && claim.Version > latest {
+		latest = claim.Version
+	}
+
+	if ok && cached.satisfies(latest, claim) && time.Now().Before(cached.expiresAt) {
+		return cached.enforcer, nil
+	}
 
-		valBytes, err := json.Marshal(p)
+	version := latest
+	if claim == nil {
+		current, err := self.currentVersion(ctx, id)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+		version = current
+	}
+
+	policy, err := self.loadPolicies(ctx, id, version, claim)
+	if err != nil {
+		return nil, err
+	}
 
-		value := base64.StdEncoding.EncodeToString(valBytes)
-		err = self.keyValueStore.Get().Set(ctx, PREFIX+id, value, 5*time.Minute)
+	// Policies that changed after the token was issued don't match the
+	// claim, so the claimed version can't be trusted and the versions store
+	// is asked instead, like a request without a claim
+	digest := Digest(policy)
+	if claim != nil && version == claim.Version && digest != claim.Digest {
+		version, err = self.currentVersion(ctx, id)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-	} else if err != nil {
-		panic(err)
-	} else {
-		valBytes, err := base64.StdEncoding.DecodeString(result)
+
+		policy, err = self.loadPolicies(ctx, id, version, nil)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		err = json.Unmarshal(valBytes, &p)
-		if err != nil {
-			panic(err)
+		digest = Digest(policy)
+	}
+
+	enforcer := self.makeEnforcer(id, policy)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(self.lastSweep) > ENFORCER_TTL {
+		for key, entry := range self.enforcers {
+			if now.After(entry.expiresAt) {
+				delete(self.enforcers, key)
+			}
 		}
+		self.lastSweep = now
+	}
+
+	self.enforcers[id] = cachedEnforcer{
+		enforcer:  enforcer,
+		version:   version,
+		digest:    digest,
+		expiresAt: now.Add(ENFORCER_TTL),
 	}
 
-	return self.makeEnforcer(id, p)
+	return enforcer, nil
 }
 
-func (self *CasbinAccessControl) makeEnforcer(
+// satisfies reports whether the cached enforcer is at least at the latest
+// version. At the claimed version the digest has to match as well, which
+// catches a versions store that was reset and is counting up again.
+func (self cachedEnforcer) satisfies(latest int64, claim *models.PolicyClaim) bool {
+	if self.version < latest {
+		return false
+	}
+
+	if claim != nil && self.version == claim.Version {
+		return self.digest == claim.Digest
+	}
+
+	return true
+}
+
+// observe records that the user's policies are at least at the given
+// version, dropping any enforcer built from an older one.
+func (self *CasbinAccessControl) observe(id string, version int64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if version > self.known[id] {
+		self.known[id] = version
+	}
+
+	if cached, ok := self.enforcers[id]; ok && cached.version < version {
+		delete(self.enforcers, id)
+	}
+}
+
+// resync drops every enforcer cached in process so each one is rebuilt
+// against the current version on next use.
+func (self *CasbinAccessControl) resync() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.enforcers = make(map[string]cachedEnforcer)
+	self.known = make(map[string]int64)
+}
+
+func (self *CasbinAccessControl) currentVersion(ctx context.Context, id string) (int64, error) {
+	result, err := self.versions.Get().Get(ctx, VERSION_PREFIX+id)
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(result, 10, 64)
+}
+
+// loadPolicies reads the user's policies for the given version from the key
+// value store, falling back to the policy provider. Entries are keyed by
+// version so a bump makes every older entry unreachable. A cached entry that
+// doesn't match the claimed digest is refetched, as is one that can't be
+// read. Only the provider failing is an error.
+func (self *CasbinAccessControl) loadPolicies(
+	ctx context.Context,
 	id string,
-	policy models.PolicyResponse,
-) *casbin.Enforcer {
-	m, err := model.NewModelFromString(self.model)
+	version int64,
+	claim *models.PolicyClaim,
+) (models.PolicyResponse, error) {
+	var p models.PolicyResponse
+	key := fmt.Sprintf("%s%s:%d", PREFIX, id, version)
+
+	result, err := self.keyValueStore.Get().Get(ctx, key)
+	if err != nil && err != redis.Nil {
+		log.Printf("Unable to read cached policies for %s: %s", id, err)
+	}
+
+	if err == nil {
+		if cached, err := decodePolicies(result); err != nil {
+			log.Printf("Unable to decode cached policies for %s: %s", id, err)
+		} else if claim == nil || claim.Version != version || Digest(cached) == claim.Digest {
+			return cached, nil
+		}
+	}
+
+	p, err = self.policyProvider.GetPolicies(ctx, id)
+	if err != nil {
+		return models.PolicyResponse{}, err
+	}
+
+	valBytes, err := json.Marshal(p)
 	if err != nil {
 		panic(err)
 	}
 
-	e, err := casbin.NewEnforcer(m, false)
+	value := base64.StdEncoding.EncodeToString(valBytes)
+	err = self.keyValueStore.Get().Set(ctx, key, value, ENFORCER_TTL)
+	if err != nil {
+		log.Printf("Unable to cache policies for %s: %s", id, err)
+	}
+
+	return p, nil
+}
+
+func decodePolicies(value string) (models.PolicyResponse, error) {
+	var p models.PolicyResponse
+
+	valBytes, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return p, err
+	}
+
+	err = json.Unmarshal(valBytes, &p)
+	return p, err
+}
+
+func (self *CasbinAccessControl) newEnforcer() *casbin.Enforcer {
+	e, err := casbin.NewEnforcer(self.model.Copy(), false)
 	if err != nil {
 		panic(err)
 	}
-	e.EnableLog(true)
+
+	matchers := newMatchers()
+	e.AddFunction("resourceMatch", matchers.resourceMatch)
+	e.AddFunction("actionMatch", matchers.actionMatch)
+	e.AddFunction("condition", conditionFunction(e))
+
+	return e
+}
+
+// addRule adds a policy for the principle. Policies without a condition
+// always apply.
+func addRule(e *casbin.Enforcer, principle string, policy models.Policy) {
+	condition := policy.Condition
+	if condition == "" {
+		condition = "true"
+	}
+
+	e.AddPolicy(principle, policy.Resource, policy.Action, policy.Effect, condition)
+}
+
+func (self *CasbinAccessControl) makeEnforcer(
+	id string,
+	policy models.PolicyResponse,
+) *casbin.Enforcer {
+	e := self.newEnforcer()
 
 	userPrinciple := fmt.Sprintf("u_%s", id)
-	e.AddPolicy(userPrinciple, "/user/"+id+"/*", "read", "allow")
-	e.AddPolicy(userPrinciple, "/user/"+id+"/*", "list", "allow")
-	e.AddPolicy(userPrinciple, "/user/"+id, "read", "allow")
+	e.AddPolicy(userPrinciple, "/user/"+id+"/*", "read", "allow", "true")
+	e.AddPolicy(userPrinciple, "/user/"+id+"/*", "list", "allow", "true")
+	e.AddPolicy(userPrinciple, "/user/"+id, "read", "allow", "true")
+
+	// Authors may always manage their own posts and the comments on them,
+	// and anyone signed in may comment
+	e.AddPolicy(userPrinciple, "/blog/*", "update|delete|moderate", "allow", "r.attrs.owner == r.sub")
+	e.AddPolicy(userPrinciple, "/blog/*/comment", "create", "allow", "true")
 
 	for _, permission := range policy.User {
-		e.AddPolicy(userPrinciple, permission.Resource, permission.Action, permission.Effect)
+		addRule(e, userPrinciple, permission)
 	}
 
-	e.AddPolicy(userPrinciple, "/org", "list", "allow")
+	e.AddPolicy(userPrinciple, "/org", "list", "allow", "true")
 	for _, org := range policy.Org {
 		orgPrinciple := fmt.Sprintf("o_%s", org.OrgId)
 		e.AddRoleForUser(userPrinciple, orgPrinciple)
 
-		e.AddPolicy(orgPrinciple, "/org/"+org.OrgId+"/*", "read", "allow")
-		e.AddPolicy(orgPrinciple, "/org/"+org.OrgId+"/*", "list", "allow")
-		e.AddPolicy(orgPrinciple, "/org/"+org.OrgId, "read", "allow")
+		e.AddPolicy(orgPrinciple, "/org/"+org.OrgId+"/*", "read", "allow", "true")
+		e.AddPolicy(orgPrinciple, "/org/"+org.OrgId+"/*", "list", "allow", "true")
+		e.AddPolicy(orgPrinciple, "/org/"+org.OrgId, "read", "allow", "true")
 
 		for _, permission := range org.Policy {
-			e.AddPolicy(orgPrinciple, permission.Resource, permission.Action, permission.Effect)
+			addRule(e, orgPrinciple, permission)
 		}
 	}
 
@@ -124,6 +337,16 @@ func (self *CasbinAccessControl) Enforce(
 	ctx context.Context,
 	resource string,
 	action string,
+) models.Notifier {
+	return self.EnforceWithAttributes(ctx, resource, action, models.ResourceAttributes{})
+}
+
+// EnforceWithAttributes implements services.AccessControlService.
+func (self *CasbinAccessControl) EnforceWithAttributes(
+	ctx context.Context,
+	resource string,
+	action string,
+	attrs models.ResourceAttributes,
 ) models.Notifier {
 	userId, ok := ctx.Value("user_id").(string)
 
@@ -132,11 +355,19 @@ func (self *CasbinAccessControl) Enforce(
 	}
 
 	principle := fmt.Sprintf("u_%s", userId)
-	enforcer := self.getEnforcer(ctx, userId)
+	enforcer, err := self.getEnforcer(ctx, userId)
+	if err != nil {
+		log.Printf("Unable to load policies for %s: %s", userId, err)
+		return services.AccessDenied
+	}
 
-	ok, err := enforcer.Enforce(principle, resource, action)
+	// A condition that can't be evaluated, like one comparing against an
+	// attribute the resource doesn't have, denies rather than failing the
+	// whole request
+	ok, err = enforcer.Enforce(principle, resource, action, attrs)
 	if err != nil {
-		panic(err)
+		log.Printf("Unable to enforce %s on %s for %s: %s", action, resource, userId, err)
+		return services.AccessDenied
 	}
 
 	if !ok {
@@ -146,12 +377,238 @@ func (self *CasbinAccessControl) Enforce(
 	return nil
 }
 
+// EnforceMany implements services.AccessControlService.
+// The user's enforcer is looked up once and every resource is checked
+// against it, the result at each index matching the resource at that index.
+func (self *CasbinAccessControl) EnforceMany(
+	ctx context.Context,
+	resources []string,
+	action string,
+	attrs []models.ResourceAttributes,
+) []bool {
+	userId, ok := ctx.Value("user_id").(string)
+
+	if !ok || userId == "" {
+		return make([]bool, len(resources))
+	}
+
+	principle := fmt.Sprintf("u_%s", userId)
+	enforcer, err := self.getEnforcer(ctx, userId)
+	if err != nil {
+		log.Printf("Unable to load policies for %s: %s", userId, err)
+		return make([]bool, len(resources))
+	}
+
+	requests := make([][]interface{}, len(resources))
+	for i, resource := range resources {
+		resourceAttrs := models.ResourceAttributes{}
+		if attrs != nil {
+			resourceAttrs = attrs[i]
+		}
+
+		requests[i] = []interface{}{principle, resource, action, resourceAttrs}
+	}
+
+	results, err := enforcer.BatchEnforce(requests)
+	if err == nil {
+		return results
+	}
+
+	// The batch stops at the first request that fails, so each one is
+	// checked on its own to deny only the ones that can't be evaluated
+	results = make([]bool, len(requests))
+	for i, request := range requests {
+		allowed, err := enforcer.Enforce(request...)
+		if err != nil {
+			log.Printf("Unable to enforce %s on %s for %s: %s", action, resources[i], userId, err)
+			continue
+		}
+
+		results[i] = allowed
+	}
+
+	return results
+}
+
+// Explain implements services.AccessControlService.
+// It runs the same enforcer as Enforce for the given user and then probes
+// every rule on its own to find the ones that matched the request.
+// Conditions are evaluated without any resource attributes.
+func (self *CasbinAccessControl) Explain(
+	ctx context.Context,
+	id string,
+	resource string,
+	action string,
+) *models.PolicyExplanation {
+	principle := fmt.Sprintf("u_%s", id)
+	explanation := &models.PolicyExplanation{
+		UserId:   id,
+		Resource: resource,
+		Action:   action,
+		Root:     principle == "u_ROOT",
+		Matched:  make([]models.PolicyMatch, 0),
+	}
+
+	enforcer, err := self.getEnforcer(ctx, id)
+	if err != nil {
+		log.Printf("Unable to load policies for %s: %s", id, err)
+		return explanation
+	}
+
+	attrs := models.ResourceAttributes{}
+
+	allowed, err := enforcer.Enforce(principle, resource, action, attrs)
+	if err != nil {
+		log.Printf("Unable to enforce %s on %s for %s: %s", action, resource, id, err)
+	}
+	explanation.Allowed = err == nil && allowed
+
+	// Every rule matches the root user so there is nothing useful to list
+	if explanation.Root {
+		return explanation
+	}
+
+	roles := enforcer.GetGroupingPolicy()
+	for _, rule := range enforcer.GetPolicy() {
+		probe := self.newEnforcer()
+		if len(roles) > 0 {
+			probe.AddGroupingPolicies(roles)
+		}
+
+		// Force the effect to allow so a match is reported regardless of the
+		// rule's actual effect.
+		probeRule := make([]string, len(rule))
+		copy(probeRule, rule)
+		probeRule[3] = "allow"
+		probe.AddPolicy(probeRule)
+
+		// A rule whose condition can't be evaluated never matches
+		ok, err := probe.Enforce(principle, resource, action, attrs)
+		if err != nil {
+			log.Printf("Unable to evaluate rule %v for %s: %s", rule, id, err)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		match := models.PolicyMatch{
+			Principal: rule[0],
+			Source:    "user",
+			Path:      []string{principle},
+			Resource:  rule[1],
+			Action:    rule[2],
+			Effect:    rule[3],
+		}
+
+		if rule[4] != "true" {
+			match.Condition = rule[4]
+		}
+
+		if rule[0] != principle {
+			match.Source = "org"
+			match.Path = append(match.Path, rule[0])
+		}
+
+		explanation.Matched = append(explanation.Matched, match)
+	}
+
+	return explanation
+}
+
+// PolicyClaim implements services.AccessControlService.
+// When the policies can't be loaded there's no claim, tokens still work
+// without one since enforcing then asks the versions store instead.
+func (self *CasbinAccessControl) PolicyClaim(ctx context.Context, id string) *models.PolicyClaim {
+	version, err := self.currentVersion(ctx, id)
+	if err != nil {
+		log.Printf("Unable to read the policy version for %s: %s", id, err)
+		return nil
+	}
+
+	policy, err := self.loadPolicies(ctx, id, version, nil)
+	if err != nil {
+		log.Printf("Unable to load policies for %s: %s", id, err)
+		return nil
+	}
+
+	return &models.PolicyClaim{
+		Version: version,
+		Digest:  Digest(policy),
+	}
+}
+
+// Invalidate implements services.AccessControlService.
+// It bumps the user's policy version and tells every other instance about
+// it. Instances that miss the message still find out on their next resync.
 func (self *CasbinAccessControl) Invalidate(ctx context.Context, id string) {
-	self.keyValueStore.Get().Del(ctx, PREFIX+id)
+	version, err := self.versions.Get().Incr(ctx, VERSION_PREFIX+id)
+	if err != nil {
+		panic(err)
+	}
+
+	self.observe(id, version)
 
 	if self.publisher != nil {
-		self.publisher.Get().Publish(ctx, "policy_invalidate", PREFIX+id)
+		message := fmt.Sprintf("%s%s:%d", PREFIX, id, version)
+		self.publisher.Get().Publish(ctx, "policy_invalidate", message)
+	}
+}
+
+// ListenForInvalidation applies versions published on the policy_invalidate
+// channel by other instances. Whenever the subscription drops it reconnects
+// with backoff and resyncs, since anything published in between was missed.
+// It blocks until the context is cancelled.
+func (self *CasbinAccessControl) ListenForInvalidation(
+	ctx context.Context,
+	subscriber database.SubscriberProvider,
+) {
+	backoff := time.Second
+
+	for {
+		channel, err := subscriber.Get().Subscribe(ctx, "policy_invalidate")
+		if err != nil {
+			log.Printf("Unable to subscribe to policy invalidations: %s", err)
+		} else {
+			backoff = time.Second
+			self.resync()
+
+			for msg := range channel {
+				self.handleInvalidation(msg)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// handleInvalidation parses messages of the form policy:<id>:<version>.
+func (self *CasbinAccessControl) handleInvalidation(msg string) {
+	key := strings.TrimPrefix(msg, PREFIX)
+
+	i := strings.LastIndex(key, ":")
+	if i == -1 {
+		log.Printf("Ignoring malformed policy invalidation %q", msg)
+		return
+	}
+
+	version, err := strconv.ParseInt(key[i+1:], 10, 64)
+	if err != nil {
+		log.Printf("Ignoring malformed policy invalidation %q", msg)
+		return
 	}
+
+	self.observe(key[:i], version)
 }
 
 // var _ services.AccessControlService = (*CasbinAccessControl)(nil)
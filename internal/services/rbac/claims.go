@@ -0,0 +1,87 @@
+package rbac
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"github.com/jhamill34/notion-provisioner/internal/models"
+)
+
+// Digest hashes the policies in a canonical order so the same set of
+// policies always produces the same digest no matter how they were loaded.
+func Digest(policy models.PolicyResponse) string {
+	canonical := models.PolicyResponse{
+		User: sortedPolicies(policy.User),
+		Org:  make([]models.OrgPolicyResponse, len(policy.Org)),
+	}
+
+	for i, org := range policy.Org {
+		canonical.Org[i] = models.OrgPolicyResponse{
+			OrgId:  org.OrgId,
+			Policy: sortedPolicies(org.Policy),
+		}
+	}
+
+	sort.Slice(canonical.Org, func(i, j int) bool {
+		return canonical.Org[i].OrgId < canonical.Org[j].OrgId
+	})
+
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		panic(err)
+	}
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func sortedPolicies(policies []models.Policy) []models.Policy {
+	sorted := make([]models.Policy, len(policies))
+	copy(sorted, policies)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Set != b.Set {
+			return a.Set < b.Set
+		}
+
+		if a.PolicyId != b.PolicyId {
+			return a.PolicyId < b.PolicyId
+		}
+
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+
+		if a.Action != b.Action {
+			return a.Action < b.Action
+		}
+
+		if a.Effect != b.Effect {
+			return a.Effect < b.Effect
+		}
+
+		return a.Condition < b.Condition
+	})
+
+	return sorted
+}
+
+// policyClaim returns the policy claim from the access token used for the
+// request, as long as the token belongs to the given user.
+func policyClaim(ctx context.Context, id string) *models.PolicyClaim {
+	userId, ok := ctx.Value("user_id").(string)
+	if !ok || userId != id {
+		return nil
+	}
+
+	claim, ok := ctx.Value("policy_claim").(models.PolicyClaim)
+	if !ok {
+		return nil
+	}
+
+	return &claim
+}
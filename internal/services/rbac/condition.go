@@ -0,0 +1,146 @@
+package rbac
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+)
+
+var attributeReference = regexp.MustCompile(`r\.attrs\.([A-Za-z_0-9]+)`)
+
+var knownAttributes = map[string]bool{
+	"owner":      true,
+	"org":        true,
+	"visibility": true,
+}
+
+// parseCondition compiles a policy condition. Attribute references are
+// rewritten to plain variables (r.attrs.owner becomes r_attrs_owner) since
+// govaluate can't look up fields on a request value.
+func parseCondition(
+	condition string,
+	g govaluate.ExpressionFunction,
+) (*govaluate.EvaluableExpression, error) {
+	var unknown error
+	expression := attributeReference.ReplaceAllStringFunc(condition, func(match string) string {
+		name := attributeReference.FindStringSubmatch(match)[1]
+		if !knownAttributes[name] && unknown == nil {
+			unknown = fmt.Errorf("unknown attribute %q", name)
+		}
+
+		return "r_attrs_" + name
+	})
+
+	if unknown != nil {
+		return nil, unknown
+	}
+
+	functionMap := model.LoadFunctionMap()
+	functions := functionMap.GetFunctions()
+	functions["g"] = g
+
+	parsed, err := govaluate.NewEvaluableExpressionWithFunctions(
+		util.EscapeAssertion(expression),
+		functions,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse expression")
+	}
+
+	return parsed, nil
+}
+
+// conditionParameters builds the variables available to a condition,
+// turning ids into principles so they can be compared against r.sub or
+// used with g().
+func conditionParameters(
+	sub, obj, act string,
+	attrs models.ResourceAttributes,
+) map[string]interface{} {
+	parameters := map[string]interface{}{
+		"r_sub":              sub,
+		"r_obj":              obj,
+		"r_act":              act,
+		"r_attrs_owner":      "",
+		"r_attrs_org":        "",
+		"r_attrs_visibility": attrs.Visibility,
+	}
+
+	if attrs.Owner != "" {
+		parameters["r_attrs_owner"] = "u_" + attrs.Owner
+	}
+
+	if attrs.Org != "" {
+		parameters["r_attrs_org"] = "o_" + attrs.Org
+	}
+
+	return parameters
+}
+
+// conditionFunction returns the condition() matcher function for the
+// enforcer. Each condition is compiled the first time it is seen and g()
+// inside a condition uses the enforcer's own role assignments.
+func conditionFunction(e *casbin.Enforcer) govaluate.ExpressionFunction {
+	var mu sync.RWMutex
+	compiled := make(map[string]*govaluate.EvaluableExpression)
+
+	g := func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return false, fmt.Errorf("g() expects 2 arguments, got %d", len(args))
+		}
+
+		name1, _ := args[0].(string)
+		name2, _ := args[1].(string)
+		if name1 == "" || name2 == "" {
+			return false, nil
+		}
+
+		return e.GetRoleManager().HasLink(name1, name2)
+	}
+
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) != 5 {
+			return false, fmt.Errorf("condition() expects 5 arguments, got %d", len(args))
+		}
+
+		condition, _ := args[0].(string)
+		if condition == "" || condition == "true" {
+			return true, nil
+		}
+
+		mu.RLock()
+		expression, ok := compiled[condition]
+		mu.RUnlock()
+
+		if !ok {
+			var err error
+			expression, err = parseCondition(condition, g)
+			if err != nil {
+				return false, err
+			}
+
+			mu.Lock()
+			compiled[condition] = expression
+			mu.Unlock()
+		}
+
+		sub, _ := args[1].(string)
+		obj, _ := args[2].(string)
+		act, _ := args[3].(string)
+		attrs, _ := args[4].(models.ResourceAttributes)
+
+		result, err := expression.Evaluate(conditionParameters(sub, obj, act, attrs))
+		if err != nil {
+			return false, err
+		}
+
+		matched, ok := result.(bool)
+		return ok && matched, nil
+	}
+}
@@ -0,0 +1,113 @@
+package rbac
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var pathParameter = regexp.MustCompile(`\{[^/]+\}`)
+
+// The built in keyMatch5 and regexMatch compile their patterns on every
+// call which dominates the cost of checking long lists. The model uses
+// resourceMatch and actionMatch instead, which keep the compiled patterns
+// for as long as the enforcer they belong to. Patterns come from policies
+// anyone with access to the API can write, so they aren't kept for the
+// life of the process, only as long as the enforcer is cached.
+type matchers struct {
+	mu        sync.RWMutex
+	resources map[string]*regexp.Regexp
+	actions   map[string]*regexp.Regexp
+}
+
+func newMatchers() *matchers {
+	return &matchers{
+		resources: make(map[string]*regexp.Regexp),
+		actions:   make(map[string]*regexp.Regexp),
+	}
+}
+
+// compile returns the compiled expression for pattern from cache, building
+// it with expression the first time it's seen.
+func (self *matchers) compile(
+	cache map[string]*regexp.Regexp,
+	pattern string,
+	expression func(string) string,
+) (*regexp.Regexp, error) {
+	self.mu.RLock()
+	re, ok := cache[pattern]
+	self.mu.RUnlock()
+
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(expression(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	self.mu.Lock()
+	cache[pattern] = re
+	self.mu.Unlock()
+
+	return re, nil
+}
+
+func stringArgs(name string, args ...interface{}) (string, string, error) {
+	if len(args) != 2 {
+		return "", "", fmt.Errorf("%s: expected 2 arguments, got %d", name, len(args))
+	}
+
+	key1, ok1 := args[0].(string)
+	key2, ok2 := args[1].(string)
+	if !ok1 || !ok2 {
+		return "", "", fmt.Errorf("%s: arguments must be strings", name)
+	}
+
+	return key1, key2, nil
+}
+
+// resourceMatch behaves like casbin's keyMatch5.
+func (self *matchers) resourceMatch(args ...interface{}) (interface{}, error) {
+	key1, key2, err := stringArgs("resourceMatch", args...)
+	if err != nil {
+		return false, err
+	}
+
+	if i := strings.Index(key1, "?"); i != -1 {
+		key1 = key1[:i]
+	}
+
+	re, err := self.compile(self.resources, key2, keyPattern)
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(key1), nil
+}
+
+func keyPattern(key string) string {
+	pattern := strings.Replace(key, "/*", "/.*", -1)
+	pattern = pathParameter.ReplaceAllString(pattern, "[^/]+")
+
+	return "^" + pattern + "$"
+}
+
+// actionMatch behaves like casbin's regexMatch.
+func (self *matchers) actionMatch(args ...interface{}) (interface{}, error) {
+	key1, key2, err := stringArgs("actionMatch", args...)
+	if err != nil {
+		return false, err
+	}
+
+	re, err := self.compile(self.actions, key2, func(pattern string) string {
+		return pattern
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(key1), nil
+}
@@ -3,28 +3,47 @@ package rbac
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 
+	"github.com/jhamill34/notion-provisioner/internal/database"
 	"github.com/jhamill34/notion-provisioner/internal/database/dao"
 	"github.com/jhamill34/notion-provisioner/internal/models"
 )
 
 type DatabasePolicyProvider struct {
-	userDao *dao.UserDao
-	orgDao  *dao.OrganizationDao
+	userDao      *dao.UserDao
+	orgDao       *dao.OrganizationDao
+	policySetDao *dao.PolicySetDao
 }
 
 func NewDatabasePolicyProvider(
 	userDao *dao.UserDao,
 	orgDao *dao.OrganizationDao,
+	policySetDao *dao.PolicySetDao,
 ) *DatabasePolicyProvider {
-	return &DatabasePolicyProvider{userDao, orgDao}
+	return &DatabasePolicyProvider{userDao, orgDao, policySetDao}
 }
 
 func (self *DatabasePolicyProvider) GetPolicies(
 	ctx context.Context,
 	id string,
 ) (models.PolicyResponse, error) {
+	// Disabled users keep their policies around in case they come back
+	// but aren't granted anything in the meantime.
+	user, err := self.userDao.FindById(ctx, id)
+	if err != nil && err != database.NotFound {
+		return models.PolicyResponse{}, err
+	}
+
+	if user != nil && !user.Active {
+		return models.PolicyResponse{
+			User: []models.Policy{},
+			Org:  []models.OrgPolicyResponse{},
+		}, nil
+	}
+
 	data, err := self.userDao.GetPermissions(ctx, id)
 	if err != nil {
 		return models.PolicyResponse{}, err
@@ -33,13 +52,24 @@ func (self *DatabasePolicyProvider) GetPolicies(
 	policies := make([]models.Policy, len(data))
 	for i, policy := range data {
 		policies[i] = models.Policy{
-			PolicyId: policy.Id,
-			Resource: policy.Resource,
-			Action:   policy.Action,
-			Effect:   policy.Effect,
+			PolicyId:  policy.Id,
+			Resource:  policy.Resource,
+			Action:    policy.Action,
+			Effect:    policy.Effect,
+			Condition: policy.Condition,
 		}
 	}
 
+	userSets, err := self.policySetDao.ListUserSets(ctx, id)
+	if err != nil {
+		return models.PolicyResponse{}, err
+	}
+
+	policies, err = self.appendSetPolicies(ctx, policies, userSets)
+	if err != nil {
+		return models.PolicyResponse{}, err
+	}
+
 	orgData, err := self.orgDao.ListUsersOrgs(ctx, id)
 	if err != nil {
 		return models.PolicyResponse{}, err
@@ -55,13 +85,24 @@ func (self *DatabasePolicyProvider) GetPolicies(
 		orgPolicies := make([]models.Policy, len(orgPolicyData))
 		for i, policy := range orgPolicyData {
 			orgPolicies[i] = models.Policy{
-				PolicyId: policy.Id,
-				Resource: policy.Resource,
-				Action:   policy.Action,
-				Effect:   policy.Effect,
+				PolicyId:  policy.Id,
+				Resource:  policy.Resource,
+				Action:    policy.Action,
+				Effect:    policy.Effect,
+				Condition: policy.Condition,
 			}
 		}
 
+		orgSets, err := self.policySetDao.ListOrgSets(ctx, org.Id)
+		if err != nil {
+			return models.PolicyResponse{}, err
+		}
+
+		orgPolicies, err = self.appendSetPolicies(ctx, orgPolicies, orgSets)
+		if err != nil {
+			return models.PolicyResponse{}, err
+		}
+
 		orgs[i] = models.OrgPolicyResponse{
 			OrgId:  org.Id,
 			Policy: orgPolicies,
@@ -74,24 +115,85 @@ func (self *DatabasePolicyProvider) GetPolicies(
 	}, nil
 }
 
+// appendSetPolicies expands each attached policy set into its
+// individual policies, tagging them with the set they came from.
+func (self *DatabasePolicyProvider) appendSetPolicies(
+	ctx context.Context,
+	policies []models.Policy,
+	sets []database.PolicySetEntity,
+) ([]models.Policy, error) {
+	for _, set := range sets {
+		data, err := self.policySetDao.GetPermissions(ctx, set.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, policy := range data {
+			policies = append(policies, models.Policy{
+				PolicyId:  policy.Id,
+				Resource:  policy.Resource,
+				Action:    policy.Action,
+				Effect:    policy.Effect,
+				Condition: policy.Condition,
+				Set:       set.Name,
+			})
+		}
+	}
+
+	return policies, nil
+}
+
 //==============================================================================
 
+// TokenSource supplies the service's own access token when fetching
+// policies on behalf of any user.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
 type RemotePolicyProvider struct {
 	remotePolicyProviderUrl string
 	httpClient              *http.Client
+	tokenSource             TokenSource
 }
 
-func NewRemotePolicyProvider(url string, httpClient *http.Client) *RemotePolicyProvider {
-	return &RemotePolicyProvider{url, httpClient}
+// NewRemotePolicyProvider fetches policies from the auth server. With a
+// token source the service authenticates as itself and can look up any
+// user, otherwise the end user's token is forwarded and only that user's
+// policies are available.
+func NewRemotePolicyProvider(
+	url string,
+	httpClient *http.Client,
+	tokenSource TokenSource,
+) *RemotePolicyProvider {
+	return &RemotePolicyProvider{url, httpClient, tokenSource}
 }
 
 func (self *RemotePolicyProvider) GetPolicies(
 	ctx context.Context,
 	id string,
 ) (models.PolicyResponse, error) {
-	tokenData := ctx.Value("raw_token").(string)
+	policyUrl := self.remotePolicyProviderUrl
+
+	var tokenData string
+	if self.tokenSource != nil {
+		token, err := self.tokenSource.Token(ctx)
+		if err != nil {
+			return models.PolicyResponse{}, err
+		}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", self.remotePolicyProviderUrl, nil)
+		tokenData = token
+		policyUrl += "/" + url.PathEscape(id)
+	} else {
+		token, ok := ctx.Value("raw_token").(string)
+		if !ok || token == "" {
+			return models.PolicyResponse{}, fmt.Errorf("no access token available to fetch policies for %s", id)
+		}
+
+		tokenData = token
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", policyUrl, nil)
 	if err != nil {
 		return models.PolicyResponse{}, err
 	}
@@ -102,9 +204,16 @@ func (self *RemotePolicyProvider) GetPolicies(
 	if err != nil {
 		return models.PolicyResponse{}, err
 	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return models.PolicyResponse{}, fmt.Errorf("policy request for %s failed with status %d", id, res.StatusCode)
+	}
 
 	var policyResponse models.PolicyResponse
-	json.NewDecoder(res.Body).Decode(&policyResponse)
+	if err := json.NewDecoder(res.Body).Decode(&policyResponse); err != nil {
+		return models.PolicyResponse{}, err
+	}
 
 	return policyResponse, nil
 }
@@ -0,0 +1,205 @@
+package rbac
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+)
+
+// ResourceRegistry validates policies against the resources and actions
+// that each service publishes. Resources are checked using the same
+// keyMatch5 semantics as the enforcer and actions using regexMatch.
+type ResourceRegistry struct {
+	definitions []models.ResourceDefinition
+}
+
+func NewResourceRegistry(definitions ...[]models.ResourceDefinition) *ResourceRegistry {
+	registry := &ResourceRegistry{}
+	for _, group := range definitions {
+		registry.definitions = append(registry.definitions, group...)
+	}
+
+	return registry
+}
+
+// Resources implements services.PolicyValidator.
+func (self *ResourceRegistry) Resources() []models.ResourceDefinition {
+	return self.definitions
+}
+
+// Validate implements services.PolicyValidator.
+func (self *ResourceRegistry) Validate(resource, action, effect, condition string) models.Notifier {
+	if effect != "allow" && effect != "deny" {
+		return services.InvalidPolicyEffect
+	}
+
+	if err := validateCondition(condition); err != nil {
+		return services.NewPolicyValidationError(
+			fmt.Sprintf("Condition %q is invalid: %s", condition, err.Error()),
+		)
+	}
+
+	if !strings.HasPrefix(resource, "/") {
+		return services.NewPolicyValidationError(
+			fmt.Sprintf("Resource %q must start with a /", resource),
+		)
+	}
+
+	for _, segment := range strings.Split(resource, "/") {
+		if err := validateSegment(segment); err != nil {
+			return services.NewPolicyValidationError(
+				fmt.Sprintf("Resource %q is not a valid pattern: %s", resource, err.Error()),
+			)
+		}
+	}
+
+	if action == "" {
+		return services.NewPolicyValidationError("Action is required")
+	}
+
+	actionExp, err := regexp.Compile(action)
+	if err != nil {
+		return services.NewPolicyValidationError(
+			fmt.Sprintf("Action %q is not a valid regular expression", action),
+		)
+	}
+
+	matched := make([]models.ResourceDefinition, 0)
+	for _, definition := range self.definitions {
+		if patternCovers(splitPath(resource), splitPath(definition.Pattern)) {
+			matched = append(matched, definition)
+		}
+	}
+
+	if len(matched) == 0 {
+		return services.UnknownPolicyResource
+	}
+
+	available := make([]string, 0)
+	for _, definition := range matched {
+		for _, known := range definition.Actions {
+			if actionExp.MatchString(known) {
+				return nil
+			}
+
+			available = append(available, known)
+		}
+	}
+
+	return services.NewPolicyValidationError(
+		fmt.Sprintf(
+			"Action %q does not match any action available on %s (%s)",
+			action,
+			resource,
+			strings.Join(dedupe(available), ", "),
+		),
+	)
+}
+
+// validateCondition checks that the condition parses and evaluates to a
+// boolean the same way the enforcer's condition() would, with every
+// attribute left empty.
+func validateCondition(condition string) error {
+	if condition == "" {
+		return nil
+	}
+
+	parsed, err := parseCondition(condition, func(args ...interface{}) (interface{}, error) {
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	parameters := conditionParameters("", "", "", models.ResourceAttributes{})
+	for _, name := range parsed.Vars() {
+		if _, ok := parameters[name]; !ok {
+			return fmt.Errorf("unknown variable %q", strings.Replace(name, "_", ".", 1))
+		}
+	}
+
+	result, err := parsed.Evaluate(parameters)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := result.(bool); !ok {
+		return fmt.Errorf("expression must evaluate to true or false")
+	}
+
+	return nil
+}
+
+func validateSegment(segment string) error {
+	opening := strings.Count(segment, "{")
+	closing := strings.Count(segment, "}")
+
+	if opening != closing || opening > 1 {
+		return fmt.Errorf("unbalanced braces in %q", segment)
+	}
+
+	if opening == 1 && (!strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") || len(segment) == 2) {
+		return fmt.Errorf("a parameter must take up the whole segment in %q", segment)
+	}
+
+	if strings.Contains(segment, "*") && segment != "*" {
+		return fmt.Errorf("a wildcard must take up the whole segment in %q", segment)
+	}
+
+	return nil
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// patternCovers reports whether the policy pattern matches at least one
+// concrete path described by the definition pattern. A "*" segment may
+// consume one or more segments, a "{param}" segment exactly one.
+func patternCovers(pattern, definition []string) bool {
+	if len(pattern) == 0 {
+		return len(definition) == 0
+	}
+
+	if pattern[0] == "*" {
+		for i := 1; i <= len(definition); i++ {
+			if patternCovers(pattern[1:], definition[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(definition) == 0 {
+		return false
+	}
+
+	if isParam(pattern[0]) || isParam(definition[0]) || pattern[0] == definition[0] {
+		return patternCovers(pattern[1:], definition[1:])
+	}
+
+	return false
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+// var _ services.PolicyValidator = (*ResourceRegistry)(nil)
@@ -0,0 +1,28 @@
+package render
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// postPolicy is what posts are allowed to contain. It's the same as
+// comments with the anchors on headings and the inline styles of
+// highlighted code on top, links are marked nofollow by rewriteLinks
+// rather than here so links within the site are left alone.
+var postPolicy = newPostPolicy()
+
+// commentPolicy strips anything from rendered comments that readers
+// shouldn't be served.
+var commentPolicy = bluemonday.UGCPolicy()
+
+func newPostPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.RequireNoFollowOnLinks(false)
+
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^anchor$`)).OnElements("a")
+	policy.AllowStyles("color", "background-color", "font-weight", "font-style", "text-decoration").
+		OnElements("pre", "span")
+
+	return policy
+}
@@ -0,0 +1,267 @@
+package render
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	xhtml "golang.org/x/net/html"
+)
+
+// How long a rendered post is kept after it was last rendered, posts that
+// haven't been read in that time are dropped.
+const RENDER_TTL = time.Hour
+
+const HIGHLIGHT_STYLE = "github"
+
+// Headings get ids from their text so they can be linked to.
+const POST_EXTENSIONS = parser.CommonExtensions | parser.AutoHeadingIDs
+
+// Renderer turns markdown into HTML that's safe to serve. Whatever the
+// markdown renders to is run through an allow-list so raw HTML in a post
+// can't add scripts or handlers for readers. Posts are kept once they're
+// rendered, tagged with a digest of the revision they came from so an edit
+// is rendered again.
+type Renderer struct {
+	base *url.URL
+
+	mu        sync.RWMutex
+	posts     map[renderKey]cachedRender
+	lastSweep time.Time
+}
+
+type renderKey struct {
+	id       string
+	absolute bool
+}
+
+type cachedRender struct {
+	digest    string
+	html      template.HTML
+	expiresAt time.Time
+}
+
+// NewRenderer makes a renderer for the site at baseUrl, links to anywhere
+// else are marked nofollow.
+func NewRenderer(baseUrl string) *Renderer {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Renderer{
+		base:      base,
+		posts:     make(map[renderKey]cachedRender),
+		lastSweep: time.Now(),
+	}
+}
+
+// RenderPost implements services.RenderService.
+func (self *Renderer) RenderPost(id, content string, absolute bool) template.HTML {
+	key := renderKey{id: id, absolute: absolute}
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+
+	self.mu.RLock()
+	cached, ok := self.posts[key]
+	self.mu.RUnlock()
+
+	now := time.Now()
+	if ok && cached.digest == digest && now.Before(cached.expiresAt) {
+		return cached.html
+	}
+
+	result := self.render(content, absolute)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if now.Sub(self.lastSweep) > RENDER_TTL {
+		for key, entry := range self.posts {
+			if now.After(entry.expiresAt) {
+				delete(self.posts, key)
+			}
+		}
+		self.lastSweep = now
+	}
+
+	self.posts[key] = cachedRender{
+		digest:    digest,
+		html:      result,
+		expiresAt: now.Add(RENDER_TTL),
+	}
+
+	return result
+}
+
+// RenderPreview implements services.RenderService. Previews change with
+// every key the author types so they aren't kept.
+func (self *Renderer) RenderPreview(content string) template.HTML {
+	return self.render(content, false)
+}
+
+// References implements services.RenderService. Only markdown links and
+// images are found, raw HTML ones are left to the allow-list.
+func (self *Renderer) References(content string) models.References {
+	var references models.References
+	document := markdown.Parse([]byte(content), parser.NewWithExtensions(POST_EXTENSIONS))
+	ast.WalkFunc(document, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+
+		switch node := node.(type) {
+		case *ast.Link:
+			references.Links = append(references.Links, string(node.Destination))
+		case *ast.Image:
+			references.Images = append(references.Images, string(node.Destination))
+		case *ast.Heading:
+			if node.HeadingID != "" {
+				references.Anchors = append(references.Anchors, node.HeadingID)
+			}
+		}
+
+		return ast.GoToNext
+	})
+
+	return references
+}
+
+func (self *Renderer) render(content string, absolute bool) template.HTML {
+	renderer := html.NewRenderer(html.RendererOptions{
+		Flags:          html.CommonFlags,
+		RenderNodeHook: renderHook,
+	})
+
+	rendered := markdown.ToHTML([]byte(content), parser.NewWithExtensions(POST_EXTENSIONS), renderer)
+
+	return template.HTML(self.rewriteLinks(postPolicy.SanitizeBytes(rendered), absolute))
+}
+
+// RenderComment implements services.RenderService. Raw HTML is dropped
+// before the allow-list even sees it and every link is nofollow since
+// anyone can leave a comment.
+func (self *Renderer) RenderComment(content string) template.HTML {
+	renderer := html.NewRenderer(html.RendererOptions{
+		Flags: html.CommonFlags | html.SkipHTML | html.Safelink | html.NofollowLinks,
+	})
+
+	rendered := markdown.ToHTML([]byte(content), parser.NewWithExtensions(parser.CommonExtensions), renderer)
+
+	return template.HTML(commentPolicy.SanitizeBytes(rendered))
+}
+
+// renderHook adds an anchor to each heading and highlights code blocks
+// that say what language they're in.
+func renderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	switch node := node.(type) {
+	case *ast.Heading:
+		if entering || node.HeadingID == "" {
+			return ast.GoToNext, false
+		}
+
+		fmt.Fprintf(
+			w,
+			`<a class="anchor" href="#%s">#</a></h%d>`+"\n",
+			template.HTMLEscapeString(node.HeadingID),
+			node.Level,
+		)
+		return ast.GoToNext, true
+	case *ast.CodeBlock:
+		fields := strings.Fields(string(node.Info))
+		if len(fields) == 0 {
+			return ast.GoToNext, false
+		}
+
+		lexer := lexers.Get(fields[0])
+		if lexer == nil {
+			return ast.GoToNext, false
+		}
+
+		iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(node.Literal))
+		if err != nil {
+			return ast.GoToNext, false
+		}
+
+		// Styles are written inline, the allow-list keeps only colors and
+		// font styles
+		formatter := chromahtml.New(chromahtml.WithClasses(false))
+		if err := formatter.Format(w, styles.Get(HIGHLIGHT_STYLE), iterator); err != nil {
+			panic(err)
+		}
+		return ast.GoToNext, true
+	}
+
+	return ast.GoToNext, false
+}
+
+// rewriteLinks marks links off the site nofollow, and when absolute is set
+// resolves relative links and images against the site for readers like
+// feeds that don't know where the post came from. It runs after the
+// allow-list so it only sees attributes that have already been cleaned.
+func (self *Renderer) rewriteLinks(sanitized []byte, absolute bool) []byte {
+	var out bytes.Buffer
+	tokenizer := xhtml.NewTokenizer(bytes.NewReader(sanitized))
+	for {
+		if tokenizer.Next() == xhtml.ErrorToken {
+			return out.Bytes()
+		}
+
+		token := tokenizer.Token()
+		if token.Type == xhtml.StartTagToken || token.Type == xhtml.SelfClosingTagToken {
+			switch token.Data {
+			case "a":
+				token.Attr = self.linkAttrs(token.Attr, "href", absolute, true)
+			case "img":
+				token.Attr = self.linkAttrs(token.Attr, "src", absolute, false)
+			}
+		}
+
+		out.WriteString(token.String())
+	}
+}
+
+func (self *Renderer) linkAttrs(attrs []xhtml.Attribute, key string, absolute, markExternal bool) []xhtml.Attribute {
+	for i := range attrs {
+		if attrs[i].Key != key {
+			continue
+		}
+
+		link, err := url.Parse(attrs[i].Val)
+		if err != nil {
+			return attrs
+		}
+
+		// Links to a heading within the post are left alone
+		if absolute && !link.IsAbs() && link.Host == "" && !strings.HasPrefix(attrs[i].Val, "#") {
+			link = self.base.ResolveReference(link)
+			attrs[i].Val = link.String()
+		}
+
+		if markExternal && link.Host != "" && link.Host != self.base.Host {
+			attrs = append(attrs, xhtml.Attribute{Key: "rel", Val: "nofollow"})
+		}
+
+		return attrs
+	}
+
+	return attrs
+}
+
+// var _ services.RenderService = (*Renderer)(nil)
@@ -15,6 +15,22 @@ import (
 	"github.com/jhamill34/notion-provisioner/internal/services"
 )
 
+// ApplicationResources are the resources and actions enforced by ApplicationRepository.
+var ApplicationResources = []models.ResourceDefinition{
+	{Pattern: "/oauth/application", Actions: []string{"create", "list"}},
+	{Pattern: "/oauth/application/{id}", Actions: []string{"read", "update", "delete"}},
+	{Pattern: "/oauth/application/{id}/secret", Actions: []string{"update"}},
+	{Pattern: "/oauth/application/{id}/scopes", Actions: []string{"update"}},
+}
+
+// ClientScopes are the scopes an application can be granted for tokens
+// issued with the client_credentials grant.
+var ClientScopes = []string{
+	"policy:read",
+	"scim",
+	"user:read",
+}
+
 type ApplicationRepository struct {
 	appDao               *dao.ApplicationDao
 	accessControlService services.AccessControlService
@@ -22,6 +38,7 @@ type ApplicationRepository struct {
 	tokenClaimService    services.TokenClaimsService
 	signer               services.Signer
 	accessTokenConfig    config.AccessTokenConfiguration
+	auditService         services.AuditService
 }
 
 func NewApplicationRepository(
@@ -31,6 +48,7 @@ func NewApplicationRepository(
 	tokenClaimService services.TokenClaimsService,
 	signer services.Signer,
 	accessTokenConfig config.AccessTokenConfiguration,
+	auditService services.AuditService,
 ) *ApplicationRepository {
 	return &ApplicationRepository{
 		appDao:               appDao,
@@ -39,6 +57,7 @@ func NewApplicationRepository(
 		tokenClaimService:    tokenClaimService,
 		signer:               signer,
 		accessTokenConfig:    accessTokenConfig,
+		auditService:         auditService,
 	}
 }
 
@@ -56,6 +75,12 @@ func (self *ApplicationRepository) CreateApp(
 		panic(err)
 	}
 
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditAppCreate,
+		Target: "/oauth/application/" + app.AppId,
+		Detail: app.Name,
+	})
+
 	return app, nil
 }
 
@@ -83,6 +108,7 @@ func (self *ApplicationRepository) saveApp(ctx context.Context, clientId, client
 		RedirectUri: app.RedirectUri,
 		Name:        app.Name,
 		Description: app.Description,
+		Scopes:      strings.Fields(app.Scopes),
 	}, nil
 }
 
@@ -96,6 +122,39 @@ func (self *ApplicationRepository) DeleteApp(ctx context.Context, id string) mod
 		panic(err)
 	}
 
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditAppDelete,
+		Target: "/oauth/application/" + id,
+	})
+
+	return nil
+}
+
+// UpdateApp implements services.ApplicationService.
+func (self *ApplicationRepository) UpdateApp(
+	ctx context.Context,
+	id, redirectUri, name, description string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/oauth/application/"+id, "update"); err != nil {
+		return err
+	}
+
+	if _, err := self.appDao.FindById(ctx, id); err == database.NotFound {
+		return services.AppNotFound
+	} else if err != nil {
+		panic(err)
+	}
+
+	if err := self.appDao.Update(ctx, id, redirectUri, name, description); err != nil {
+		panic(err)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditAppUpdate,
+		Target: "/oauth/application/" + id,
+		Detail: name,
+	})
+
 	return nil
 }
 
@@ -122,6 +181,7 @@ func (self *ApplicationRepository) GetApp(
 		RedirectUri: app.RedirectUri,
 		Name:        app.Name,
 		Description: app.Description,
+		Scopes:      strings.Fields(app.Scopes),
 	}, nil
 }
 
@@ -148,6 +208,7 @@ func (self *ApplicationRepository) GetAppByClientId(
 		RedirectUri: app.RedirectUri,
 		Name:        app.Name,
 		Description: app.Description,
+		Scopes:      strings.Fields(app.Scopes),
 	}, nil
 }
 
@@ -162,16 +223,23 @@ func (self *ApplicationRepository) ListApps(ctx context.Context) ([]models.App,
 		panic(err)
 	}
 
+	resources := make([]string, len(data))
+	for i, app := range data {
+		resources[i] = "/oauth/application/" + app.Id
+	}
+	allowed := self.accessControlService.EnforceMany(ctx, resources, "read", nil)
+
 	apps := make([]models.App, len(data))
 	i := 0
-	for _, app := range data {
-		if err := self.accessControlService.Enforce(ctx, "/oauth/application/"+app.Id, "read"); err == nil {
+	for j, app := range data {
+		if allowed[j] {
 			apps[i] = models.App{
 				AppId:       app.Id,
 				ClientId:    app.ClientId,
 				RedirectUri: app.RedirectUri,
 				Name:        app.Name,
 				Description: app.Description,
+				Scopes:      strings.Fields(app.Scopes),
 			}
 
 			i++
@@ -200,9 +268,41 @@ func (self *ApplicationRepository) NewSecret(
 		panic(err)
 	}
 
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditAppSecret,
+		Target: "/oauth/application/" + id,
+	})
+
 	return clientSecret, nil
 }
 
+// SetSecret implements services.ApplicationService. It's NewSecret for
+// callers that manage the secret themselves.
+func (self *ApplicationRepository) SetSecret(
+	ctx context.Context,
+	id, clientSecret string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/oauth/application/"+id+"/secret", "update"); err != nil {
+		return err
+	}
+
+	hashedClientSecret, err := createHash(self.passwordConfig, clientSecret)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := self.appDao.UpdateSecret(ctx, id, hashedClientSecret); err != nil {
+		panic(err)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditAppSecret,
+		Target: "/oauth/application/" + id,
+	})
+
+	return nil
+}
+
 type AuthCodeClaims struct {
 	UserId string `json:"UserId"`
 	AppId  string `json:"AppId"`
@@ -270,6 +370,7 @@ func (self *ApplicationRepository) ValidateAppSecret(
 		RedirectUri: app.RedirectUri,
 		Name:        app.Name,
 		Description: app.Description,
+		Scopes:      strings.Fields(app.Scopes),
 	}, nil
 }
 
@@ -282,6 +383,124 @@ func (self *ApplicationRepository) NewAccessToken(
 	ctx context.Context,
 	userId, clientId, refreshToken string,
 ) (*models.AccessTokenResponse, models.Notifier) {
+	claims := models.AccessTokenClaims{
+		Sub: userId,
+		Aud: clientId,
+		Iss: "auth",
+		Exp: int64(self.accessTokenConfig.TTL.Seconds()),
+		Iat: time.Now().Unix(),
+	}
+
+	if self.accessTokenConfig.EmbedPolicy {
+		claims.Pol = self.accessControlService.PolicyClaim(ctx, userId)
+	}
+
+	accessToken := self.signClaims(claims)
+
+	if refreshToken == "" {
+		refreshToken = uuid.New().String()
+		if err := self.appDao.CreateRefreshToken(ctx, userId, clientId, refreshToken); err != nil {
+			panic(err)
+		}
+	}
+
+	return &models.AccessTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expires:      int64(self.accessTokenConfig.TTL.Seconds()),
+	}, nil
+}
+
+// NewClientToken implements services.ApplicationService.
+// The app authenticates as itself and receives a token for the requested
+// scopes, or every scope it has been granted when none are requested.
+// There is no refresh token, the client simply asks for a new one.
+func (self *ApplicationRepository) NewClientToken(
+	ctx context.Context,
+	clientId, clientSecret string,
+	scopes []string,
+) (*models.AccessTokenResponse, models.Notifier) {
+	app, err := self.appDao.FindByClientId(ctx, clientId)
+	if err == database.NotFound {
+		return nil, services.InvalidClientCredentials
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	ok, err := comparePasswords(clientSecret, app.HashedClientSecret)
+	if err != nil {
+		panic(err)
+	}
+
+	if !ok {
+		return nil, services.InvalidClientCredentials
+	}
+
+	granted := strings.Fields(app.Scopes)
+	if len(scopes) == 0 {
+		scopes = granted
+	}
+
+	for _, scope := range scopes {
+		if !containsScope(granted, scope) {
+			return nil, services.ScopeNotGranted
+		}
+	}
+
+	claims := models.AccessTokenClaims{
+		Sub:   app.Id,
+		Aud:   app.ClientId,
+		Iss:   "auth",
+		Exp:   int64(self.accessTokenConfig.TTL.Seconds()),
+		Iat:   time.Now().Unix(),
+		Typ:   "client",
+		Scope: strings.Join(scopes, " "),
+	}
+
+	return &models.AccessTokenResponse{
+		AccessToken: self.signClaims(claims),
+		Expires:     int64(self.accessTokenConfig.TTL.Seconds()),
+	}, nil
+}
+
+// UpdateScopes implements services.ApplicationService.
+func (self *ApplicationRepository) UpdateScopes(
+	ctx context.Context,
+	id string,
+	scopes []string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/oauth/application/"+id+"/scopes", "update"); err != nil {
+		return err
+	}
+
+	for _, scope := range scopes {
+		if !containsScope(ClientScopes, scope) {
+			return services.UnknownScope
+		}
+	}
+
+	if _, err := self.appDao.FindById(ctx, id); err == database.NotFound {
+		return services.AppNotFound
+	} else if err != nil {
+		panic(err)
+	}
+
+	if err := self.appDao.UpdateScopes(ctx, id, strings.Join(scopes, " ")); err != nil {
+		panic(err)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditAppScopes,
+		Target: "/oauth/application/" + id,
+		Detail: strings.Join(scopes, " "),
+	})
+
+	return nil
+}
+
+func (self *ApplicationRepository) signClaims(claims models.AccessTokenClaims) string {
 	header := AccessTokenHeader{
 		Alg: "RS256",
 		Typ: "JWT",
@@ -292,13 +511,6 @@ func (self *ApplicationRepository) NewAccessToken(
 	}
 	headerString := base64.RawURLEncoding.EncodeToString(headerBytes)
 
-	claims := models.AccessTokenClaims{
-		Sub: userId,
-		Aud: clientId,
-		Iss: "auth",
-		Exp: int64(self.accessTokenConfig.TTL.Seconds()),
-		Iat: time.Now().Unix(),
-	}
 	claimsBytes, err := json.Marshal(claims)
 	if err != nil {
 		panic(err)
@@ -307,19 +519,21 @@ func (self *ApplicationRepository) NewAccessToken(
 
 	paylaod := headerString + "." + claimsString
 	signature, err := self.signer.Sign([]byte(paylaod))
+	if err != nil {
+		panic(err)
+	}
 
-	if refreshToken == "" {
-		refreshToken = uuid.New().String()
-		if err := self.appDao.CreateRefreshToken(ctx, userId, clientId, refreshToken); err != nil {
-			panic(err)
+	return paylaod + "." + signature
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, candidate := range scopes {
+		if candidate == scope {
+			return true
 		}
 	}
 
-	return &models.AccessTokenResponse{
-		AccessToken:  paylaod + "." + signature,
-		RefreshToken: refreshToken,
-		Expires:      int64(self.accessTokenConfig.TTL.Seconds()),
-	}, nil
+	return false
 }
 
 func (self *ApplicationRepository) VerifyAccessToken(ctx context.Context, accessToken string) bool {
@@ -0,0 +1,187 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+)
+
+// AuditResources are the resources and actions enforced by AuditRepository.
+var AuditResources = []models.ResourceDefinition{
+	{Pattern: "/audit", Actions: []string{"list", "export"}},
+}
+
+const (
+	AuditLogin           = "auth.login"
+	AuditLoginFailed     = "auth.login_failed"
+	AuditPasswordChange  = "auth.password_change"
+	AuditPasswordReset   = "auth.password_reset"
+	AuditPasswordToken   = "auth.password_reset_requested"
+	AuditUserInvite      = "auth.invite"
+	AuditPolicyCreate    = "policy.create"
+	AuditPolicyDelete    = "policy.delete"
+	AuditPolicySetCreate = "policyset.create"
+	AuditPolicySetDelete = "policyset.delete"
+	AuditPolicySetAttach = "policyset.attach"
+	AuditPolicySetDetach = "policyset.detach"
+	AuditPolicySetImport = "policyset.import"
+	AuditOrgInvite       = "org.invite"
+	AuditOrgJoin         = "org.join"
+	AuditOrgRemoveUser   = "org.remove_user"
+	AuditOrgAddUser      = "org.add_user"
+	AuditOrgUpdate       = "org.update"
+	AuditAppCreate       = "app.create"
+	AuditAppDelete       = "app.delete"
+	AuditAppUpdate       = "app.update"
+	AuditAppSecret       = "app.secret_rotate"
+	AuditAppScopes       = "app.scopes_update"
+	AuditWebhookCreate   = "webhook.create"
+	AuditWebhookDelete   = "webhook.delete"
+
+	AuditScimUserCreate     = "scim.user_create"
+	AuditScimUserUpdate     = "scim.user_update"
+	AuditScimUserActivate   = "scim.user_activate"
+	AuditScimUserDeactivate = "scim.user_deactivate"
+	AuditScimGroupCreate    = "scim.group_create"
+	AuditScimGroupUpdate    = "scim.group_update"
+	AuditScimGroupDelete    = "scim.group_delete"
+)
+
+// Only the newest entries are shown when listing, exports have no limit.
+const AUDIT_LIST_LIMIT = 200
+
+type AuditRepository struct {
+	auditLogDao          *dao.AuditLogDao
+	accessControlService services.AccessControlService
+}
+
+func NewAuditRepository(
+	auditLogDao *dao.AuditLogDao,
+	accessControlService services.AccessControlService,
+) *AuditRepository {
+	return &AuditRepository{
+		auditLogDao:          auditLogDao,
+		accessControlService: accessControlService,
+	}
+}
+
+// Record implements services.AuditService.
+func (self *AuditRepository) Record(ctx context.Context, event models.AuditEvent) {
+	actor := event.Actor
+	if actor == "" {
+		actor = auditActor(ctx)
+	}
+
+	ip, _ := ctx.Value("request_ip").(string)
+	requestId, _ := ctx.Value("request_id").(string)
+
+	err := self.auditLogDao.Insert(ctx, &database.AuditLogEntity{
+		Actor:     actor,
+		Action:    event.Action,
+		Target:    event.Target,
+		Detail:    event.Detail,
+		Ip:        ip,
+		RequestId: requestId,
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// List implements services.AuditService.
+func (self *AuditRepository) List(
+	ctx context.Context,
+	filter models.AuditFilter,
+) ([]models.AuditEntry, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/audit", "list"); err != nil {
+		return nil, err
+	}
+
+	data, err := self.auditLogDao.List(ctx, auditLogFilter(filter), AUDIT_LIST_LIMIT)
+	if err != nil {
+		panic(err)
+	}
+
+	entries := make([]models.AuditEntry, len(data))
+	for i, entry := range data {
+		entries[i] = auditEntry(&entry)
+	}
+
+	return entries, nil
+}
+
+// Export implements services.AuditService.
+// Entries are written oldest first as JSON Lines.
+func (self *AuditRepository) Export(
+	ctx context.Context,
+	filter models.AuditFilter,
+	w io.Writer,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/audit", "export"); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	err := self.auditLogDao.Each(ctx, auditLogFilter(filter), func(entry *database.AuditLogEntity) error {
+		return encoder.Encode(auditEntry(entry))
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return nil
+}
+
+// auditActor identifies who is making the request, either a user or an
+// application using its own client token.
+func auditActor(ctx context.Context) string {
+	if userId, ok := ctx.Value("user_id").(string); ok && userId != "" {
+		return userId
+	}
+
+	if appId, ok := ctx.Value("client_app_id").(string); ok && appId != "" {
+		return "app:" + appId
+	}
+
+	return "anonymous"
+}
+
+func auditLogFilter(filter models.AuditFilter) database.AuditLogFilter {
+	return database.AuditLogFilter{
+		Actor:  filter.Actor,
+		Action: filter.Action,
+		Target: filter.Target,
+		Since:  filter.Since,
+		Until:  filter.Until,
+	}
+}
+
+func auditEntry(entry *database.AuditLogEntity) models.AuditEntry {
+	return models.AuditEntry{
+		Id:        entry.Id,
+		Actor:     entry.Actor,
+		Action:    entry.Action,
+		Target:    entry.Target,
+		Detail:    entry.Detail,
+		Ip:        entry.Ip,
+		RequestId: entry.RequestId,
+		CreatedAt: entry.CreatedAt,
+	}
+}
+
+func policyDetail(resource, action, effect, condition string) string {
+	detail := fmt.Sprintf("%s %s on %s", effect, action, resource)
+	if condition != "" {
+		detail += " when " + condition
+	}
+
+	return detail
+}
+
+// var _ services.AuditService = (*AuditRepository)(nil)
@@ -24,6 +24,8 @@ type AuthRepository struct {
 	templateService       services.TemplateService
 	passwordForgotService services.VerifyTokenService
 	inviteTokenService    services.TokenClaimsService
+	auditService          services.AuditService
+	eventEmitter          services.EventEmitter
 }
 
 func NewAuthRepository(
@@ -35,6 +37,8 @@ func NewAuthRepository(
 	templateService services.TemplateService,
 	passwordForgotService services.VerifyTokenService,
 	inviteTokenService services.TokenClaimsService,
+	auditService services.AuditService,
+	eventEmitter services.EventEmitter,
 ) *AuthRepository {
 	return &AuthRepository{
 		baseUrl:               baseUrl,
@@ -45,6 +49,8 @@ func NewAuthRepository(
 		templateService:       templateService,
 		passwordForgotService: passwordForgotService,
 		inviteTokenService:    inviteTokenService,
+		auditService:          auditService,
+		eventEmitter:          eventEmitter,
 	}
 }
 
@@ -57,6 +63,11 @@ func (repo *AuthRepository) LoginUser(
 	user, err := repo.userDao.FindByEmail(ctx, email)
 
 	if err == database.NotFound {
+		repo.auditService.Record(ctx, models.AuditEvent{
+			Action: AuditLoginFailed,
+			Target: email,
+			Detail: "unknown account",
+		})
 		return nil, services.InvalidPassword
 	}
 
@@ -70,13 +81,33 @@ func (repo *AuthRepository) LoginUser(
 	}
 
 	if !ok {
+		repo.auditService.Record(ctx, models.AuditEvent{
+			Action: AuditLoginFailed,
+			Target: "/user/" + user.Id,
+			Detail: "invalid password",
+		})
 		return nil, services.InvalidPassword
 	}
 
+	if !user.Active {
+		repo.auditService.Record(ctx, models.AuditEvent{
+			Action: AuditLoginFailed,
+			Target: "/user/" + user.Id,
+			Detail: "account disabled",
+		})
+		return nil, services.AccountDisabled
+	}
+
 	if !user.Verified {
 		return nil, services.UnverifiedUser
 	}
 
+	repo.auditService.Record(ctx, models.AuditEvent{
+		Actor:  user.Id,
+		Action: AuditLogin,
+		Target: "/user/" + user.Id,
+	})
+
 	return &models.User{
 		UserId: user.Id,
 		Email:  user.Email,
@@ -175,6 +206,15 @@ func (repo *AuthRepository) CreateUser(
 		repo.sendVerifyEmail(ctx, user)
 	}
 
+	repo.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type: models.EventUserRegistered,
+		Data: models.UserEventData{
+			UserId: user.Id,
+			Name:   user.Name,
+			Email:  user.Email,
+		},
+	})
+
 	return nil
 }
 
@@ -273,6 +313,11 @@ func (repo *AuthRepository) ChangePassword(
 		if err != nil {
 			panic(err)
 		}
+
+		repo.auditService.Record(ctx, models.AuditEvent{
+			Action: AuditPasswordChange,
+			Target: "/user/" + id,
+		})
 	} else {
 		return services.InvalidPassword
 	}
@@ -303,6 +348,12 @@ func (repo *AuthRepository) ChangePasswordWithToken(
 		panic(daoErr)
 	}
 
+	repo.auditService.Record(ctx, models.AuditEvent{
+		Actor:  id,
+		Action: AuditPasswordReset,
+		Target: "/user/" + id,
+	})
+
 	return nil
 }
 
@@ -320,6 +371,21 @@ func (repo *AuthRepository) VerifyUser(
 	if daoErr != nil {
 		panic(daoErr)
 	}
+
+	user, daoErr := repo.userDao.FindById(ctx, id)
+	if daoErr != nil {
+		panic(daoErr)
+	}
+
+	repo.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type: models.EventUserVerified,
+		Data: models.UserEventData{
+			UserId: user.Id,
+			Name:   user.Name,
+			Email:  user.Email,
+		},
+	})
+
 	return nil
 }
 
@@ -327,6 +393,11 @@ func (repo *AuthRepository) CreateForgotPasswordToken(
 	ctx context.Context,
 	userId string,
 ) string {
+	repo.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPasswordToken,
+		Target: "/user/" + userId,
+	})
+
 	return repo.passwordForgotService.Create(ctx, userId)
 }
 
@@ -361,6 +432,12 @@ func (repo *AuthRepository) InviteUser(
 
 	repo.emailService.SendEmail(ctx, email, "You have been invited", buffer.String())
 
+	repo.auditService.Record(ctx, models.AuditEvent{
+		Actor:  fromUserId,
+		Action: AuditUserInvite,
+		Target: email,
+	})
+
 	return nil
 }
 
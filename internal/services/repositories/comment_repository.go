@@ -0,0 +1,393 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+)
+
+// CommentResources are the resources and actions enforced by CommentRepository.
+var CommentResources = []models.ResourceDefinition{
+	{Pattern: "/blog/{id}/comment", Actions: []string{"create", "moderate"}},
+	{Pattern: "/blog/{id}/comment/{commentId}", Actions: []string{"moderate", "delete"}},
+}
+
+const MAX_COMMENT_LENGTH = 5000
+
+// How long sending the email to the post's author may take, it happens
+// after the comment has been saved.
+const COMMENT_EMAIL_TIMEOUT = 30 * time.Second
+
+type CommentRepository struct {
+	blogUrl              string
+	postDao              *dao.PostDao
+	commentDao           *dao.CommentDao
+	accessControlService services.AccessControlService
+	templateService      services.TemplateService
+	emailService         services.EmailSender
+	userDirectory        services.UserDirectory
+}
+
+// NewCommentRepository only emails authors about new comments when it has
+// both an email sender and a directory to find their address in.
+func NewCommentRepository(
+	blogUrl string,
+	postDao *dao.PostDao,
+	commentDao *dao.CommentDao,
+	accessControlService services.AccessControlService,
+	templateService services.TemplateService,
+	emailService services.EmailSender,
+	userDirectory services.UserDirectory,
+) *CommentRepository {
+	return &CommentRepository{
+		blogUrl:              blogUrl,
+		postDao:              postDao,
+		commentDao:           commentDao,
+		accessControlService: accessControlService,
+		templateService:      templateService,
+		emailService:         emailService,
+		userDirectory:        userDirectory,
+	}
+}
+
+// ListComments implements services.BlogCommentService. Everyone sees the
+// approved comments, users also see their own pending ones and moderators
+// see all of them.
+func (self *CommentRepository) ListComments(
+	ctx context.Context,
+	postId string,
+) (*models.CommentList, models.Notifier) {
+	post, notifier := self.visiblePost(ctx, postId)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	moderator := self.canModerate(ctx, post)
+	userId, _ := ctx.Value("user_id").(string)
+
+	data, err := self.commentDao.ListComments(ctx, post.Id)
+	if err != nil {
+		panic(err)
+	}
+
+	// Comments are oldest first so a parent is always placed before its
+	// replies, replies to hidden comments are hidden with them.
+	comments := make([]models.Comment, 0)
+	positions := make(map[string]int)
+	for i := range data {
+		comment := &data[i]
+
+		visible := moderator ||
+			comment.Status == models.CommentStatusApproved ||
+			(comment.Status == models.CommentStatusPending && comment.Author == userId)
+		if !visible {
+			continue
+		}
+
+		if comment.ParentId == nil {
+			positions[comment.Id] = len(comments)
+			comments = append(comments, commentModel(comment, userId))
+			continue
+		}
+
+		if position, ok := positions[*comment.ParentId]; ok {
+			parent := &comments[position]
+			parent.Replies = append(parent.Replies, commentModel(comment, userId))
+		}
+	}
+
+	return &models.CommentList{
+		Comments:  comments,
+		Moderator: moderator,
+	}, nil
+}
+
+// CreateComment implements services.BlogCommentService. Comments from
+// moderators are approved straight away, everyone else's wait for one.
+// The post's author is emailed about comments from anyone else.
+func (self *CommentRepository) CreateComment(
+	ctx context.Context,
+	postId string,
+	parentId string,
+	content string,
+) (*models.Comment, models.Notifier) {
+	post, notifier := self.visiblePost(ctx, postId)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if err := self.accessControlService.Enforce(ctx, "/blog/"+post.Id+"/comment", "create"); err != nil {
+		return nil, err
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, services.EmptyComment
+	}
+
+	if utf8.RuneCountInString(content) > MAX_COMMENT_LENGTH {
+		return nil, services.CommentTooLong
+	}
+
+	var parent *string
+	if parentId != "" {
+		comment, err := self.commentDao.GetComment(ctx, parentId)
+		if err == database.NotFound {
+			return nil, services.InvalidCommentParent
+		}
+
+		if err != nil {
+			panic(err)
+		}
+
+		if comment.PostId != post.Id ||
+			comment.ParentId != nil ||
+			comment.Status != models.CommentStatusApproved {
+			return nil, services.InvalidCommentParent
+		}
+
+		parent = &comment.Id
+	}
+
+	status := models.CommentStatusPending
+	if self.canModerate(ctx, post) {
+		status = models.CommentStatusApproved
+	}
+
+	userId := ctx.Value("user_id").(string)
+	commentId, err := self.commentDao.CreateComment(ctx, post.Id, parent, userId, content, status)
+	if err != nil {
+		panic(err)
+	}
+
+	comment, err := self.commentDao.GetComment(ctx, commentId)
+	if err != nil {
+		panic(err)
+	}
+
+	if post.Author != userId {
+		go self.notifyAuthor(post, comment)
+	}
+
+	result := commentModel(comment, userId)
+	return &result, nil
+}
+
+// SetCommentStatus implements services.BlogCommentService.
+func (self *CommentRepository) SetCommentStatus(
+	ctx context.Context,
+	postId string,
+	commentId string,
+	status string,
+) (*models.Comment, models.Notifier) {
+	if !validCommentStatus(status) {
+		return nil, services.InvalidCommentStatus
+	}
+
+	post, comment, notifier := self.findComment(ctx, postId, commentId)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	attrs := models.ResourceAttributes{Owner: post.Author}
+	resource := "/blog/" + post.Id + "/comment/" + comment.Id
+	if err := self.accessControlService.EnforceWithAttributes(ctx, resource, "moderate", attrs); err != nil {
+		return nil, err
+	}
+
+	if err := self.commentDao.SetStatus(ctx, comment.Id, status); err != nil {
+		panic(err)
+	}
+
+	comment.Status = status
+
+	userId, _ := ctx.Value("user_id").(string)
+	result := commentModel(comment, userId)
+	return &result, nil
+}
+
+// DeleteComment implements services.BlogCommentService. Users may delete
+// their own comments, deleting a comment also deletes its replies.
+func (self *CommentRepository) DeleteComment(
+	ctx context.Context,
+	postId string,
+	commentId string,
+) models.Notifier {
+	post, comment, notifier := self.findComment(ctx, postId, commentId)
+	if notifier != nil {
+		return notifier
+	}
+
+	resource := "/blog/" + post.Id + "/comment/" + comment.Id
+	err := self.accessControlService.EnforceWithAttributes(
+		ctx,
+		resource,
+		"delete",
+		models.ResourceAttributes{Owner: comment.Author},
+	)
+	if err != nil {
+		err = self.accessControlService.EnforceWithAttributes(
+			ctx,
+			resource,
+			"delete",
+			models.ResourceAttributes{Owner: post.Author},
+		)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := self.commentDao.DeleteComment(ctx, comment.Id); err != nil {
+		panic(err)
+	}
+
+	return nil
+}
+
+// visiblePost finds the post being commented on, posts that aren't public
+// yet are only found by users that can edit them.
+func (self *CommentRepository) visiblePost(ctx context.Context, id string) (*database.Post, models.Notifier) {
+	post, err := self.postDao.GetPost(ctx, id)
+	if err == database.NotFound {
+		return nil, services.PostNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	if isPublic(post, time.Now()) {
+		return post, nil
+	}
+
+	attrs := models.ResourceAttributes{Owner: post.Author}
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+post.Id, "update", attrs); err != nil {
+		return nil, services.PostNotFound
+	}
+
+	return post, nil
+}
+
+func (self *CommentRepository) findComment(
+	ctx context.Context,
+	postId string,
+	commentId string,
+) (*database.Post, *database.Comment, models.Notifier) {
+	post, notifier := self.visiblePost(ctx, postId)
+	if notifier != nil {
+		return nil, nil, notifier
+	}
+
+	comment, err := self.commentDao.GetComment(ctx, commentId)
+	if err == database.NotFound || (err == nil && comment.PostId != post.Id) {
+		return nil, nil, services.CommentNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return post, comment, nil
+}
+
+// canModerate is true when the current user may see and moderate every
+// comment on the post.
+func (self *CommentRepository) canModerate(ctx context.Context, post *database.Post) bool {
+	err := self.accessControlService.EnforceWithAttributes(
+		ctx,
+		"/blog/"+post.Id+"/comment",
+		"moderate",
+		models.ResourceAttributes{Owner: post.Author},
+	)
+
+	return err == nil
+}
+
+type CommentEmailData struct {
+	Title   string
+	Url     string
+	Content string
+	Status  string
+}
+
+// notifyAuthor emails the post's author about a new comment. It runs after
+// the request is done so failures are only logged.
+func (self *CommentRepository) notifyAuthor(post *database.Post, comment *database.Comment) {
+	if self.emailService == nil || self.userDirectory == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), COMMENT_EMAIL_TIMEOUT)
+	defer cancel()
+
+	to, err := self.userDirectory.GetEmail(ctx, post.Author)
+	if err != nil {
+		log.Printf("Unable to find the email for %s: %s", post.Author, err)
+		return
+	}
+
+	buffer := bytes.Buffer{}
+	err = self.templateService.Render(
+		&buffer,
+		"comment_email.html",
+		"layout",
+		models.NewTemplateData(CommentEmailData{
+			Title:   post.Title,
+			Url:     self.blogUrl + "/blog/" + post.Slug + "#comment-" + comment.Id,
+			Content: comment.Content,
+			Status:  comment.Status,
+		}),
+	)
+	if err != nil {
+		log.Printf("Unable to render the comment email: %s", err)
+		return
+	}
+
+	if err := self.emailService.SendEmail(ctx, to, "New comment on "+post.Title, buffer.String()); err != nil {
+		log.Printf("Unable to email %s about comment %s: %s", post.Author, comment.Id, err)
+	}
+}
+
+func validCommentStatus(status string) bool {
+	for _, known := range models.CommentStatuses {
+		if status == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func commentModel(comment *database.Comment, userId string) models.Comment {
+	createdAt, err := time.Parse(time.RFC3339, comment.CreatedAt)
+	if err != nil {
+		panic(err)
+	}
+
+	result := models.Comment{
+		Id:      comment.Id,
+		PostId:  comment.PostId,
+		Author:  comment.Author,
+		Content: comment.Content,
+		Status:  comment.Status,
+		Date:    createdAt.Format("Jan 2, 2006 15:04"),
+		Mine:    userId != "" && comment.Author == userId,
+	}
+
+	if comment.ParentId != nil {
+		result.ParentId = *comment.ParentId
+	}
+
+	return result
+}
+
+// var _ services.BlogCommentService = (*CommentRepository)(nil)
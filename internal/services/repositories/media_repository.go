@@ -0,0 +1,435 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/services/imaging"
+)
+
+// The largest file that can be uploaded, the same as the mediumblob
+// columns images used to be kept in.
+const MAX_MEDIA_SIZE = 16<<20 - 1
+
+// The most pixels an image can have, checked before it's decoded so a
+// small file can't take up gigabytes once it is.
+const MAX_IMAGE_PIXELS = 40 * 1000 * 1000
+
+// MEDIA_WIDTHS are the widths images are copied at for srcset, images
+// narrower than one of them aren't scaled up.
+var MEDIA_WIDTHS = []int{320, 640, 1280}
+
+// THUMBNAIL_WIDTH is the copy shown in lists of posts.
+const THUMBNAIL_WIDTH = 640
+
+type MediaRepository struct {
+	postDao              *dao.PostDao
+	mediaDao             *dao.MediaDao
+	accessControlService services.AccessControlService
+	blobStore            services.BlobStore
+}
+
+func NewMediaRepository(
+	postDao *dao.PostDao,
+	mediaDao *dao.MediaDao,
+	accessControlService services.AccessControlService,
+	blobStore services.BlobStore,
+) *MediaRepository {
+	return &MediaRepository{
+		postDao:              postDao,
+		mediaDao:             mediaDao,
+		accessControlService: accessControlService,
+		blobStore:            blobStore,
+	}
+}
+
+// UploadPostMedia implements services.MediaService. The upload is read
+// once to find its id, a file that's already been uploaded is only added
+// to the post.
+func (self *MediaRepository) UploadPostMedia(
+	ctx context.Context,
+	postId string,
+	r io.Reader,
+	cover bool,
+) (*models.Media, models.Notifier) {
+	post, notifier := self.editablePost(ctx, postId)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	media, notifier := self.storeMedia(ctx, r, ctx.Value("user_id").(string))
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if err := self.mediaDao.AddPostMedia(ctx, post.Id, media.Id, cover); err != nil {
+		panic(err)
+	}
+
+	result := mediaModel(media)
+	result.Cover = cover || (post.ImageId != nil && *post.ImageId == media.Id)
+	result.Variants = self.mediaVariants(ctx, media.Id)[media.Id]
+
+	return &result, nil
+}
+
+// ListPostMedia implements services.MediaService. The media is found the
+// same as the post, unpublished posts only by users that can edit them.
+func (self *MediaRepository) ListPostMedia(
+	ctx context.Context,
+	postId string,
+) ([]models.Media, models.Notifier) {
+	post, err := self.postDao.GetPost(ctx, postId)
+	if err == database.NotFound {
+		return nil, services.PostNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	if !isPublic(post, time.Now()) {
+		attrs := models.ResourceAttributes{Owner: post.Author}
+		if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+post.Id, "update", attrs); err != nil {
+			return nil, services.PostNotFound
+		}
+	}
+
+	data, err := self.mediaDao.ListPostMedia(ctx, post.Id)
+	if err != nil {
+		panic(err)
+	}
+
+	ids := make([]string, len(data))
+	for i := range data {
+		ids[i] = data[i].Id
+	}
+
+	variants := self.mediaVariants(ctx, ids...)
+	media := make([]models.Media, len(data))
+	for i := range data {
+		media[i] = mediaModel(&data[i])
+		media[i].Cover = post.ImageId != nil && *post.ImageId == data[i].Id
+		media[i].Variants = variants[data[i].Id]
+	}
+
+	return media, nil
+}
+
+// RemovePostMedia implements services.MediaService.
+func (self *MediaRepository) RemovePostMedia(
+	ctx context.Context,
+	postId string,
+	mediaId string,
+) models.Notifier {
+	post, notifier := self.editablePost(ctx, postId)
+	if notifier != nil {
+		return notifier
+	}
+
+	err := self.mediaDao.RemovePostMedia(ctx, post.Id, mediaId)
+	if err == database.NotFound {
+		return services.MediaNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return nil
+}
+
+// OpenMedia implements services.MediaService. Anyone can read media, the
+// id can only be known by having the file or being shown it.
+func (self *MediaRepository) OpenMedia(
+	ctx context.Context,
+	id string,
+) (*models.Media, io.ReadCloser, models.Notifier) {
+	media, err := self.mediaDao.GetMedia(ctx, id)
+	if err == database.NotFound {
+		return nil, nil, services.MediaNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	blob, err := self.blobStore.Get(ctx, media.Id)
+	if err == services.BlobNotFound {
+		log.Printf("Media %s is missing from the blob store", media.Id)
+		return nil, nil, services.MediaNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	result := mediaModel(media)
+	return &result, blob, nil
+}
+
+// ImportPostImages moves images still stored in post rows into the blob
+// store, each becomes the image of its post. Images that can't be read are
+// logged and left where they are.
+func (self *MediaRepository) ImportPostImages(ctx context.Context) {
+	ids, err := self.postDao.ListLegacyImages(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, id := range ids {
+		legacy, err := self.postDao.GetLegacyImage(ctx, id)
+		if err == database.NotFound {
+			continue
+		}
+
+		if err != nil {
+			panic(err)
+		}
+
+		media, notifier := self.storeMedia(ctx, bytes.NewReader(legacy.Image), legacy.Author)
+		if notifier != nil {
+			log.Printf("Unable to import the image for post %s: %s", id, notifier.Notify().Message)
+			continue
+		}
+
+		if err := self.mediaDao.AddPostMedia(ctx, id, media.Id, true); err != nil {
+			panic(err)
+		}
+
+		if err := self.postDao.ClearLegacyImage(ctx, id); err != nil {
+			panic(err)
+		}
+
+		log.Printf("Imported the image for post %s as %s", id, media.Id)
+	}
+}
+
+func (self *MediaRepository) editablePost(ctx context.Context, id string) (*database.Post, models.Notifier) {
+	post, err := self.postDao.GetPost(ctx, id)
+	if err == database.NotFound {
+		return nil, services.PostNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	attrs := models.ResourceAttributes{Owner: post.Author}
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+post.Id+"/upload", "update", attrs); err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// storeMedia decodes an upload and saves it along with a copy at each of
+// MEDIA_WIDTHS narrower than it. It's spooled to a temporary file first so
+// large uploads aren't held in memory. PNGs and JPEGs are saved from their
+// pixels which leaves out any metadata, GIFs are kept as they are so
+// they're still animated.
+func (self *MediaRepository) storeMedia(
+	ctx context.Context,
+	r io.Reader,
+	createdBy string,
+) (*database.Media, models.Notifier) {
+	file, err := os.CreateTemp("", "media-*")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := io.Copy(file, io.LimitReader(r, MAX_MEDIA_SIZE+1))
+	if err != nil {
+		return nil, services.InvalidMedia
+	}
+
+	if size > MAX_MEDIA_SIZE {
+		return nil, services.MediaTooLarge
+	}
+
+	rewind(file)
+	img, mimeType, err := imaging.Decode(file, MAX_IMAGE_PIXELS)
+	switch err {
+	case nil:
+	case imaging.Unsupported:
+		return nil, services.InvalidMimeType
+	case imaging.TooManyPixels:
+		return nil, services.ImageTooLarge
+	case imaging.Invalid:
+		return nil, services.InvalidMedia
+	default:
+		panic(err)
+	}
+
+	var id string
+	if mimeType == "image/gif" {
+		rewind(file)
+		id, size = self.writeBlob(ctx, func(w io.Writer) error {
+			_, err := io.Copy(w, file)
+			return err
+		})
+	} else {
+		id, size = self.writeBlob(ctx, func(w io.Writer) error {
+			return imaging.Encode(w, img, mimeType)
+		})
+	}
+
+	existing, err := self.mediaDao.GetMedia(ctx, id)
+	if err == nil {
+		return existing, nil
+	}
+
+	if err != database.NotFound {
+		panic(err)
+	}
+
+	variantMime := mimeType
+	if mimeType == "image/gif" {
+		variantMime = "image/png"
+	}
+
+	var variants []database.MediaVariant
+	var thumbnailId *string
+	for i := len(MEDIA_WIDTHS) - 1; i >= 0; i-- {
+		width := MEDIA_WIDTHS[i]
+		if width >= img.Bounds().Dx() {
+			continue
+		}
+
+		resized := imaging.Resize(img, width)
+		variant := self.storeVariant(ctx, resized, variantMime, createdBy)
+		variants = append(variants, database.MediaVariant{Width: width, VariantId: variant.Id})
+
+		if thumbnailId == nil || width >= THUMBNAIL_WIDTH {
+			thumbnailId = &variant.Id
+		}
+	}
+
+	media := &database.Media{
+		Id:          id,
+		MimeType:    mimeType,
+		Size:        size,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		ThumbnailId: thumbnailId,
+		CreatedBy:   createdBy,
+	}
+
+	if err := self.mediaDao.CreateMedia(ctx, media, variants...); err != nil {
+		panic(err)
+	}
+
+	return media, nil
+}
+
+func (self *MediaRepository) storeVariant(
+	ctx context.Context,
+	img image.Image,
+	mimeType string,
+	createdBy string,
+) *database.Media {
+	id, size := self.writeBlob(ctx, func(w io.Writer) error {
+		return imaging.Encode(w, img, mimeType)
+	})
+
+	variant := &database.Media{
+		Id:        id,
+		MimeType:  mimeType,
+		Size:      size,
+		Width:     img.Bounds().Dx(),
+		Height:    img.Bounds().Dy(),
+		CreatedBy: createdBy,
+	}
+
+	if err := self.mediaDao.CreateMedia(ctx, variant); err != nil {
+		panic(err)
+	}
+
+	return variant
+}
+
+// writeBlob puts what write writes into the blob store under its sha256.
+func (self *MediaRepository) writeBlob(
+	ctx context.Context,
+	write func(w io.Writer) error,
+) (string, int64) {
+	file, err := os.CreateTemp("", "media-*")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	if err := write(io.MultiWriter(file, hash)); err != nil {
+		panic(err)
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		panic(err)
+	}
+
+	id := hex.EncodeToString(hash.Sum(nil))
+	rewind(file)
+	if err := self.blobStore.Put(ctx, id, file); err != nil {
+		panic(err)
+	}
+
+	return id, size
+}
+
+// mediaVariants finds the variants of each of the media.
+func (self *MediaRepository) mediaVariants(ctx context.Context, ids ...string) map[string][]models.MediaVariant {
+	data, err := self.mediaDao.ListVariants(ctx, ids...)
+	if err != nil {
+		panic(err)
+	}
+
+	variants := make(map[string][]models.MediaVariant)
+	for _, variant := range data {
+		variants[variant.MediaId] = append(variants[variant.MediaId], models.MediaVariant{
+			Id:    variant.VariantId,
+			Width: variant.Width,
+		})
+	}
+
+	return variants
+}
+
+func rewind(file *os.File) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		panic(err)
+	}
+}
+
+func mediaModel(media *database.Media) models.Media {
+	result := models.Media{
+		Id:       media.Id,
+		MimeType: media.MimeType,
+		Size:     media.Size,
+		Width:    media.Width,
+		Height:   media.Height,
+	}
+
+	if media.ThumbnailId != nil {
+		result.ThumbnailId = *media.ThumbnailId
+	}
+
+	return result
+}
+
+// var _ services.MediaService = (*MediaRepository)(nil)
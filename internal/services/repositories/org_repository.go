@@ -12,14 +12,27 @@ import (
 	"github.com/jhamill34/notion-provisioner/internal/services"
 )
 
+// OrganizationResources are the resources and actions enforced by OrganizationRepository.
+var OrganizationResources = []models.ResourceDefinition{
+	{Pattern: "/org", Actions: []string{"create", "list"}},
+	{Pattern: "/org/{id}", Actions: []string{"read", "update", "delete"}},
+	{Pattern: "/org/{id}/policy", Actions: []string{"create", "list"}},
+	{Pattern: "/org/{id}/policy/{policyId}", Actions: []string{"delete"}},
+	{Pattern: "/org/{id}/user", Actions: []string{"create", "list"}},
+	{Pattern: "/org/{id}/user/{userId}", Actions: []string{"delete"}},
+}
+
 type OrganizationRepository struct {
 	baseUrl              string
 	organizationDao      *dao.OrganizationDao
 	userDao              *dao.UserDao
 	accessControlService services.AccessControlService
+	policyValidator      services.PolicyValidator
 	tokenService         services.TokenClaimsService
 	emailService         services.EmailSender
 	templateService      services.TemplateService
+	auditService         services.AuditService
+	eventEmitter         services.EventEmitter
 }
 
 func NewOrganizationRepository(
@@ -27,18 +40,24 @@ func NewOrganizationRepository(
 	organizationDao *dao.OrganizationDao,
 	userDao *dao.UserDao,
 	accessControlService services.AccessControlService,
+	policyValidator services.PolicyValidator,
 	tokenService services.TokenClaimsService,
 	emailService services.EmailSender,
 	templateservice services.TemplateService,
+	auditService services.AuditService,
+	eventEmitter services.EventEmitter,
 ) *OrganizationRepository {
 	return &OrganizationRepository{
 		baseUrl:              baseUrl,
 		organizationDao:      organizationDao,
 		userDao:              userDao,
 		accessControlService: accessControlService,
+		policyValidator:      policyValidator,
 		tokenService:         tokenService,
 		emailService:         emailService,
 		templateService:      templateservice,
+		auditService:         auditService,
+		eventEmitter:         eventEmitter,
 	}
 }
 
@@ -55,11 +74,17 @@ func (self *OrganizationRepository) ListUsersOrgs(
 		panic(err)
 	}
 
+	resources := make([]string, len(data))
+	for i, org := range data {
+		resources[i] = "/org/" + org.Id
+	}
+	allowed := self.accessControlService.EnforceMany(ctx, resources, "read", nil)
+
 	orgs := make([]models.Organization, len(data))
 
 	i := 0
-	for _, org := range data {
-		if err := self.accessControlService.Enforce(ctx, "/org/"+org.Id, "read"); err == nil {
+	for j, org := range data {
+		if allowed[j] {
 			orgs[i] = models.Organization{
 				OrgId:       org.Id,
 				Name:        org.Name,
@@ -76,14 +101,18 @@ func (self *OrganizationRepository) ListUsersOrgs(
 func (self *OrganizationRepository) CreateOrganization(
 	ctx context.Context,
 	userId, name, description string,
-) models.Notifier {
+) (*models.Organization, models.Notifier) {
 	if err := self.accessControlService.Enforce(ctx, "/org", "create"); err != nil {
-		return err
+		return nil, err
 	}
 
 	orgId := uuid.New().String()
 
-	_, err := self.organizationDao.CreateOrganization(ctx, orgId, name, description)
+	org, err := self.organizationDao.CreateOrganization(ctx, orgId, name, description)
+	if err == database.Duplicate {
+		return nil, services.OrganizationNameInUse
+	}
+
 	if err != nil {
 		panic(err)
 	}
@@ -93,7 +122,11 @@ func (self *OrganizationRepository) CreateOrganization(
 		panic(err)
 	}
 
-	return nil
+	return &models.Organization{
+		OrgId:       org.Id,
+		Name:        org.Name,
+		Description: org.Description,
+	}, nil
 }
 
 // GetOrganizationBydId implements services.OrganizationService.
@@ -121,6 +154,69 @@ func (self *OrganizationRepository) GetOrganizationBydId(
 	}, nil
 }
 
+// ListOrganizations implements services.OrganizationService.
+func (self *OrganizationRepository) ListOrganizations(
+	ctx context.Context,
+) ([]models.Organization, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/org", "list"); err != nil {
+		return nil, err
+	}
+
+	data, err := self.organizationDao.List(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	resources := make([]string, len(data))
+	for i, org := range data {
+		resources[i] = "/org/" + org.Id
+	}
+	allowed := self.accessControlService.EnforceMany(ctx, resources, "read", nil)
+
+	orgs := make([]models.Organization, len(data))
+
+	i := 0
+	for j, org := range data {
+		if allowed[j] {
+			orgs[i] = models.Organization{
+				OrgId:       org.Id,
+				Name:        org.Name,
+				Description: org.Description,
+			}
+			i++
+		}
+	}
+
+	return orgs[:i], nil
+}
+
+// UpdateOrganization implements services.OrganizationService.
+func (self *OrganizationRepository) UpdateOrganization(
+	ctx context.Context,
+	id, description string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/org/"+id, "update"); err != nil {
+		return err
+	}
+
+	if _, err := self.organizationDao.FindById(ctx, id); err == database.NotFound {
+		return services.OrganizationNotFound
+	} else if err != nil {
+		panic(err)
+	}
+
+	if err := self.organizationDao.UpdateDescription(ctx, id, description); err != nil {
+		panic(err)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditOrgUpdate,
+		Target: "/org/" + id,
+	})
+
+	return nil
+}
+
 // DeleteOrganization implements services.OrganizationService.
 func (self *OrganizationRepository) DeleteOrganization(
 	ctx context.Context,
@@ -135,6 +231,11 @@ func (self *OrganizationRepository) DeleteOrganization(
 		panic(err)
 	}
 
+	err = self.organizationDao.RemoveAllPolicySets(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+
 	err = self.organizationDao.DeleteOrganization(ctx, id)
 	if err != nil {
 		panic(err)
@@ -164,10 +265,11 @@ func (self *OrganizationRepository) ListPolicies(
 	policies := make([]models.Policy, len(permissions))
 	for i := 0; i < len(policies); i++ {
 		policies[i] = models.Policy{
-			PolicyId: permissions[i].Id,
-			Resource: permissions[i].Resource,
-			Action:   permissions[i].Action,
-			Effect:   permissions[i].Effect,
+			PolicyId:  permissions[i].Id,
+			Resource:  permissions[i].Resource,
+			Action:    permissions[i].Action,
+			Effect:    permissions[i].Effect,
+			Condition: permissions[i].Condition,
 		}
 	}
 
@@ -181,16 +283,27 @@ func (self *OrganizationRepository) CreatePolicy(
 	resource string,
 	action string,
 	effect string,
+	condition string,
 ) models.Notifier {
 	if err := self.accessControlService.Enforce(ctx, "/org/"+orgId+"/policy", "create"); err != nil {
 		return err
 	}
 
-	err := self.organizationDao.CreatePermission(ctx, orgId, resource, action, effect)
+	if err := self.policyValidator.Validate(resource, action, effect, condition); err != nil {
+		return err
+	}
+
+	err := self.organizationDao.CreatePermission(ctx, orgId, resource, action, effect, condition)
 	if err != nil {
 		panic(err)
 	}
 
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicyCreate,
+		Target: "/org/" + orgId,
+		Detail: policyDetail(resource, action, effect, condition),
+	})
+
 	users, err := self.organizationDao.GetUsers(ctx, orgId)
 	if err != nil {
 		panic(err)
@@ -217,6 +330,12 @@ func (self *OrganizationRepository) DeletePolicy(
 		panic(err)
 	}
 
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicyDelete,
+		Target: "/org/" + orgId,
+		Detail: fmt.Sprintf("policy %d", policyId),
+	})
+
 	users, err := self.organizationDao.GetUsers(ctx, orgId)
 	if err != nil {
 		panic(err)
@@ -246,11 +365,16 @@ func (self *OrganizationRepository) ListUsers(
 		panic(err)
 	}
 
+	resources := make([]string, len(data))
+	for i, user := range data {
+		resources[i] = "/user/" + user.Id
+	}
+	allowed := self.accessControlService.EnforceMany(ctx, resources, "read", nil)
+
 	users := make([]models.User, len(data))
 	i := 0
-	for _, user := range data {
-		if err := self.accessControlService.Enforce(ctx, "/user/"+user.Id, "read"); err == nil &&
-			user.Name != "ROOT" {
+	for j, user := range data {
+		if allowed[j] && user.Name != "ROOT" {
 			users[i] = models.User{
 				UserId: user.Id,
 				Name:   user.Name,
@@ -315,6 +439,12 @@ func (self *OrganizationRepository) InviteUser(
 
 	self.emailService.SendEmail(ctx, user.Email, "You have been invited", buffer.String())
 
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditOrgInvite,
+		Target: "/org/" + orgId,
+		Detail: user.Id,
+	})
+
 	return nil
 }
 
@@ -345,6 +475,64 @@ func (self *OrganizationRepository) Join(
 
 	self.tokenService.Destroy(ctx, tokenId)
 	self.accessControlService.Invalidate(ctx, userId)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Actor:  userId,
+		Action: AuditOrgJoin,
+		Target: "/org/" + inviteData.InvitedBy,
+	})
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type:  models.EventOrgMemberJoined,
+		OrgId: inviteData.InvitedBy,
+		Data: models.OrgMemberEventData{
+			OrgId:  inviteData.InvitedBy,
+			UserId: userId,
+		},
+	})
+
+	return nil
+}
+
+// AddUser implements services.OrganizationService. Unlike InviteUser the
+// user becomes a member straight away.
+func (self *OrganizationRepository) AddUser(
+	ctx context.Context,
+	orgId string,
+	userId string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/org/"+orgId+"/user", "create"); err != nil {
+		return err
+	}
+
+	if _, err := self.organizationDao.FindById(ctx, orgId); err == database.NotFound {
+		return services.OrganizationNotFound
+	} else if err != nil {
+		panic(err)
+	}
+
+	if _, err := self.userDao.FindById(ctx, userId); err == database.NotFound {
+		return services.UserNotFound
+	} else if err != nil {
+		panic(err)
+	}
+
+	if err := self.organizationDao.AddUser(ctx, orgId, userId); err != nil {
+		panic(err)
+	}
+
+	self.accessControlService.Invalidate(ctx, userId)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditOrgAddUser,
+		Target: "/org/" + orgId,
+		Detail: userId,
+	})
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type:  models.EventOrgMemberJoined,
+		OrgId: orgId,
+		Data: models.OrgMemberEventData{
+			OrgId:  orgId,
+			UserId: userId,
+		},
+	})
 
 	return nil
 }
@@ -365,6 +553,19 @@ func (self *OrganizationRepository) RemoveUser(
 	}
 	
 	self.accessControlService.Invalidate(ctx, userId)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditOrgRemoveUser,
+		Target: "/org/" + orgId,
+		Detail: userId,
+	})
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type:  models.EventOrgMemberLeft,
+		OrgId: orgId,
+		Data: models.OrgMemberEventData{
+			OrgId:  orgId,
+			UserId: userId,
+		},
+	})
 
 	return nil
 }
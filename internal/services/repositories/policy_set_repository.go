@@ -0,0 +1,608 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicySetResources are the resources and actions enforced by PolicySetRepository.
+var PolicySetResources = []models.ResourceDefinition{
+	{Pattern: "/policyset", Actions: []string{"create", "list"}},
+	{Pattern: "/policyset/{id}", Actions: []string{"read", "update", "delete"}},
+	{Pattern: "/policyset/{id}/policy", Actions: []string{"create"}},
+	{Pattern: "/policyset/{id}/policy/{policyId}", Actions: []string{"delete"}},
+	{Pattern: "/policyset/{id}/user", Actions: []string{"create", "list"}},
+	{Pattern: "/policyset/{id}/user/{userId}", Actions: []string{"delete"}},
+	{Pattern: "/policyset/{id}/org", Actions: []string{"create", "list"}},
+	{Pattern: "/policyset/{id}/org/{orgId}", Actions: []string{"delete"}},
+}
+
+type PolicySetRepository struct {
+	policySetDao         *dao.PolicySetDao
+	userDao              *dao.UserDao
+	organizationDao      *dao.OrganizationDao
+	accessControlService services.AccessControlService
+	policyValidator      services.PolicyValidator
+	auditService         services.AuditService
+}
+
+func NewPolicySetRepository(
+	policySetDao *dao.PolicySetDao,
+	userDao *dao.UserDao,
+	organizationDao *dao.OrganizationDao,
+	accessControlService services.AccessControlService,
+	policyValidator services.PolicyValidator,
+	auditService services.AuditService,
+) *PolicySetRepository {
+	return &PolicySetRepository{
+		policySetDao:         policySetDao,
+		userDao:              userDao,
+		organizationDao:      organizationDao,
+		accessControlService: accessControlService,
+		policyValidator:      policyValidator,
+		auditService:         auditService,
+	}
+}
+
+// ListSets implements services.PolicySetService.
+func (self *PolicySetRepository) ListSets(ctx context.Context) ([]models.PolicySet, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/policyset", "list"); err != nil {
+		return nil, err
+	}
+
+	data, err := self.policySetDao.List(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	resources := make([]string, len(data))
+	for i, set := range data {
+		resources[i] = "/policyset/" + set.Id
+	}
+	allowed := self.accessControlService.EnforceMany(ctx, resources, "read", nil)
+
+	sets := make([]models.PolicySet, len(data))
+
+	i := 0
+	for j, set := range data {
+		if allowed[j] {
+			sets[i] = models.PolicySet{
+				SetId:       set.Id,
+				Name:        set.Name,
+				Description: set.Description,
+			}
+			i++
+		}
+	}
+
+	return sets[:i], nil
+}
+
+// GetSet implements services.PolicySetService.
+func (self *PolicySetRepository) GetSet(
+	ctx context.Context,
+	id string,
+) (*models.PolicySet, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id, "read"); err != nil {
+		return nil, err
+	}
+
+	return self.getSet(ctx, id)
+}
+
+// CreateSet implements services.PolicySetService.
+func (self *PolicySetRepository) CreateSet(
+	ctx context.Context,
+	name, description string,
+) (*models.PolicySet, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/policyset", "create"); err != nil {
+		return nil, err
+	}
+
+	set, err := self.policySetDao.Create(ctx, uuid.New().String(), name, description)
+	if err == database.Duplicate {
+		return nil, services.PolicySetNameInUse
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicySetCreate,
+		Target: "/policyset/" + set.Id,
+		Detail: set.Name,
+	})
+
+	return &models.PolicySet{
+		SetId:       set.Id,
+		Name:        set.Name,
+		Description: set.Description,
+		Policies:    []models.Policy{},
+	}, nil
+}
+
+// DeleteSet implements services.PolicySetService.
+func (self *PolicySetRepository) DeleteSet(ctx context.Context, id string) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id, "delete"); err != nil {
+		return err
+	}
+
+	affected := self.affectedUsers(ctx, id)
+
+	if err := self.policySetDao.Delete(ctx, id); err != nil {
+		panic(err)
+	}
+
+	self.invalidate(ctx, affected)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicySetDelete,
+		Target: "/policyset/" + id,
+	})
+
+	return nil
+}
+
+//==============================================================================
+// Policy Management
+//==============================================================================
+
+// CreatePolicy implements services.PolicySetService.
+func (self *PolicySetRepository) CreatePolicy(
+	ctx context.Context,
+	id, resource, action, effect, condition string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id+"/policy", "create"); err != nil {
+		return err
+	}
+
+	if _, err := self.getSet(ctx, id); err != nil {
+		return err
+	}
+
+	if err := self.policyValidator.Validate(resource, action, effect, condition); err != nil {
+		return err
+	}
+
+	if err := self.policySetDao.CreatePermission(ctx, id, resource, action, effect, condition); err != nil {
+		panic(err)
+	}
+
+	self.invalidate(ctx, self.affectedUsers(ctx, id))
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicyCreate,
+		Target: "/policyset/" + id,
+		Detail: policyDetail(resource, action, effect, condition),
+	})
+
+	return nil
+}
+
+// DeletePolicy implements services.PolicySetService.
+func (self *PolicySetRepository) DeletePolicy(
+	ctx context.Context,
+	id string,
+	policyId int,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, fmt.Sprintf("/policyset/%s/policy/%d", id, policyId), "delete"); err != nil {
+		return err
+	}
+
+	if err := self.policySetDao.DeletePermission(ctx, id, policyId); err != nil {
+		panic(err)
+	}
+
+	self.invalidate(ctx, self.affectedUsers(ctx, id))
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicyDelete,
+		Target: "/policyset/" + id,
+		Detail: fmt.Sprintf("policy %d", policyId),
+	})
+
+	return nil
+}
+
+//==============================================================================
+// Attachments
+//==============================================================================
+
+// ListUsers implements services.PolicySetService.
+func (self *PolicySetRepository) ListUsers(
+	ctx context.Context,
+	id string,
+) ([]models.User, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id+"/user", "list"); err != nil {
+		return nil, err
+	}
+
+	data, err := self.policySetDao.GetUsers(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+
+	users := make([]models.User, len(data))
+	for i, user := range data {
+		users[i] = models.User{
+			UserId: user.Id,
+			Name:   user.Name,
+			Email:  user.Email,
+		}
+	}
+
+	return users, nil
+}
+
+// ListOrgs implements services.PolicySetService.
+func (self *PolicySetRepository) ListOrgs(
+	ctx context.Context,
+	id string,
+) ([]models.Organization, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id+"/org", "list"); err != nil {
+		return nil, err
+	}
+
+	data, err := self.policySetDao.GetOrgs(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+
+	orgs := make([]models.Organization, len(data))
+	for i, org := range data {
+		orgs[i] = models.Organization{
+			OrgId:       org.Id,
+			Name:        org.Name,
+			Description: org.Description,
+		}
+	}
+
+	return orgs, nil
+}
+
+// AttachToUser implements services.PolicySetService.
+//
+// Attaching a set grants its policies, so the caller also needs
+// permission to create policies on the target user.
+func (self *PolicySetRepository) AttachToUser(
+	ctx context.Context,
+	id, userId string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id+"/user", "create"); err != nil {
+		return err
+	}
+
+	if err := self.accessControlService.Enforce(ctx, "/user/"+userId+"/policy", "create"); err != nil {
+		return err
+	}
+
+	if _, err := self.getSet(ctx, id); err != nil {
+		return err
+	}
+
+	_, err := self.userDao.FindById(ctx, userId)
+	if err == database.NotFound {
+		return services.UserNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = self.policySetDao.AttachUser(ctx, id, userId)
+	if err == database.Duplicate {
+		return services.PolicySetAlreadyAttached
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	self.accessControlService.Invalidate(ctx, userId)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicySetAttach,
+		Target: "/policyset/" + id,
+		Detail: "/user/" + userId,
+	})
+
+	return nil
+}
+
+// DetachFromUser implements services.PolicySetService.
+func (self *PolicySetRepository) DetachFromUser(
+	ctx context.Context,
+	id, userId string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id+"/user/"+userId, "delete"); err != nil {
+		return err
+	}
+
+	if err := self.policySetDao.DetachUser(ctx, id, userId); err != nil {
+		panic(err)
+	}
+
+	self.accessControlService.Invalidate(ctx, userId)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicySetDetach,
+		Target: "/policyset/" + id,
+		Detail: "/user/" + userId,
+	})
+
+	return nil
+}
+
+// AttachToOrg implements services.PolicySetService.
+//
+// Attaching a set grants its policies, so the caller also needs
+// permission to create policies on the target organization.
+func (self *PolicySetRepository) AttachToOrg(
+	ctx context.Context,
+	id, orgId string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id+"/org", "create"); err != nil {
+		return err
+	}
+
+	if err := self.accessControlService.Enforce(ctx, "/org/"+orgId+"/policy", "create"); err != nil {
+		return err
+	}
+
+	if _, err := self.getSet(ctx, id); err != nil {
+		return err
+	}
+
+	_, err := self.organizationDao.FindById(ctx, orgId)
+	if err == database.NotFound {
+		return services.OrganizationNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = self.policySetDao.AttachOrg(ctx, id, orgId)
+	if err == database.Duplicate {
+		return services.PolicySetAlreadyAttached
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	self.invalidateOrg(ctx, orgId)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicySetAttach,
+		Target: "/policyset/" + id,
+		Detail: "/org/" + orgId,
+	})
+
+	return nil
+}
+
+// DetachFromOrg implements services.PolicySetService.
+func (self *PolicySetRepository) DetachFromOrg(
+	ctx context.Context,
+	id, orgId string,
+) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id+"/org/"+orgId, "delete"); err != nil {
+		return err
+	}
+
+	if err := self.policySetDao.DetachOrg(ctx, id, orgId); err != nil {
+		panic(err)
+	}
+
+	self.invalidateOrg(ctx, orgId)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicySetDetach,
+		Target: "/policyset/" + id,
+		Detail: "/org/" + orgId,
+	})
+
+	return nil
+}
+
+//==============================================================================
+// Import / Export
+//==============================================================================
+
+type policySetDocument struct {
+	Name        string                    `yaml:"name"`
+	Description string                    `yaml:"description"`
+	Policies    []policySetDocumentPolicy `yaml:"policies"`
+}
+
+type policySetDocumentPolicy struct {
+	Resource  string `yaml:"resource"`
+	Action    string `yaml:"action"`
+	Effect    string `yaml:"effect"`
+	Condition string `yaml:"condition,omitempty"`
+}
+
+// Export implements services.PolicySetService.
+func (self *PolicySetRepository) Export(ctx context.Context, id string) ([]byte, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/policyset/"+id, "read"); err != nil {
+		return nil, err
+	}
+
+	set, notifier := self.getSet(ctx, id)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	document := policySetDocument{
+		Name:        set.Name,
+		Description: set.Description,
+		Policies:    make([]policySetDocumentPolicy, len(set.Policies)),
+	}
+
+	for i, policy := range set.Policies {
+		document.Policies[i] = policySetDocumentPolicy{
+			Resource:  policy.Resource,
+			Action:    policy.Action,
+			Effect:    policy.Effect,
+			Condition: policy.Condition,
+		}
+	}
+
+	data, err := yaml.Marshal(&document)
+	if err != nil {
+		panic(err)
+	}
+
+	return data, nil
+}
+
+// Import implements services.PolicySetService.
+//
+// A document whose name matches an existing set replaces that set's
+// description and policies, otherwise a new set is created.
+func (self *PolicySetRepository) Import(
+	ctx context.Context,
+	data []byte,
+) (*models.PolicySet, models.Notifier) {
+	var document policySetDocument
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, services.InvalidPolicySetDocument
+	}
+
+	document.Name = strings.TrimSpace(document.Name)
+	if document.Name == "" {
+		return nil, services.InvalidPolicySetDocument
+	}
+
+	permissions := make([]database.PolicySetPermissionEntity, len(document.Policies))
+	for i, policy := range document.Policies {
+		if policy.Resource == "" || policy.Action == "" {
+			return nil, services.InvalidPolicySetDocument
+		}
+
+		if policy.Effect == "" {
+			policy.Effect = "allow"
+		}
+
+		if err := self.policyValidator.Validate(policy.Resource, policy.Action, policy.Effect, policy.Condition); err != nil {
+			return nil, services.NewPolicySetServiceError(
+				fmt.Sprintf("Policy %d: %s", i+1, err.Notify().Message),
+			)
+		}
+
+		permissions[i] = database.PolicySetPermissionEntity{
+			Resource:  policy.Resource,
+			Action:    policy.Action,
+			Effect:    policy.Effect,
+			Condition: policy.Condition,
+		}
+	}
+
+	existing, err := self.policySetDao.FindByName(ctx, document.Name)
+	if err != nil && err != database.NotFound {
+		panic(err)
+	}
+
+	var id string
+	if existing != nil {
+		id = existing.Id
+		if err := self.accessControlService.Enforce(ctx, "/policyset/"+id, "update"); err != nil {
+			return nil, err
+		}
+
+		if err := self.policySetDao.UpdateDescription(ctx, id, document.Description); err != nil {
+			panic(err)
+		}
+	} else {
+		if err := self.accessControlService.Enforce(ctx, "/policyset", "create"); err != nil {
+			return nil, err
+		}
+
+		id = uuid.New().String()
+		if _, err := self.policySetDao.Create(ctx, id, document.Name, document.Description); err != nil {
+			panic(err)
+		}
+	}
+
+	if err := self.policySetDao.ReplacePermissions(ctx, id, permissions); err != nil {
+		panic(err)
+	}
+
+	self.invalidate(ctx, self.affectedUsers(ctx, id))
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicySetImport,
+		Target: "/policyset/" + id,
+		Detail: fmt.Sprintf("%s with %d policies", document.Name, len(permissions)),
+	})
+
+	return self.getSet(ctx, id)
+}
+
+//==============================================================================
+
+func (self *PolicySetRepository) getSet(
+	ctx context.Context,
+	id string,
+) (*models.PolicySet, models.Notifier) {
+	set, err := self.policySetDao.FindById(ctx, id)
+	if err == database.NotFound {
+		return nil, services.PolicySetNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	permissions, err := self.policySetDao.GetPermissions(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+
+	policies := make([]models.Policy, len(permissions))
+	for i, permission := range permissions {
+		policies[i] = models.Policy{
+			PolicyId:  permission.Id,
+			Resource:  permission.Resource,
+			Action:    permission.Action,
+			Effect:    permission.Effect,
+			Condition: permission.Condition,
+			Set:       set.Name,
+		}
+	}
+
+	return &models.PolicySet{
+		SetId:       set.Id,
+		Name:        set.Name,
+		Description: set.Description,
+		Policies:    policies,
+	}, nil
+}
+
+func (self *PolicySetRepository) affectedUsers(ctx context.Context, id string) []string {
+	ids, err := self.policySetDao.GetAffectedUserIds(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+
+	return ids
+}
+
+func (self *PolicySetRepository) invalidateOrg(ctx context.Context, orgId string) {
+	users, err := self.organizationDao.GetUsers(ctx, orgId)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, user := range users {
+		self.accessControlService.Invalidate(ctx, user.Id)
+	}
+}
+
+func (self *PolicySetRepository) invalidate(ctx context.Context, ids []string) {
+	for _, id := range ids {
+		self.accessControlService.Invalidate(ctx, id)
+	}
+}
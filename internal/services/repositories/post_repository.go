@@ -1,64 +1,211 @@
 package repositories
 
 import (
-	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
-	"image"
-	"image/jpeg"
-	"image/png"
-	"io"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jhamill34/notion-provisioner/internal/database"
 	"github.com/jhamill34/notion-provisioner/internal/database/dao"
 	"github.com/jhamill34/notion-provisioner/internal/models"
 	"github.com/jhamill34/notion-provisioner/internal/services"
-	"golang.org/x/image/draw"
+	"github.com/jhamill34/notion-provisioner/internal/services/diff"
+	"github.com/jhamill34/notion-provisioner/internal/services/search"
+	"github.com/jhamill34/notion-provisioner/internal/services/slug"
 )
 
+// PostResources are the resources and actions enforced by PostRepository.
+var PostResources = []models.ResourceDefinition{
+	{Pattern: "/blog", Actions: []string{"create"}},
+	{Pattern: "/blog/{id}", Actions: []string{"update", "delete"}},
+	{Pattern: "/blog/{id}/upload", Actions: []string{"update"}},
+	{Pattern: "/blog/{id}/status", Actions: []string{"update"}},
+	{Pattern: "/blog/{id}/revision", Actions: []string{"list"}},
+	{Pattern: "/blog/tag/{slug}", Actions: []string{"apply", "update"}},
+}
+
+// How many posts are on a page when the request doesn't say.
+const POST_PAGE_SIZE = 10
+
+const MAX_POST_PAGE_SIZE = 50
+
+// Only the best matches are shown for a search.
+const SEARCH_LIMIT = 20
+
+const MAX_POST_TAGS = 10
+
+const MAX_TAG_LENGTH = 64
+
+const MAX_SLUG_LENGTH = 255
+
+// RESERVED_SLUGS would be shadowed by other routes under /blog.
+var RESERVED_SLUGS = map[string]bool{
+	"new":    true,
+	"search": true,
+	"tag":    true,
+	"tags":   true,
+	"feed":   true,
+}
+
+// Feeds only carry the latest posts.
+const FEED_SIZE = 20
+
+// Roughly how many characters of the content are shown with each match.
+const SNIPPET_WIDTH = 200
+
 type PostRepository struct {
 	postDao              *dao.PostDao
+	postSearchDao        dao.PostSearchDao
+	tagDao               *dao.TagDao
 	accessControlService services.AccessControlService
+	eventEmitter         services.EventEmitter
+	userDirectory        services.UserDirectory
+	previewKey           []byte
+	previewTTL           time.Duration
 }
 
 func NewPostRepository(
 	postDao *dao.PostDao,
+	postSearchDao dao.PostSearchDao,
+	tagDao *dao.TagDao,
 	accessControlService services.AccessControlService,
+	eventEmitter services.EventEmitter,
+	userDirectory services.UserDirectory,
+	previewKey string,
+	previewTTL time.Duration,
 ) *PostRepository {
 	return &PostRepository{
 		postDao:              postDao,
+		postSearchDao:        postSearchDao,
+		tagDao:               tagDao,
 		accessControlService: accessControlService,
+		eventEmitter:         eventEmitter,
+		userDirectory:        userDirectory,
+		previewKey:           []byte(previewKey),
+		previewTTL:           previewTTL,
 	}
 }
 
-// CreatePost implements services.BlogPostService.
+// CreatePost implements services.BlogPostService. Without a slug one is
+// made from the title. The tags and status are checked before the post is
+// saved so a change that isn't allowed doesn't leave a post behind.
 func (self *PostRepository) CreatePost(
 	ctx context.Context,
 	title string,
+	postSlug string,
 	content string,
 	author string,
+	changes models.PostChanges,
 ) (*models.PostStub, models.Notifier) {
 	if err := self.accessControlService.Enforce(ctx, "/blog", "create"); err != nil {
 		return nil, services.AccessDenied
 	}
 
-	postId, err := self.postDao.CreatePost(ctx, title, content, author)
+	if postSlug != "" {
+		postSlug = slug.Make(postSlug)
+		if !validSlug(postSlug) {
+			return nil, services.InvalidSlug
+		}
+	} else {
+		postSlug = self.uniqueSlug(ctx, title)
+	}
+
+	postId := uuid.New().String()
+	attrs := models.ResourceAttributes{Owner: author}
+
+	tags, notifier := self.checkTags(ctx, postId, changes.Tags)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if notifier := self.checkStatus(ctx, postId, attrs, changes.Status); notifier != nil {
+		return nil, notifier
+	}
+
+	err := self.postDao.CreatePost(ctx, postId, title, postSlug, content, author)
+	if err == database.Duplicate {
+		return nil, services.SlugInUse
+	}
+
 	if err != nil {
 		panic(err)
 	}
 
-	return &models.PostStub{
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type: models.EventPostCreated,
+		Data: models.PostEventData{
+			PostId: postId,
+			Title:  title,
+			Author: author,
+		},
+	})
+
+	stub := &models.PostStub{
 		Id:    postId,
+		Slug:  postSlug,
 		Title: title,
-	}, nil
+	}
+
+	self.applyChanges(ctx, stub, tags, changes)
+
+	return stub, nil
 }
 
-// GetPost implements services.BlogPostService.
+// GetPost implements services.BlogPostService. Posts that aren't public
+// yet are only found by users that can edit them.
 func (self *PostRepository) GetPost(
 	ctx context.Context,
-	id string,
+	idOrSlug string,
 ) (*models.PostContent, models.Notifier) {
+	post, notifier := self.findPost(ctx, idOrSlug)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if !isPublic(post, time.Now()) && !self.canEdit(ctx, post) {
+		return nil, services.PostNotFound
+	}
+
+	content := postContent(post)
+	content.Tags = self.postTags(ctx, post.Id)[post.Id]
+
+	return content, nil
+}
+
+// GetPostPreview implements services.BlogPostService.
+func (self *PostRepository) GetPostPreview(
+	ctx context.Context,
+	idOrSlug string,
+	token string,
+) (*models.PostContent, models.Notifier) {
+	post, notifier := self.findPost(ctx, idOrSlug)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if !self.verifyPreview(post.Id, token, time.Now()) {
+		return nil, services.InvalidPreviewToken
+	}
+
+	content := postContent(post)
+	content.Tags = self.postTags(ctx, post.Id)[post.Id]
+
+	return content, nil
+}
+
+// SetPostSlug implements services.BlogPostService. The old slug keeps
+// pointing at the post.
+func (self *PostRepository) SetPostSlug(
+	ctx context.Context,
+	id string,
+	postSlug string,
+) (*models.PostStub, models.Notifier) {
 	post, err := self.postDao.GetPost(ctx, id)
 	if err == database.NotFound {
 		return nil, services.PostNotFound
@@ -68,41 +215,298 @@ func (self *PostRepository) GetPost(
 		panic(err)
 	}
 
-	createdAt, err := time.Parse(time.RFC3339, post.CreatedAt)
+	attrs := models.ResourceAttributes{Owner: post.Author}
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+id, "update", attrs); err != nil {
+		return nil, err
+	}
+
+	postSlug, notifier := self.checkSlug(ctx, id, postSlug)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	err = self.postDao.SetSlug(ctx, id, postSlug)
+	if err == database.Duplicate {
+		return nil, services.SlugInUse
+	}
+
+	if err == database.NotFound {
+		return nil, services.PostNotFound
+	}
+
 	if err != nil {
 		panic(err)
 	}
-	createdAtStr := createdAt.Format("Jan 2, 2006")
 
-	return &models.PostContent{
+	return &models.PostStub{
+		Id:    id,
+		Slug:  postSlug,
+		Title: post.Title,
+	}, nil
+}
+
+// findPost looks a post up by id, then by its slug and finally by any slug
+// it used to have.
+func (self *PostRepository) findPost(ctx context.Context, idOrSlug string) (*database.Post, models.Notifier) {
+	post, err := self.postDao.GetPost(ctx, idOrSlug)
+	if err == database.NotFound {
+		post, err = self.postDao.GetPostBySlug(ctx, idOrSlug)
+	}
+
+	if err == database.NotFound {
+		var postId string
+		postId, err = self.postDao.FindMovedSlug(ctx, idOrSlug)
+		if err == nil {
+			post, err = self.postDao.GetPost(ctx, postId)
+		}
+	}
+
+	if err == database.NotFound {
+		return nil, services.PostNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return post, nil
+}
+
+// uniqueSlug makes a slug from the title, numbering it when another post
+// already has it.
+func (self *PostRepository) uniqueSlug(ctx context.Context, title string) string {
+	base := slug.Make(title)
+	if len(base) > MAX_SLUG_LENGTH-10 {
+		base = strings.TrimRight(base[:MAX_SLUG_LENGTH-10], "-")
+	}
+
+	if base == "" {
+		base = "post"
+	} else if RESERVED_SLUGS[base] {
+		base += "-post"
+	}
+
+	candidate := base
+	for n := 2; ; n++ {
+		inUse, err := self.postDao.SlugInUse(ctx, candidate, "")
+		if err != nil {
+			panic(err)
+		}
+
+		if !inUse {
+			return candidate
+		}
+
+		candidate = base + "-" + strconv.Itoa(n)
+	}
+}
+
+// checkSlug cleans up a slug for the post and makes sure no other post has
+// it.
+func (self *PostRepository) checkSlug(ctx context.Context, id, postSlug string) (string, models.Notifier) {
+	postSlug = slug.Make(postSlug)
+	if !validSlug(postSlug) {
+		return "", services.InvalidSlug
+	}
+
+	inUse, err := self.postDao.SlugInUse(ctx, postSlug, id)
+	if err != nil {
+		panic(err)
+	}
+
+	if inUse {
+		return "", services.SlugInUse
+	}
+
+	return postSlug, nil
+}
+
+// NewPreview implements services.BlogPostService.
+func (self *PostRepository) NewPreview(
+	ctx context.Context,
+	id string,
+) (*models.PostPreview, models.Notifier) {
+	attrs, notifier := self.postAttributes(ctx, id)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+id, "update", attrs); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(self.previewTTL)
+
+	return &models.PostPreview{
+		Token:     self.signPreview(id, expiresAt),
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// SetPostStatus implements services.BlogPostService. A published post with
+// publishAt in the future stays hidden until then, a zero publishAt
+// publishes it now.
+func (self *PostRepository) SetPostStatus(
+	ctx context.Context,
+	id string,
+	status string,
+	publishAt time.Time,
+) (*models.PostStub, models.Notifier) {
+	if !validPostStatus(status) {
+		return nil, services.InvalidPostStatus
+	}
+
+	post, err := self.postDao.GetPost(ctx, id)
+	if err == database.NotFound {
+		return nil, services.PostNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	attrs := models.ResourceAttributes{Owner: post.Author}
+	if notifier := self.checkStatus(ctx, id, attrs, status); notifier != nil {
+		return nil, notifier
+	}
+
+	return self.saveStatus(ctx, post, status, publishAt), nil
+}
+
+// checkStatus makes sure the status can be set on the post, an empty
+// status is left as it is.
+func (self *PostRepository) checkStatus(
+	ctx context.Context,
+	id string,
+	attrs models.ResourceAttributes,
+	status string,
+) models.Notifier {
+	if status == "" {
+		return nil
+	}
+
+	if !validPostStatus(status) {
+		return services.InvalidPostStatus
+	}
+
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+id+"/status", "update", attrs); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// saveStatus sets a status checkStatus has allowed.
+func (self *PostRepository) saveStatus(
+	ctx context.Context,
+	post *database.Post,
+	status string,
+	publishAt time.Time,
+) *models.PostStub {
+	var publishedAt *time.Time
+	switch status {
+	case models.PostStatusPublished:
+		if publishAt.IsZero() {
+			publishAt = time.Now()
+		}
+		publishAt = publishAt.UTC().Truncate(time.Second)
+		publishedAt = &publishAt
+	case models.PostStatusArchived:
+		// Archiving keeps the original publish date around
+		if post.PublishedAt != nil {
+			existing, err := time.Parse(time.RFC3339, *post.PublishedAt)
+			if err != nil {
+				panic(err)
+			}
+			publishedAt = &existing
+		}
+	}
+
+	if err := self.postDao.SetStatus(ctx, post.Id, status, publishedAt); err != nil {
+		panic(err)
+	}
+
+	if status == models.PostStatusPublished && post.Status != models.PostStatusPublished {
+		self.eventEmitter.Emit(ctx, models.WebhookEvent{
+			Type: models.EventPostPublished,
+			Data: models.PostEventData{
+				PostId: post.Id,
+				Title:  post.Title,
+				Author: post.Author,
+			},
+		})
+	}
+
+	return &models.PostStub{
 		Id:        post.Id,
 		Title:     post.Title,
-		Date:      createdAtStr,
-		ImageMime: post.ImageMime,
-		Image:     base64.StdEncoding.EncodeToString(post.Image),
-		Content:   post.Content,
-	}, nil
+		Status:    status,
+		Scheduled: publishedAt != nil && status == models.PostStatusPublished && publishedAt.After(time.Now()),
+	}
+}
+
+// applyChanges saves the tags and status of a post once they've been
+// checked along with the rest of it.
+func (self *PostRepository) applyChanges(
+	ctx context.Context,
+	stub *models.PostStub,
+	tags []database.Tag,
+	changes models.PostChanges,
+) {
+	if changes.Tags != nil {
+		stub.Tags = self.saveTags(ctx, stub.Id, tags)
+	}
+
+	if changes.Status != "" {
+		post, err := self.postDao.GetPost(ctx, stub.Id)
+		if err != nil {
+			panic(err)
+		}
+
+		saved := self.saveStatus(ctx, post, changes.Status, changes.PublishAt)
+		stub.Status = saved.Status
+		stub.Scheduled = saved.Scheduled
+	}
 }
 
-// UpdatePost implements services.BlogPostService.
+// UpdatePost implements services.BlogPostService. An empty slug keeps the
+// post's slug. Like CreatePost everything is checked before any of it is
+// saved.
 func (self *PostRepository) UpdatePost(
 	ctx context.Context,
 	id string,
 	title string,
+	postSlug string,
 	content string,
+	changes models.PostChanges,
 ) (*models.PostStub, models.Notifier) {
-	if err := self.accessControlService.Enforce(ctx, "/blog/"+id, "update"); err != nil {
-		post, err := self.postDao.GetPost(ctx, id)
-		if err == database.NotFound {
-			return nil, services.AccessDenied
-		}
+	attrs, notifier := self.postAttributes(ctx, id)
+	if notifier != nil {
+		return nil, notifier
+	}
 
-		if userId, ok := ctx.Value("user_id").(string); !ok || post.Author != userId {
-			return nil, services.AccessDenied
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+id, "update", attrs); err != nil {
+		return nil, err
+	}
+
+	if postSlug != "" {
+		postSlug, notifier = self.checkSlug(ctx, id, postSlug)
+		if notifier != nil {
+			return nil, notifier
 		}
 	}
 
-	err := self.postDao.UpdatePost(ctx, id, title, content)
+	tags, notifier := self.checkTags(ctx, id, changes.Tags)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if notifier := self.checkStatus(ctx, id, attrs, changes.Status); notifier != nil {
+		return nil, notifier
+	}
+
+	editor, _ := ctx.Value("user_id").(string)
+	err := self.postDao.UpdatePost(ctx, id, title, content, editor)
 	if err == database.NotFound {
 		return nil, services.PostNotFound
 	}
@@ -111,23 +515,46 @@ func (self *PostRepository) UpdatePost(
 		panic(err)
 	}
 
-	return &models.PostStub{
+	if postSlug != "" {
+		err := self.postDao.SetSlug(ctx, id, postSlug)
+		if err == database.Duplicate {
+			return nil, services.SlugInUse
+		}
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type: models.EventPostUpdated,
+		Data: models.PostEventData{
+			PostId: id,
+			Title:  title,
+			Author: attrs.Owner,
+		},
+	})
+
+	stub := &models.PostStub{
 		Id:    id,
+		Slug:  postSlug,
 		Title: title,
-	}, nil
+	}
+
+	self.applyChanges(ctx, stub, tags, changes)
+
+	return stub, nil
 }
 
 // DeletePost implements services.BlogPostService.
 func (self *PostRepository) DeletePost(ctx context.Context, id string) models.Notifier {
-	if err := self.accessControlService.Enforce(ctx, "/blog/"+id, "delete"); err != nil {
-		post, err := self.postDao.GetPost(ctx, id)
-		if err == database.NotFound {
-			return services.AccessDenied
-		}
+	attrs, notifier := self.postAttributes(ctx, id)
+	if notifier != nil {
+		return notifier
+	}
 
-		if userId, ok := ctx.Value("user_id").(string); !ok || post.Author != userId {
-			return services.AccessDenied
-		}
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+id, "delete", attrs); err != nil {
+		return err
 	}
 
 	err := self.postDao.DeletePost(ctx, id)
@@ -139,111 +566,775 @@ func (self *PostRepository) DeletePost(ctx context.Context, id string) models.No
 		panic(err)
 	}
 
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type: models.EventPostDeleted,
+		Data: models.PostEventData{
+			PostId: id,
+			Author: attrs.Owner,
+		},
+	})
+
 	return nil
 }
 
-// ListPosts implements services.BlogPostService.
-func (self *PostRepository) ListPosts(ctx context.Context) []models.PostStub {
-	data, err := self.postDao.ListPosts(ctx)
+// ListPosts implements services.BlogPostService. Anonymous readers only
+// see published posts, signed in users also see their own and editors see
+// every post.
+func (self *PostRepository) ListPosts(
+	ctx context.Context,
+	filter models.PostFilter,
+	page models.PageRequest,
+) (*models.PostPage, models.Notifier) {
+	now := time.Now()
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = POST_PAGE_SIZE
+	} else if limit > MAX_POST_PAGE_SIZE {
+		limit = MAX_POST_PAGE_SIZE
+	}
+
+	query := database.PostFilter{
+		Author: filter.Author,
+		Tag:    filter.Tag,
+		Since:  filter.Since,
+		Until:  filter.Until,
+	}
+
+	self.limitVisibility(ctx, &query, now)
+
+	if page.After != "" {
+		cursor, ok := decodePostCursor(page.After)
+		if !ok {
+			return nil, services.InvalidCursor
+		}
+		query.After = &cursor
+	}
+
+	if page.Before != "" {
+		cursor, ok := decodePostCursor(page.Before)
+		if !ok {
+			return nil, services.InvalidCursor
+		}
+		query.Before = &cursor
+		query.After = nil
+	}
+
+	data, more := self.visiblePosts(ctx, query, limit)
+
+	ids := make([]string, len(data))
+	for i := range data {
+		ids[i] = data[i].Id
+	}
+	tags := self.postTags(ctx, ids...)
+
+	posts := make([]models.PostStub, 0, len(data))
+	for i := range data {
+		post := &data[i]
+
+		// Cut by characters, the DAO already cut content down to 101 of them
+		postPreview := post.Content
+		if runes := []rune(postPreview); len(runes) > 100 {
+			postPreview = string(runes[:100]) + "..."
+		}
+
+		posts = append(posts, models.PostStub{
+			Id:        post.Id,
+			Slug:      post.Slug,
+			Title:     post.Title,
+			Date:      postDate(post).Format("Jan 2, 2006"),
+			ImageId:   stringValue(post.ImageId),
+			Thumbnail: stringValue(post.ThumbnailId),
+			Preview:   postPreview,
+			Status:    post.Status,
+			Scheduled: isScheduled(post, now),
+			Tags:      tags[post.Id],
+		})
+	}
+
+	result := &models.PostPage{Posts: posts}
+	if len(data) == 0 {
+		return result, nil
+	}
+
+	first, last := &data[0], &data[len(data)-1]
+	if query.Before != nil {
+		// We came from an older page so there's always one to go back to
+		result.Next = encodePostCursor(last)
+		if more {
+			result.Prev = encodePostCursor(first)
+		}
+	} else {
+		if more {
+			result.Next = encodePostCursor(last)
+		}
+		if query.After != nil {
+			result.Prev = encodePostCursor(first)
+		}
+	}
+
+	return result, nil
+}
+
+// limitVisibility narrows the query to the posts the current user can see.
+// Anonymous readers only see published posts. Signed in users also see
+// their own, and everything when they can edit any post. Someone only
+// allowed to edit particular posts they didn't write won't find those in
+// lists, they're still reachable directly.
+func (self *PostRepository) limitVisibility(ctx context.Context, query *database.PostFilter, now time.Time) {
+	if !signedIn(ctx) {
+		query.PublishedBy = now
+		return
+	}
+
+	if self.accessControlService.Enforce(ctx, "/blog/*", "update") == nil {
+		return
+	}
+
+	query.PublishedBy = now
+	query.VisibleTo, _ = ctx.Value("user_id").(string)
+}
 
+// visiblePosts reads a page of posts from the cursor. The extra bool is
+// true when there are more posts past the ones returned.
+func (self *PostRepository) visiblePosts(
+	ctx context.Context,
+	query database.PostFilter,
+	limit int,
+) ([]database.Post, bool) {
+	visible, err := self.postDao.ListPosts(ctx, query, limit+1)
 	if err != nil {
 		panic(err)
 	}
 
-	posts := make([]models.PostStub, len(data))
+	more := len(visible) > limit
+	if more {
+		visible = visible[:limit]
+	}
 
-	for i, post := range data {
-		postPreview := post.Content
-		if len(postPreview) > 100 {
-			postPreview = postPreview[:100] + "..."
+	// Paging backwards reads oldest first but pages are always newest first
+	if query.Before != nil {
+		for i, j := 0, len(visible)-1; i < j; i, j = i+1, j-1 {
+			visible[i], visible[j] = visible[j], visible[i]
+		}
+	}
+
+	return visible, more
+}
+
+// FeedPosts implements services.BlogPostService. Feeds are public so only
+// published posts are in them whoever asks.
+func (self *PostRepository) FeedPosts(
+	ctx context.Context,
+	filter models.PostFilter,
+) ([]models.PostContent, models.Notifier) {
+	if filter.Tag != "" {
+		if _, notifier := self.GetTag(ctx, filter.Tag); notifier != nil {
+			return nil, notifier
+		}
+	}
+
+	data, err := self.postDao.ListFeedPosts(ctx, database.PostFilter{
+		Author:      filter.Author,
+		Tag:         filter.Tag,
+		Since:       filter.Since,
+		Until:       filter.Until,
+		PublishedBy: time.Now(),
+	}, FEED_SIZE)
+	if err != nil {
+		panic(err)
+	}
+
+	ids := make([]string, len(data))
+	for i := range data {
+		ids[i] = data[i].Id
+	}
+	tags := self.postTags(ctx, ids...)
+	names := self.authorNames(ctx, data)
+
+	posts := make([]models.PostContent, len(data))
+	for i := range data {
+		posts[i] = *postContent(&data[i])
+		posts[i].Tags = tags[data[i].Id]
+		posts[i].AuthorName = names[data[i].Author]
+	}
+
+	return posts, nil
+}
+
+// authorNames looks up the email of each author once. Authors that can't
+// be found are left out, a feed is still useful without them.
+func (self *PostRepository) authorNames(ctx context.Context, posts []database.Post) map[string]string {
+	names := make(map[string]string)
+	if self.userDirectory == nil {
+		return names
+	}
+
+	for i := range posts {
+		author := posts[i].Author
+		if _, ok := names[author]; ok {
+			continue
 		}
 
-		createdAt, err := time.Parse(time.RFC3339, post.CreatedAt)
+		email, err := self.userDirectory.GetEmail(ctx, author)
 		if err != nil {
-			panic(err)
+			log.Printf("Unable to find the email for %s: %s", author, err)
+		}
+		names[author] = email
+	}
+
+	return names
+}
+
+// SearchPosts implements services.BlogPostService. The same posts are
+// visible as when listing.
+func (self *PostRepository) SearchPosts(
+	ctx context.Context,
+	query string,
+) ([]models.PostSearchResult, models.Notifier) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return nil, services.EmptySearchQuery
+	}
+
+	now := time.Now()
+
+	filter := database.PostFilter{}
+	self.limitVisibility(ctx, &filter, now)
+
+	matches, err := self.postSearchDao.Search(ctx, strings.Join(terms, " "), filter, 0, SEARCH_LIMIT)
+	if err != nil {
+		panic(err)
+	}
+
+	results := make([]models.PostSearchResult, len(matches))
+	for i := range matches {
+		post := &matches[i].Post
+
+		parts := search.Snippet(post.Content, terms, SNIPPET_WIDTH)
+		snippet := make([]models.Highlight, len(parts))
+		for j, part := range parts {
+			snippet[j] = models.Highlight{Text: part.Text, Match: part.Match}
 		}
-		createdAtStr := createdAt.Format("Jan 2, 2006")
 
-		posts[i] = models.PostStub{
+		results[i] = models.PostSearchResult{
 			Id:        post.Id,
+			Slug:      post.Slug,
 			Title:     post.Title,
-			Date:      createdAtStr,
-			ImageMime: post.ImageMime,
-			Image:     base64.StdEncoding.EncodeToString(post.Thumbnail),
-			Preview:   postPreview,
+			Date:      postDate(post).Format("Jan 2, 2006"),
+			Status:    post.Status,
+			Scheduled: isScheduled(post, now),
+			Snippet:   snippet,
 		}
 	}
 
-	return posts
+	return results, nil
 }
 
-// AddImage implements services.BlogPostService.
-func (self *PostRepository) AddImage(
+// SetPostTags implements services.BlogPostService. Tags that don't exist
+// yet are created, adding or removing a restricted tag also needs the
+// apply action on the tag.
+func (self *PostRepository) SetPostTags(
 	ctx context.Context,
 	id string,
-	mimeType string,
-	image []byte,
-) models.Notifier {
-	if err := self.accessControlService.Enforce(ctx, "/blog/"+id+"/upload", "update"); err != nil {
-		post, err := self.postDao.GetPost(ctx, id)
-		if err == database.NotFound {
-			return services.AccessDenied
+	names []string,
+) ([]models.Tag, models.Notifier) {
+	attrs, notifier := self.postAttributes(ctx, id)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+id, "update", attrs); err != nil {
+		return nil, err
+	}
+
+	if names == nil {
+		names = []string{}
+	}
+
+	wanted, notifier := self.checkTags(ctx, id, names)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	return self.saveTags(ctx, id, wanted), nil
+}
+
+// checkTags finds the tags to put on the post and makes sure the user can
+// add and remove the restricted ones. Nil names leave the tags alone.
+func (self *PostRepository) checkTags(
+	ctx context.Context,
+	id string,
+	names []string,
+) ([]database.Tag, models.Notifier) {
+	if names == nil {
+		return nil, nil
+	}
+
+	wanted := make([]database.Tag, 0, len(names))
+	slugs := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		tagSlug := slug.Make(name)
+		if tagSlug == "" || len(tagSlug) > MAX_TAG_LENGTH || len(name) > MAX_TAG_LENGTH {
+			return nil, services.InvalidTag
 		}
 
-		if userId, ok := ctx.Value("user_id").(string); !ok || post.Author != userId {
-			return services.AccessDenied
+		if seen[tagSlug] {
+			continue
 		}
+		seen[tagSlug] = true
+
+		wanted = append(wanted, database.Tag{Slug: tagSlug, Name: name})
+		slugs = append(slugs, tagSlug)
 	}
 
-	if mimeType != "image/png" && mimeType != "image/jpeg" {
-		return services.InvalidMimeType
+	if len(wanted) > MAX_POST_TAGS {
+		return nil, services.TooManyTags
 	}
 
-	var thumbnailBuffer bytes.Buffer
-	if mimeType == "image/png" {
-		resizePng(bytes.NewReader(image), &thumbnailBuffer)
-	} else if mimeType == "image/jpeg" {
-		resizeJpeg(bytes.NewReader(image), &thumbnailBuffer)
+	known, err := self.tagDao.FindTags(ctx, slugs)
+	if err != nil {
+		panic(err)
 	}
 
-	err := self.postDao.AddImage(ctx, id, mimeType, image, thumbnailBuffer.Bytes())
+	existing, err := self.tagDao.ListPostTags(ctx, id)
 	if err != nil {
 		panic(err)
 	}
 
-	return nil
+	// Tags that already exist keep the name they were created with
+	knownTags := make(map[string]database.Tag)
+	for _, tag := range known {
+		knownTags[tag.Slug] = tag
+	}
+	for i := range wanted {
+		if tag, ok := knownTags[wanted[i].Slug]; ok {
+			wanted[i] = tag
+		}
+	}
+
+	onPost := make(map[string]bool)
+	for _, tag := range existing {
+		onPost[tag.Slug] = true
+
+		if tag.Restricted && !seen[tag.Slug] {
+			if err := self.accessControlService.Enforce(ctx, "/blog/tag/"+tag.Slug, "apply"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, tag := range wanted {
+		if tag.Restricted && !onPost[tag.Slug] {
+			if err := self.accessControlService.Enforce(ctx, "/blog/tag/"+tag.Slug, "apply"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return wanted, nil
+}
+
+// saveTags replaces the post's tags with ones checkTags has allowed.
+func (self *PostRepository) saveTags(ctx context.Context, id string, wanted []database.Tag) []models.Tag {
+	if err := self.tagDao.SetPostTags(ctx, id, wanted); err != nil {
+		panic(err)
+	}
+
+	tags := make([]models.Tag, len(wanted))
+	for i := range wanted {
+		tags[i] = tagModel(&wanted[i])
+	}
+
+	return tags
+}
+
+// ListTags implements services.BlogPostService. Only published posts are
+// counted so the counts are the same for everyone.
+func (self *PostRepository) ListTags(ctx context.Context) []models.TagCount {
+	data, err := self.tagDao.CountTags(ctx, time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	counts := make([]models.TagCount, len(data))
+	for i := range data {
+		counts[i] = models.TagCount{
+			Tag:   tagModel(&data[i].Tag),
+			Count: data[i].Count,
+		}
+	}
+
+	return counts
+}
+
+// GetTag implements services.BlogPostService.
+func (self *PostRepository) GetTag(
+	ctx context.Context,
+	tagSlug string,
+) (*models.Tag, models.Notifier) {
+	tag, err := self.tagDao.GetTag(ctx, tagSlug)
+	if err == database.NotFound {
+		return nil, services.TagNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	result := tagModel(tag)
+
+	return &result, nil
 }
 
-const Width = 600
+// UpdateTag implements services.BlogPostService.
+func (self *PostRepository) UpdateTag(
+	ctx context.Context,
+	tagSlug string,
+	restricted bool,
+) (*models.Tag, models.Notifier) {
+	tag, err := self.tagDao.GetTag(ctx, tagSlug)
+	if err == database.NotFound {
+		return nil, services.TagNotFound
+	}
 
-func resizeJpeg(r io.Reader, w io.Writer) {
-	src, err := jpeg.Decode(r)
 	if err != nil {
 		panic(err)
 	}
 
-	scale := float64(Width) / float64(src.Bounds().Max.X)
-	height := int(float64(src.Bounds().Max.Y) * scale)
+	if err := self.accessControlService.Enforce(ctx, "/blog/tag/"+tagSlug, "update"); err != nil {
+		return nil, err
+	}
+
+	if err := self.tagDao.SetRestricted(ctx, tagSlug, restricted); err != nil {
+		panic(err)
+	}
+
+	tag.Restricted = restricted
+	result := tagModel(tag)
 
-	dst := image.NewRGBA(image.Rect(0, 0, Width, height))
-	draw.CatmullRom.Scale(dst, dst.Rect, src, src.Bounds(), draw.Over, nil)
+	return &result, nil
+}
+
+// postTags looks up the tags on each of the posts, keyed by post id.
+func (self *PostRepository) postTags(ctx context.Context, ids ...string) map[string][]models.Tag {
+	data, err := self.tagDao.ListPostTags(ctx, ids...)
+	if err != nil {
+		panic(err)
+	}
+
+	tags := make(map[string][]models.Tag)
+	for i := range data {
+		tags[data[i].PostId] = append(tags[data[i].PostId], tagModel(&data[i].Tag))
+	}
 
-	jpeg.Encode(w, dst, nil)
+	return tags
 }
 
-func resizePng(r io.Reader, w io.Writer) {
-	src, err := png.Decode(r)
+// ListRevisions implements services.BlogPostService.
+func (self *PostRepository) ListRevisions(
+	ctx context.Context,
+	id string,
+) ([]models.PostRevision, models.Notifier) {
+	attrs, notifier := self.postAttributes(ctx, id)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+id+"/revision", "list", attrs); err != nil {
+		return nil, err
+	}
+
+	data, err := self.postDao.ListRevisions(ctx, id)
 	if err != nil {
 		panic(err)
 	}
 
-	scale := float64(Width) / float64(src.Bounds().Max.X)
-	height := int(float64(src.Bounds().Max.Y) * scale)
+	revisions := make([]models.PostRevision, len(data))
+	for i := range data {
+		revisions[i] = postRevision(&data[i])
+	}
 
-	dst := image.NewRGBA(image.Rect(0, 0, Width, height))
-	draw.CatmullRom.Scale(dst, dst.Rect, src, src.Bounds(), draw.Over, nil)
+	return revisions, nil
+}
 
-	png.Encode(w, dst)
+// DiffRevisions implements services.BlogPostService.
+func (self *PostRepository) DiffRevisions(
+	ctx context.Context,
+	id string,
+	from, to int64,
+) (*models.PostDiff, models.Notifier) {
+	attrs, notifier := self.postAttributes(ctx, id)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	if err := self.accessControlService.EnforceWithAttributes(ctx, "/blog/"+id+"/revision", "list", attrs); err != nil {
+		return nil, err
+	}
+
+	fromRevision, notifier := self.getRevision(ctx, id, from)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	toRevision, notifier := self.getRevision(ctx, id, to)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	changes := diff.Lines(fromRevision.Content, toRevision.Content)
+	lines := make([]models.DiffLine, len(changes))
+	for i, change := range changes {
+		lines[i] = models.DiffLine{Op: change.Op, Text: change.Text}
+	}
+
+	return &models.PostDiff{
+		From:  postRevision(fromRevision),
+		To:    postRevision(toRevision),
+		Lines: lines,
+	}, nil
+}
+
+// RestoreRevision implements services.BlogPostService. Restoring is an
+// update so it shows up in the history as a new revision.
+func (self *PostRepository) RestoreRevision(
+	ctx context.Context,
+	id string,
+	revisionId int64,
+) (*models.PostStub, models.Notifier) {
+	if _, notifier := self.postAttributes(ctx, id); notifier != nil {
+		return nil, notifier
+	}
+
+	revision, notifier := self.getRevision(ctx, id, revisionId)
+	if notifier != nil {
+		return nil, notifier
+	}
+
+	return self.UpdatePost(ctx, id, revision.Title, "", revision.Content, models.PostChanges{})
+}
+
+func (self *PostRepository) getRevision(
+	ctx context.Context,
+	id string,
+	revisionId int64,
+) (*database.PostRevision, models.Notifier) {
+	revision, err := self.postDao.GetRevision(ctx, id, revisionId)
+	if err == database.NotFound {
+		return nil, services.RevisionNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return revision, nil
+}
+
+// postAttributes loads the attributes policies may use to decide access
+// to a post, such as its author.
+func (self *PostRepository) postAttributes(
+	ctx context.Context,
+	id string,
+) (models.ResourceAttributes, models.Notifier) {
+	post, err := self.postDao.GetPost(ctx, id)
+	if err == database.NotFound {
+		return models.ResourceAttributes{}, services.PostNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return models.ResourceAttributes{
+		Owner: post.Author,
+	}, nil
+}
+
+// canEdit is true when the current user is allowed to update the post,
+// those users can see it before it's published.
+func (self *PostRepository) canEdit(ctx context.Context, post *database.Post) bool {
+	err := self.accessControlService.EnforceWithAttributes(
+		ctx,
+		"/blog/"+post.Id,
+		"update",
+		models.ResourceAttributes{Owner: post.Author},
+	)
+
+	return err == nil
+}
+
+func signedIn(ctx context.Context) bool {
+	userId, ok := ctx.Value("user_id").(string)
+
+	return ok && userId != ""
+}
+
+// signPreview creates a token of the form `<expires>.<signature>` where the
+// signature covers the post id and expiry.
+func (self *PostRepository) signPreview(id string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	mac := hmac.New(sha256.New, self.previewKey)
+	mac.Write([]byte(id + "." + expires))
+
+	return expires + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (self *PostRepository) verifyPreview(id, token string, now time.Time) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, self.previewKey)
+	mac.Write([]byte(id + "." + parts[0]))
+
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// encodePostCursor points at the post so the next page can start after it.
+func encodePostCursor(post *database.Post) string {
+	cursor := postDate(post).UTC().Format(time.RFC3339) + "|" + post.Id
+
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodePostCursor(encoded string) (database.PostCursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return database.PostCursor{}, false
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return database.PostCursor{}, false
+	}
+
+	date, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return database.PostCursor{}, false
+	}
+
+	return database.PostCursor{Date: date, Id: parts[1]}, true
+}
+
+func validSlug(postSlug string) bool {
+	return postSlug != "" && len(postSlug) <= MAX_SLUG_LENGTH && !RESERVED_SLUGS[postSlug]
+}
+
+func validPostStatus(status string) bool {
+	for _, known := range models.PostStatuses {
+		if status == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPublic(post *database.Post, now time.Time) bool {
+	if post.Status != models.PostStatusPublished || post.PublishedAt == nil {
+		return false
+	}
+
+	return !postDate(post).After(now)
+}
+
+func isScheduled(post *database.Post, now time.Time) bool {
+	return post.Status == models.PostStatusPublished &&
+		post.PublishedAt != nil &&
+		postDate(post).After(now)
+}
+
+// postDate is when the post was published, or created if it hasn't been.
+func postDate(post *database.Post) time.Time {
+	date := post.CreatedAt
+	if post.PublishedAt != nil {
+		date = *post.PublishedAt
+	}
+
+	parsed, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
+
+func postContent(post *database.Post) *models.PostContent {
+	content := &models.PostContent{
+		Id:        post.Id,
+		Slug:      post.Slug,
+		Title:     post.Title,
+		Date:      postDate(post).Format("Jan 2, 2006"),
+		ImageId:   stringValue(post.ImageId),
+		Content:   post.Content,
+		Status:    post.Status,
+		Scheduled: isScheduled(post, time.Now()),
+		Author:    post.Author,
+	}
+
+	if post.PublishedAt != nil {
+		content.PublishedAt = postDate(post).UTC().Format(time.RFC3339)
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339, post.UpdatedAt)
+	if err != nil {
+		panic(err)
+	}
+	content.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+
+	return content
+}
+
+// stringValue is the value of a nullable column, empty when it's null.
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+func tagModel(tag *database.Tag) models.Tag {
+	return models.Tag{
+		Slug:       tag.Slug,
+		Name:       tag.Name,
+		Restricted: tag.Restricted,
+	}
+}
+
+func postRevision(revision *database.PostRevision) models.PostRevision {
+	createdAt, err := time.Parse(time.RFC3339, revision.CreatedAt)
+	if err != nil {
+		panic(err)
+	}
+
+	return models.PostRevision{
+		Id:     revision.Id,
+		PostId: revision.PostId,
+		Title:  revision.Title,
+		Author: revision.Author,
+		Date:   createdAt.Format("Jan 2, 2006 15:04"),
+	}
 }
 
 // var _ services.BlogPostService = (*PostRepository)(nil)
@@ -0,0 +1,1075 @@
+package repositories
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jhamill34/notion-provisioner/internal/config"
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/services/scim"
+)
+
+// List requests can't ask for more than this many resources at once.
+const SCIM_MAX_COUNT = 200
+
+// SCIM attributes that can be filtered on and the columns they map to.
+var scimUserColumns = map[string]string{
+	"id":           "id",
+	"username":     "name",
+	"externalid":   "external_id",
+	"emails":       "email",
+	"emails.value": "email",
+	"active":       "active",
+}
+
+var scimGroupColumns = map[string]string{
+	"id":          "id",
+	"displayname": "name",
+	"externalid":  "external_id",
+}
+
+// ScimRepository doesn't enforce policies since SCIM clients are
+// applications rather than users, the transport only lets through client
+// tokens that were granted the scim scope.
+type ScimRepository struct {
+	baseUrl              string
+	userDao              *dao.UserDao
+	organizationDao      *dao.OrganizationDao
+	appDao               *dao.ApplicationDao
+	passwordConfig       *config.HashParams
+	accessControlService services.AccessControlService
+	auditService         services.AuditService
+	eventEmitter         services.EventEmitter
+}
+
+func NewScimRepository(
+	baseUrl string,
+	userDao *dao.UserDao,
+	organizationDao *dao.OrganizationDao,
+	appDao *dao.ApplicationDao,
+	passwordConfig *config.HashParams,
+	accessControlService services.AccessControlService,
+	auditService services.AuditService,
+	eventEmitter services.EventEmitter,
+) *ScimRepository {
+	return &ScimRepository{
+		baseUrl:              baseUrl,
+		userDao:              userDao,
+		organizationDao:      organizationDao,
+		appDao:               appDao,
+		passwordConfig:       passwordConfig,
+		accessControlService: accessControlService,
+		auditService:         auditService,
+		eventEmitter:         eventEmitter,
+	}
+}
+
+//==============================================================================
+// Users
+//==============================================================================
+
+// ListUsers implements services.ScimService.
+func (self *ScimRepository) ListUsers(
+	ctx context.Context,
+	query models.ScimQuery,
+) (*models.ScimListResponse, models.Notifier) {
+	filters, filterErr := scimFilters(query.Filter, scimUserColumns)
+	if filterErr != nil {
+		return nil, filterErr
+	}
+
+	offset, limit := scimPage(query)
+	data, total, err := self.userDao.SearchUsers(ctx, filters, offset, limit)
+	if err == database.InvalidFilter {
+		return nil, services.NewScimServiceError(400, "invalidFilter", "Unsupported filter")
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	users := make([]models.ScimUser, len(data))
+	for i := range data {
+		users[i] = self.toScimUser(&data[i])
+	}
+
+	return scimListResponse(total, offset, users, len(users)), nil
+}
+
+// GetUser implements services.ScimService.
+func (self *ScimRepository) GetUser(ctx context.Context, id string) (*models.ScimUser, models.Notifier) {
+	user, err := self.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := self.toScimUser(user)
+	return &result, nil
+}
+
+// CreateUser implements services.ScimService. Provisioned users are
+// trusted to be verified, without a password they'll have to reset it
+// before they can log in.
+func (self *ScimRepository) CreateUser(
+	ctx context.Context,
+	user *models.ScimUser,
+) (*models.ScimUser, models.Notifier) {
+	userName := strings.TrimSpace(user.UserName)
+	if userName == "" {
+		return nil, services.ScimUserNameRequired
+	}
+
+	if userName == ROOT_NAME {
+		return nil, services.ScimUserExists
+	}
+
+	email := scimPrimaryEmail(user)
+	if email == "" {
+		return nil, services.ScimEmailRequired
+	}
+
+	if _, err := self.userDao.FindByUsername(ctx, userName); err == nil {
+		return nil, services.ScimUserExists
+	} else if err != database.NotFound {
+		panic(err)
+	}
+
+	password := user.Password
+	if password == "" {
+		passwordBytes, err := randomBytes(32)
+		if err != nil {
+			panic(err)
+		}
+		password = hex.EncodeToString(passwordBytes)
+	}
+
+	encodedHash, err := createHash(self.passwordConfig, password)
+	if err != nil {
+		panic(err)
+	}
+
+	id := uuid.New().String()
+	created, err := self.userDao.CreateUser(ctx, id, userName, email, encodedHash, true)
+	if err == database.Duplicate {
+		return nil, services.ScimUserExists
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	if user.ExternalId != "" {
+		if err := self.userDao.UpdateUser(ctx, id, userName, email, user.ExternalId); err != nil {
+			panic(err)
+		}
+	}
+
+	if user.Active != nil && !*user.Active {
+		self.setActive(ctx, id, false)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditScimUserCreate,
+		Target: "/user/" + id,
+		Detail: userName,
+	})
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type: models.EventUserRegistered,
+		Data: models.UserEventData{
+			UserId: created.Id,
+			Name:   created.Name,
+			Email:  created.Email,
+		},
+	})
+
+	return self.GetUser(ctx, id)
+}
+
+// ReplaceUser implements services.ScimService.
+func (self *ScimRepository) ReplaceUser(
+	ctx context.Context,
+	id string,
+	user *models.ScimUser,
+) (*models.ScimUser, models.Notifier) {
+	existing, err := self.findMutableUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.saveUser(ctx, existing, user)
+}
+
+// PatchUser implements services.ScimService.
+func (self *ScimRepository) PatchUser(
+	ctx context.Context,
+	id string,
+	operations []models.ScimPatchOperation,
+) (*models.ScimUser, models.Notifier) {
+	existing, err := self.findMutableUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user := self.toScimUser(existing)
+	for _, operation := range operations {
+		op, path, value, err := scimOperation(operation)
+		if err != nil {
+			return nil, err
+		}
+
+		if path == nil {
+			for key, attributeValue := range value {
+				attributePath, pathErr := scim.ParsePath(key)
+				if pathErr != nil {
+					return nil, services.NewScimServiceError(400, "invalidPath", pathErr.Error())
+				}
+
+				if err := patchUserAttribute(&user, op, attributePath, attributeValue); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if err := patchUserAttribute(&user, op, path, operation.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	return self.saveUser(ctx, existing, &user)
+}
+
+// DeactivateUser implements services.ScimService. Users are never deleted
+// so their history stays intact, instead they can no longer log in and
+// lose all of their permissions.
+func (self *ScimRepository) DeactivateUser(ctx context.Context, id string) models.Notifier {
+	existing, err := self.findMutableUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if existing.Active {
+		self.setActive(ctx, id, false)
+	}
+
+	return nil
+}
+
+func (self *ScimRepository) saveUser(
+	ctx context.Context,
+	existing *database.UserEntity,
+	user *models.ScimUser,
+) (*models.ScimUser, models.Notifier) {
+	userName := strings.TrimSpace(user.UserName)
+	if userName == "" {
+		return nil, services.ScimUserNameRequired
+	}
+
+	email := scimPrimaryEmail(user)
+	if email == "" {
+		return nil, services.ScimEmailRequired
+	}
+
+	if userName != existing.Name {
+		if userName == ROOT_NAME {
+			return nil, services.ScimUserExists
+		}
+
+		if other, err := self.userDao.FindByUsername(ctx, userName); err == nil && other.Id != existing.Id {
+			return nil, services.ScimUserExists
+		} else if err != nil && err != database.NotFound {
+			panic(err)
+		}
+	}
+
+	err := self.userDao.UpdateUser(ctx, existing.Id, userName, email, user.ExternalId)
+	if err == database.Duplicate {
+		return nil, services.ScimUserExists
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	if user.Password != "" {
+		encodedHash, err := createHash(self.passwordConfig, user.Password)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := self.userDao.ChangePassword(ctx, existing.Id, encodedHash); err != nil {
+			panic(err)
+		}
+	}
+
+	if user.Active != nil && *user.Active != existing.Active {
+		self.setActive(ctx, existing.Id, *user.Active)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditScimUserUpdate,
+		Target: "/user/" + existing.Id,
+		Detail: userName,
+	})
+
+	return self.GetUser(ctx, existing.Id)
+}
+
+// setActive enables or disables a user. Disabled users have their refresh
+// tokens revoked and the cached policies dropped so the policy provider
+// stops granting them anything.
+func (self *ScimRepository) setActive(ctx context.Context, id string, active bool) {
+	if err := self.userDao.SetActive(ctx, id, active); err != nil {
+		panic(err)
+	}
+
+	action := AuditScimUserActivate
+	if !active {
+		action = AuditScimUserDeactivate
+
+		if err := self.appDao.DeleteUserRefreshTokens(ctx, id); err != nil {
+			panic(err)
+		}
+	}
+
+	self.accessControlService.Invalidate(ctx, id)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: action,
+		Target: "/user/" + id,
+	})
+}
+
+func (self *ScimRepository) findUser(
+	ctx context.Context,
+	id string,
+) (*database.UserEntity, models.Notifier) {
+	user, err := self.userDao.FindById(ctx, id)
+	if err == database.NotFound {
+		return nil, services.ScimUserNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return user, nil
+}
+
+func (self *ScimRepository) findMutableUser(
+	ctx context.Context,
+	id string,
+) (*database.UserEntity, models.Notifier) {
+	if id == ROOT_NAME {
+		return nil, services.ScimRootImmutable
+	}
+
+	return self.findUser(ctx, id)
+}
+
+func (self *ScimRepository) toScimUser(user *database.UserEntity) models.ScimUser {
+	active := user.Active
+	created := user.CreatedAt
+	updated := user.UpdatedAt
+
+	return models.ScimUser{
+		Schemas:     []string{models.ScimUserSchema},
+		Id:          user.Id,
+		ExternalId:  user.ExternalId,
+		UserName:    user.Name,
+		DisplayName: user.Name,
+		Emails: []models.ScimEmail{
+			{Value: user.Email, Type: "work", Primary: true},
+		},
+		Active: &active,
+		Meta: &models.ScimMeta{
+			ResourceType: "User",
+			Created:      &created,
+			LastModified: &updated,
+			Location:     self.baseUrl + "/scim/v2/Users/" + user.Id,
+		},
+	}
+}
+
+// patchUserAttribute applies a single operation to the user. Attributes
+// that aren't stored, like name or title, are ignored.
+func patchUserAttribute(
+	user *models.ScimUser,
+	op string,
+	path *scim.Path,
+	value json.RawMessage,
+) models.Notifier {
+	switch path.Attribute {
+	case "username":
+		if op == "remove" {
+			return services.ScimUserNameRequired
+		}
+
+		userName, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		user.UserName = userName
+	case "externalid":
+		if op == "remove" {
+			user.ExternalId = ""
+			return nil
+		}
+
+		externalId, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		user.ExternalId = externalId
+	case "active":
+		if op == "remove" {
+			return services.NewScimServiceError(400, "mutability", "active can't be removed")
+		}
+
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = &active
+	case "password":
+		password, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		user.Password = password
+	case "emails", "emails.value":
+		// Users only have the one address so every change replaces it
+		if op == "remove" {
+			return services.ScimEmailRequired
+		}
+
+		if path.Attribute == "emails" && path.Filter == nil && path.SubAttribute == "" {
+			var emails []models.ScimEmail
+			if err := json.Unmarshal(value, &emails); err != nil {
+				return services.NewScimServiceError(400, "invalidValue", "emails must be a list")
+			}
+			user.Emails = emails
+			return nil
+		}
+
+		email, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		user.Emails = []models.ScimEmail{{Value: email, Primary: true}}
+	}
+
+	return nil
+}
+
+// scimPrimaryEmail picks the primary email, falling back to the first one
+// and then to the userName if it looks like an address.
+func scimPrimaryEmail(user *models.ScimUser) string {
+	for _, email := range user.Emails {
+		if email.Primary {
+			return strings.TrimSpace(email.Value)
+		}
+	}
+
+	if len(user.Emails) > 0 {
+		return strings.TrimSpace(user.Emails[0].Value)
+	}
+
+	if strings.Contains(user.UserName, "@") {
+		return strings.TrimSpace(user.UserName)
+	}
+
+	return ""
+}
+
+//==============================================================================
+// Groups
+//==============================================================================
+
+// ListGroups implements services.ScimService.
+func (self *ScimRepository) ListGroups(
+	ctx context.Context,
+	query models.ScimQuery,
+) (*models.ScimListResponse, models.Notifier) {
+	filters, filterErr := scimFilters(query.Filter, scimGroupColumns)
+	if filterErr != nil {
+		return nil, filterErr
+	}
+
+	offset, limit := scimPage(query)
+	data, total, err := self.organizationDao.SearchOrganizations(ctx, filters, offset, limit)
+	if err == database.InvalidFilter {
+		return nil, services.NewScimServiceError(400, "invalidFilter", "Unsupported filter")
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Clients that only want the groups themselves can skip loading members
+	excludeMembers := false
+	for _, attribute := range query.ExcludedAttributes {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			excludeMembers = true
+		}
+	}
+
+	groups := make([]models.ScimGroup, len(data))
+	for i := range data {
+		var members []database.UserEntity
+		if !excludeMembers {
+			members = self.groupMembers(ctx, data[i].Id)
+		}
+
+		groups[i] = self.toScimGroup(&data[i], members)
+	}
+
+	return scimListResponse(total, offset, groups, len(groups)), nil
+}
+
+// GetGroup implements services.ScimService.
+func (self *ScimRepository) GetGroup(ctx context.Context, id string) (*models.ScimGroup, models.Notifier) {
+	org, err := self.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := self.toScimGroup(org, self.groupMembers(ctx, id))
+	return &result, nil
+}
+
+// CreateGroup implements services.ScimService.
+func (self *ScimRepository) CreateGroup(
+	ctx context.Context,
+	group *models.ScimGroup,
+) (*models.ScimGroup, models.Notifier) {
+	name := strings.TrimSpace(group.DisplayName)
+	if name == "" {
+		return nil, services.ScimDisplayNameRequired
+	}
+
+	memberIds, memberErr := self.checkMembers(ctx, scimMemberIds(group.Members))
+	if memberErr != nil {
+		return nil, memberErr
+	}
+
+	id := uuid.New().String()
+	_, err := self.organizationDao.CreateOrganization(ctx, id, name, "")
+	if err == database.Duplicate {
+		return nil, services.ScimGroupExists
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	if group.ExternalId != "" {
+		if err := self.organizationDao.UpdateOrganization(ctx, id, name, group.ExternalId); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, userId := range memberIds {
+		self.addMember(ctx, id, userId)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditScimGroupCreate,
+		Target: "/org/" + id,
+		Detail: name,
+	})
+
+	return self.GetGroup(ctx, id)
+}
+
+// ReplaceGroup implements services.ScimService.
+func (self *ScimRepository) ReplaceGroup(
+	ctx context.Context,
+	id string,
+	group *models.ScimGroup,
+) (*models.ScimGroup, models.Notifier) {
+	org, err := self.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.saveGroup(ctx, org, group.DisplayName, group.ExternalId, scimMemberIds(group.Members))
+}
+
+type scimGroupPatch struct {
+	displayName string
+	externalId  string
+	members     map[string]bool
+}
+
+// PatchGroup implements services.ScimService.
+func (self *ScimRepository) PatchGroup(
+	ctx context.Context,
+	id string,
+	operations []models.ScimPatchOperation,
+) (*models.ScimGroup, models.Notifier) {
+	org, err := self.findGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := &scimGroupPatch{
+		displayName: org.Name,
+		externalId:  org.ExternalId,
+		members:     make(map[string]bool),
+	}
+	for _, member := range self.groupMembers(ctx, id) {
+		patch.members[member.Id] = true
+	}
+
+	for _, operation := range operations {
+		op, path, value, err := scimOperation(operation)
+		if err != nil {
+			return nil, err
+		}
+
+		if path == nil {
+			for key, attributeValue := range value {
+				attributePath, pathErr := scim.ParsePath(key)
+				if pathErr != nil {
+					return nil, services.NewScimServiceError(400, "invalidPath", pathErr.Error())
+				}
+
+				if err := patchGroupAttribute(patch, op, attributePath, attributeValue); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if err := patchGroupAttribute(patch, op, path, operation.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	memberIds := make([]string, 0, len(patch.members))
+	for userId := range patch.members {
+		memberIds = append(memberIds, userId)
+	}
+	sort.Strings(memberIds)
+
+	return self.saveGroup(ctx, org, patch.displayName, patch.externalId, memberIds)
+}
+
+// DeleteGroup implements services.ScimService.
+func (self *ScimRepository) DeleteGroup(ctx context.Context, id string) models.Notifier {
+	if _, err := self.findGroup(ctx, id); err != nil {
+		return err
+	}
+
+	members := self.groupMembers(ctx, id)
+
+	if err := self.organizationDao.RemoveAllUsers(ctx, id); err != nil {
+		panic(err)
+	}
+
+	if err := self.organizationDao.RemoveAllPolicySets(ctx, id); err != nil {
+		panic(err)
+	}
+
+	if err := self.organizationDao.DeleteOrganization(ctx, id); err != nil {
+		panic(err)
+	}
+
+	for _, member := range members {
+		self.accessControlService.Invalidate(ctx, member.Id)
+		self.emitMemberLeft(ctx, id, member.Id)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditScimGroupDelete,
+		Target: "/org/" + id,
+	})
+
+	return nil
+}
+
+func (self *ScimRepository) saveGroup(
+	ctx context.Context,
+	org *database.OrganizationEntity,
+	displayName, externalId string,
+	memberIds []string,
+) (*models.ScimGroup, models.Notifier) {
+	name := strings.TrimSpace(displayName)
+	if name == "" {
+		return nil, services.ScimDisplayNameRequired
+	}
+
+	current := make(map[string]bool)
+	for _, member := range self.groupMembers(ctx, org.Id) {
+		current[member.Id] = true
+	}
+
+	added := make([]string, 0)
+	wanted := make(map[string]bool)
+	for _, userId := range memberIds {
+		wanted[userId] = true
+		if !current[userId] {
+			added = append(added, userId)
+		}
+	}
+
+	added, memberErr := self.checkMembers(ctx, added)
+	if memberErr != nil {
+		return nil, memberErr
+	}
+
+	if name != org.Name || externalId != org.ExternalId {
+		err := self.organizationDao.UpdateOrganization(ctx, org.Id, name, externalId)
+		if err == database.Duplicate {
+			return nil, services.ScimGroupExists
+		}
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, userId := range added {
+		self.addMember(ctx, org.Id, userId)
+	}
+
+	for userId := range current {
+		if !wanted[userId] {
+			self.removeMember(ctx, org.Id, userId)
+		}
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditScimGroupUpdate,
+		Target: "/org/" + org.Id,
+		Detail: name,
+	})
+
+	return self.GetGroup(ctx, org.Id)
+}
+
+// checkMembers makes sure every member is an existing user, dropping
+// duplicates along the way.
+func (self *ScimRepository) checkMembers(
+	ctx context.Context,
+	userIds []string,
+) ([]string, models.Notifier) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(userIds))
+
+	for _, userId := range userIds {
+		if seen[userId] {
+			continue
+		}
+		seen[userId] = true
+
+		if _, err := self.userDao.FindById(ctx, userId); err == database.NotFound {
+			return nil, services.NewScimServiceError(400, "invalidValue", "Unknown member "+userId)
+		} else if err != nil {
+			panic(err)
+		}
+
+		result = append(result, userId)
+	}
+
+	return result, nil
+}
+
+func (self *ScimRepository) addMember(ctx context.Context, orgId, userId string) {
+	err := self.organizationDao.AddUser(ctx, orgId, userId)
+	if err == database.Duplicate {
+		return
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	self.accessControlService.Invalidate(ctx, userId)
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type:  models.EventOrgMemberJoined,
+		OrgId: orgId,
+		Data: models.OrgMemberEventData{
+			OrgId:  orgId,
+			UserId: userId,
+		},
+	})
+}
+
+func (self *ScimRepository) removeMember(ctx context.Context, orgId, userId string) {
+	if err := self.organizationDao.RemoveUser(ctx, orgId, userId); err != nil {
+		panic(err)
+	}
+
+	self.accessControlService.Invalidate(ctx, userId)
+	self.emitMemberLeft(ctx, orgId, userId)
+}
+
+func (self *ScimRepository) emitMemberLeft(ctx context.Context, orgId, userId string) {
+	self.eventEmitter.Emit(ctx, models.WebhookEvent{
+		Type:  models.EventOrgMemberLeft,
+		OrgId: orgId,
+		Data: models.OrgMemberEventData{
+			OrgId:  orgId,
+			UserId: userId,
+		},
+	})
+}
+
+func (self *ScimRepository) findGroup(
+	ctx context.Context,
+	id string,
+) (*database.OrganizationEntity, models.Notifier) {
+	org, err := self.organizationDao.FindById(ctx, id)
+	if err == database.NotFound {
+		return nil, services.ScimGroupNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return org, nil
+}
+
+func (self *ScimRepository) groupMembers(ctx context.Context, id string) []database.UserEntity {
+	members, err := self.organizationDao.GetUsers(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+
+	return members
+}
+
+func (self *ScimRepository) toScimGroup(
+	org *database.OrganizationEntity,
+	members []database.UserEntity,
+) models.ScimGroup {
+	group := models.ScimGroup{
+		Schemas:     []string{models.ScimGroupSchema},
+		Id:          org.Id,
+		ExternalId:  org.ExternalId,
+		DisplayName: org.Name,
+		Meta: &models.ScimMeta{
+			ResourceType: "Group",
+			Location:     self.baseUrl + "/scim/v2/Groups/" + org.Id,
+		},
+	}
+
+	for _, member := range members {
+		group.Members = append(group.Members, models.ScimMember{
+			Value:   member.Id,
+			Display: member.Name,
+			Ref:     self.baseUrl + "/scim/v2/Users/" + member.Id,
+		})
+	}
+
+	return group
+}
+
+// patchGroupAttribute applies a single operation to the group. Unknown
+// attributes are ignored like they are for users.
+func patchGroupAttribute(
+	patch *scimGroupPatch,
+	op string,
+	path *scim.Path,
+	value json.RawMessage,
+) models.Notifier {
+	switch path.Attribute {
+	case "displayname":
+		if op == "remove" {
+			return services.ScimDisplayNameRequired
+		}
+
+		displayName, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		patch.displayName = displayName
+	case "externalid":
+		if op == "remove" {
+			patch.externalId = ""
+			return nil
+		}
+
+		externalId, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		patch.externalId = externalId
+	case "members":
+		// members[value eq "<id>"] picks out a single member to remove
+		if path.Filter != nil {
+			if op != "remove" {
+				return services.NewScimServiceError(400, "invalidPath", "Filtered member paths can only be removed")
+			}
+
+			for _, comparison := range path.Filter {
+				userId, ok := comparison.Value.(string)
+				if comparison.Attribute != "value" || comparison.Operator != "eq" || !ok {
+					return services.NewScimServiceError(400, "invalidFilter", "Members can only be selected by value")
+				}
+				delete(patch.members, userId)
+			}
+			return nil
+		}
+
+		var members []models.ScimMember
+		if len(value) > 0 {
+			if err := json.Unmarshal(value, &members); err != nil {
+				return services.NewScimServiceError(400, "invalidValue", "members must be a list")
+			}
+		}
+
+		switch op {
+		case "add":
+			for _, member := range members {
+				patch.members[member.Value] = true
+			}
+		case "replace":
+			patch.members = make(map[string]bool)
+			for _, member := range members {
+				patch.members[member.Value] = true
+			}
+		case "remove":
+			if len(members) == 0 {
+				patch.members = make(map[string]bool)
+			}
+
+			for _, member := range members {
+				delete(patch.members, member.Value)
+			}
+		}
+	}
+
+	return nil
+}
+
+func scimMemberIds(members []models.ScimMember) []string {
+	ids := make([]string, len(members))
+	for i, member := range members {
+		ids[i] = member.Value
+	}
+
+	return ids
+}
+
+//==============================================================================
+
+// scimOperation validates a PATCH operation. Operations without a path
+// carry an object of attributes which is returned instead of a path.
+func scimOperation(
+	operation models.ScimPatchOperation,
+) (string, *scim.Path, map[string]json.RawMessage, models.Notifier) {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return "", nil, nil, services.NewScimServiceError(400, "invalidSyntax", "Unknown operation "+operation.Op)
+	}
+
+	if operation.Path != "" {
+		path, err := scim.ParsePath(operation.Path)
+		if err != nil {
+			return "", nil, nil, services.NewScimServiceError(400, "invalidPath", err.Error())
+		}
+
+		return op, path, nil, nil
+	}
+
+	if op == "remove" {
+		return "", nil, nil, services.NewScimServiceError(400, "noTarget", "remove needs a path")
+	}
+
+	var value map[string]json.RawMessage
+	if err := json.Unmarshal(operation.Value, &value); err != nil {
+		return "", nil, nil, services.NewScimServiceError(400, "invalidValue", "Operations without a path need an object value")
+	}
+
+	return op, nil, value, nil
+}
+
+func scimFilters(filter string, columns map[string]string) ([]database.Filter, models.Notifier) {
+	comparisons, err := scim.ParseFilter(filter)
+	if err != nil {
+		return nil, services.NewScimServiceError(400, "invalidFilter", err.Error())
+	}
+
+	filters := make([]database.Filter, len(comparisons))
+	for i, comparison := range comparisons {
+		column, ok := columns[comparison.Attribute]
+		if !ok {
+			return nil, services.NewScimServiceError(400, "invalidFilter", "Filtering on "+comparison.Attribute+" isn't supported")
+		}
+
+		filters[i] = database.Filter{
+			Column:   column,
+			Operator: comparison.Operator,
+			Value:    comparison.Value,
+		}
+	}
+
+	return filters, nil
+}
+
+func scimPage(query models.ScimQuery) (int, int) {
+	offset := query.StartIndex - 1
+	if offset < 0 {
+		offset = 0
+	}
+
+	limit := query.Count
+	if limit < 0 {
+		limit = 0
+	}
+
+	if limit > SCIM_MAX_COUNT {
+		limit = SCIM_MAX_COUNT
+	}
+
+	return offset, limit
+}
+
+func scimListResponse(total, offset int, resources interface{}, count int) *models.ScimListResponse {
+	return &models.ScimListResponse{
+		Schemas:      []string{models.ScimListResponseSchema},
+		TotalResults: total,
+		StartIndex:   offset + 1,
+		ItemsPerPage: count,
+		Resources:    resources,
+	}
+}
+
+func scimString(value json.RawMessage) (string, models.Notifier) {
+	var result string
+	if err := json.Unmarshal(value, &result); err != nil {
+		return "", services.NewScimServiceError(400, "invalidValue", "Expected a string")
+	}
+
+	return result, nil
+}
+
+// scimBool also accepts strings since some clients send "True" and "False".
+func scimBool(value json.RawMessage) (bool, models.Notifier) {
+	var result bool
+	if err := json.Unmarshal(value, &result); err == nil {
+		return result, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		if result, err := strconv.ParseBool(text); err == nil {
+			return result, nil
+		}
+	}
+
+	return false, services.NewScimServiceError(400, "invalidValue", "Expected a boolean")
+}
+
+// var _ services.ScimService = (*ScimRepository)(nil)
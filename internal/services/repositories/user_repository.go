@@ -10,18 +10,33 @@ import (
 	"github.com/jhamill34/notion-provisioner/internal/services"
 )
 
+// UserResources are the resources and actions enforced by UserRepository.
+var UserResources = []models.ResourceDefinition{
+	{Pattern: "/user", Actions: []string{"list"}},
+	{Pattern: "/user/{id}", Actions: []string{"read"}},
+	{Pattern: "/user/{id}/policy", Actions: []string{"create", "list"}},
+	{Pattern: "/user/{id}/policy/{policyId}", Actions: []string{"delete"}},
+	{Pattern: "/user/{id}/policy/explain", Actions: []string{"read"}},
+}
+
 type UserRepository struct {
 	userDao              *dao.UserDao
 	accessControlService services.AccessControlService
+	policyValidator      services.PolicyValidator
+	auditService         services.AuditService
 }
 
 func NewUserRepository(
 	userDao *dao.UserDao,
 	accessControlService services.AccessControlService,
+	policyValidator services.PolicyValidator,
+	auditService services.AuditService,
 ) *UserRepository {
 	return &UserRepository{
 		userDao:              userDao,
 		accessControlService: accessControlService,
+		policyValidator:      policyValidator,
+		auditService:         auditService,
 	}
 }
 
@@ -36,12 +51,17 @@ func (self *UserRepository) ListUsers(ctx context.Context) ([]models.User, model
 		panic(err)
 	}
 
+	resources := make([]string, len(data))
+	for i, user := range data {
+		resources[i] = "/user/" + user.Id
+	}
+	allowed := self.accessControlService.EnforceMany(ctx, resources, "read", nil)
+
 	users := make([]models.User, len(data))
 
 	i := 0
-	for _, user := range data {
-		if acErr := self.accessControlService.Enforce(ctx, "/user/"+user.Id, "read"); acErr == nil &&
-			user.Id != "ROOT" {
+	for j, user := range data {
+		if allowed[j] && user.Id != "ROOT" {
 			users[i] = models.User{
 				UserId: user.Id,
 				Name:   user.Name,
@@ -96,10 +116,11 @@ func (self *UserRepository) ListPolicies(
 	permissions := make([]models.Policy, len(data))
 	for i, permission := range data {
 		permissions[i] = models.Policy{
-			PolicyId: permission.Id,
-			Resource: permission.Resource,
-			Action:   permission.Action,
-			Effect:   permission.Effect,
+			PolicyId:  permission.Id,
+			Resource:  permission.Resource,
+			Action:    permission.Action,
+			Effect:    permission.Effect,
+			Condition: permission.Condition,
 		}
 	}
 
@@ -112,16 +133,26 @@ func (self *UserRepository) CreatePolicy(
 	resource string,
 	action string,
 	effect string,
+	condition string,
 ) models.Notifier {
 	if acErr := self.accessControlService.Enforce(ctx, "/user/"+id+"/policy", "create"); acErr != nil {
 		return acErr
 	}
 
-	if err := self.userDao.CreatePermission(ctx, id, resource, action, effect); err != nil {
+	if validationErr := self.policyValidator.Validate(resource, action, effect, condition); validationErr != nil {
+		return validationErr
+	}
+
+	if err := self.userDao.CreatePermission(ctx, id, resource, action, effect, condition); err != nil {
 		panic(err)
 	}
 
 	self.accessControlService.Invalidate(ctx, id)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicyCreate,
+		Target: "/user/" + id,
+		Detail: policyDetail(resource, action, effect, condition),
+	})
 
 	return nil
 }
@@ -139,8 +170,33 @@ func (self *UserRepository) DeletePolicy(
 	}
 
 	self.accessControlService.Invalidate(ctx, id)
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditPolicyDelete,
+		Target: "/user/" + id,
+		Detail: fmt.Sprintf("policy %d", policyId),
+	})
 
 	return nil
 }
 
+// ExplainPolicy implements services.UserService.
+func (self *UserRepository) ExplainPolicy(
+	ctx context.Context,
+	id string,
+	resource string,
+	action string,
+) (*models.PolicyExplanation, models.Notifier) {
+	if acErr := self.accessControlService.Enforce(ctx, "/user/"+id+"/policy/explain", "read"); acErr != nil {
+		return nil, acErr
+	}
+
+	if _, err := self.userDao.FindById(ctx, id); err == database.NotFound {
+		return nil, services.UserNotFound
+	} else if err != nil {
+		panic(err)
+	}
+
+	return self.accessControlService.Explain(ctx, id, resource, action), nil
+}
+
 // var _ services.UserService = (*UserRepository)(nil)
@@ -0,0 +1,383 @@
+package repositories
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/services/webhook"
+)
+
+// WebhookResources are the resources and actions enforced by WebhookRepository.
+var WebhookResources = []models.ResourceDefinition{
+	{Pattern: "/webhook", Actions: []string{"list"}},
+	{Pattern: "/webhook/dead", Actions: []string{"list"}},
+	{Pattern: "/webhook/{id}", Actions: []string{"read", "delete"}},
+	{Pattern: "/webhook/{id}/delivery", Actions: []string{"list"}},
+	{Pattern: "/webhook/{id}/delivery/{deliveryId}", Actions: []string{"update"}},
+	{Pattern: "/oauth/application/{id}/webhook", Actions: []string{"create"}},
+	{Pattern: "/org/{id}/webhook", Actions: []string{"create"}},
+	{Pattern: "/webhook/global", Actions: []string{"create"}},
+}
+
+const (
+	WebhookOwnerApp = "app"
+	WebhookOwnerOrg = "org"
+)
+
+// Only the most recent deliveries are shown in the delivery log.
+const WEBHOOK_DELIVERY_LIMIT = 100
+
+type WebhookRepository struct {
+	webhookDao           *dao.WebhookDao
+	appDao               *dao.ApplicationDao
+	organizationDao      *dao.OrganizationDao
+	accessControlService services.AccessControlService
+	auditService         services.AuditService
+}
+
+func NewWebhookRepository(
+	webhookDao *dao.WebhookDao,
+	appDao *dao.ApplicationDao,
+	organizationDao *dao.OrganizationDao,
+	accessControlService services.AccessControlService,
+	auditService services.AuditService,
+) *WebhookRepository {
+	return &WebhookRepository{
+		webhookDao:           webhookDao,
+		appDao:               appDao,
+		organizationDao:      organizationDao,
+		accessControlService: accessControlService,
+		auditService:         auditService,
+	}
+}
+
+// ListWebhooks implements services.WebhookService.
+func (self *WebhookRepository) ListWebhooks(ctx context.Context) ([]models.Webhook, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/webhook", "list"); err != nil {
+		return nil, err
+	}
+
+	data, err := self.webhookDao.List(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	resources := make([]string, len(data))
+	for i, webhook := range data {
+		resources[i] = "/webhook/" + webhook.Id
+	}
+	allowed := self.accessControlService.EnforceMany(ctx, resources, "read", nil)
+
+	webhooks := make([]models.Webhook, 0, len(data))
+	for i, webhook := range data {
+		if allowed[i] {
+			webhooks = append(webhooks, toWebhook(&webhook))
+		}
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook implements services.WebhookService.
+func (self *WebhookRepository) GetWebhook(
+	ctx context.Context,
+	id string,
+) (*models.Webhook, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/webhook/"+id, "read"); err != nil {
+		return nil, err
+	}
+
+	webhook, err := self.webhookDao.FindById(ctx, id)
+	if err == database.NotFound {
+		return nil, services.WebhookNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	result := toWebhook(webhook)
+	return &result, nil
+}
+
+// CreateWebhook implements services.WebhookService.
+// The signing secret is only ever returned here. Application webhooks are
+// global, they see events from every org, so they also need the create
+// action on /webhook/global.
+func (self *WebhookRepository) CreateWebhook(
+	ctx context.Context,
+	ownerType, ownerId, webhookUrl string,
+	events []string,
+) (*models.Webhook, string, models.Notifier) {
+	switch ownerType {
+	case WebhookOwnerApp:
+		if err := self.accessControlService.Enforce(ctx, "/oauth/application/"+ownerId+"/webhook", "create"); err != nil {
+			return nil, "", err
+		}
+
+		if err := self.accessControlService.Enforce(ctx, "/webhook/global", "create"); err != nil {
+			return nil, "", err
+		}
+
+		if _, err := self.appDao.FindById(ctx, ownerId); err == database.NotFound {
+			return nil, "", services.AppNotFound
+		} else if err != nil {
+			panic(err)
+		}
+	case WebhookOwnerOrg:
+		if err := self.accessControlService.Enforce(ctx, "/org/"+ownerId+"/webhook", "create"); err != nil {
+			return nil, "", err
+		}
+
+		if _, err := self.organizationDao.FindById(ctx, ownerId); err == database.NotFound {
+			return nil, "", services.OrganizationNotFound
+		} else if err != nil {
+			panic(err)
+		}
+	default:
+		return nil, "", services.InvalidWebhookOwner
+	}
+
+	parsed, err := url.Parse(webhookUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, "", services.InvalidWebhookUrl
+	}
+
+	if !webhook.PublicHost(ctx, parsed.Hostname()) {
+		return nil, "", services.PrivateWebhookUrl
+	}
+
+	if len(events) == 0 {
+		return nil, "", services.NoWebhookEvents
+	}
+
+	for _, event := range events {
+		if !containsScope(models.WebhookEvents, event) {
+			return nil, "", services.UnknownWebhookEvent
+		}
+	}
+
+	secretBytes, err := randomBytes(32)
+	if err != nil {
+		panic(err)
+	}
+	secret := "whsec_" + hex.EncodeToString(secretBytes)
+
+	// The secret is kept as is rather than hashed since every delivery
+	// needs it to compute the signature.
+	entity := &database.WebhookEntity{
+		Id:        uuid.New().String(),
+		OwnerType: ownerType,
+		OwnerId:   ownerId,
+		Url:       webhookUrl,
+		Secret:    secret,
+		Events:    strings.Join(events, " "),
+		Global:    ownerType == WebhookOwnerApp,
+		CreatedAt: time.Now(),
+	}
+
+	if err := self.webhookDao.Create(ctx, entity); err != nil {
+		panic(err)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditWebhookCreate,
+		Target: "/webhook/" + entity.Id,
+		Detail: ownerType + " " + ownerId + " " + webhookUrl,
+	})
+
+	result := toWebhook(entity)
+	return &result, secret, nil
+}
+
+// DeleteWebhook implements services.WebhookService.
+func (self *WebhookRepository) DeleteWebhook(ctx context.Context, id string) models.Notifier {
+	if err := self.accessControlService.Enforce(ctx, "/webhook/"+id, "delete"); err != nil {
+		return err
+	}
+
+	if err := self.webhookDao.Delete(ctx, id); err != nil {
+		panic(err)
+	}
+
+	self.auditService.Record(ctx, models.AuditEvent{
+		Action: AuditWebhookDelete,
+		Target: "/webhook/" + id,
+	})
+
+	return nil
+}
+
+// ListDeliveries implements services.WebhookService.
+func (self *WebhookRepository) ListDeliveries(
+	ctx context.Context,
+	id string,
+) ([]models.WebhookDelivery, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/webhook/"+id+"/delivery", "list"); err != nil {
+		return nil, err
+	}
+
+	data, err := self.webhookDao.ListDeliveries(ctx, id, WEBHOOK_DELIVERY_LIMIT)
+	if err != nil {
+		panic(err)
+	}
+
+	deliveries := make([]models.WebhookDelivery, len(data))
+	for i, delivery := range data {
+		deliveries[i] = toWebhookDelivery(&delivery)
+	}
+
+	return deliveries, nil
+}
+
+// ListDeadDeliveries implements services.WebhookService.
+func (self *WebhookRepository) ListDeadDeliveries(
+	ctx context.Context,
+) ([]models.WebhookDelivery, models.Notifier) {
+	if err := self.accessControlService.Enforce(ctx, "/webhook/dead", "list"); err != nil {
+		return nil, err
+	}
+
+	data, err := self.webhookDao.ListDead(ctx, WEBHOOK_DELIVERY_LIMIT)
+	if err != nil {
+		panic(err)
+	}
+
+	resources := make([]string, len(data))
+	for i, delivery := range data {
+		resources[i] = "/webhook/" + delivery.WebhookId + "/delivery"
+	}
+	allowed := self.accessControlService.EnforceMany(ctx, resources, "list", nil)
+
+	deliveries := make([]models.WebhookDelivery, 0, len(data))
+	for i, delivery := range data {
+		if allowed[i] {
+			deliveries = append(deliveries, toWebhookDelivery(&delivery))
+		}
+	}
+
+	return deliveries, nil
+}
+
+// RetryDelivery implements services.WebhookService.
+func (self *WebhookRepository) RetryDelivery(
+	ctx context.Context,
+	id string,
+	deliveryId int64,
+) models.Notifier {
+	resource := "/webhook/" + id + "/delivery/" + strconv.FormatInt(deliveryId, 10)
+	if err := self.accessControlService.Enforce(ctx, resource, "update"); err != nil {
+		return err
+	}
+
+	err := self.webhookDao.Retry(ctx, id, deliveryId, time.Now().Truncate(time.Second))
+	if err == database.NotFound {
+		return services.DeliveryNotFound
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return nil
+}
+
+//==============================================================================
+
+// WebhookEmitter queues events for every webhook subscribed to them. It
+// doesn't enforce anything since events are produced by the services
+// themselves, and is all the app service needs to take part in webhooks.
+type WebhookEmitter struct {
+	webhookDao *dao.WebhookDao
+}
+
+func NewWebhookEmitter(webhookDao *dao.WebhookDao) *WebhookEmitter {
+	return &WebhookEmitter{webhookDao}
+}
+
+// Emit implements services.EventEmitter.
+func (self *WebhookEmitter) Emit(ctx context.Context, event models.WebhookEvent) {
+	webhooks, err := self.webhookDao.FindSubscribers(ctx, event.OrgId)
+	if err != nil {
+		panic(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	eventId := uuid.New().String()
+
+	payload, err := json.Marshal(models.WebhookPayload{
+		Id:        eventId,
+		Type:      event.Type,
+		CreatedAt: now,
+		Data:      event.Data,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	deliveries := make([]database.WebhookDeliveryEntity, 0)
+	for _, webhook := range webhooks {
+		if !containsScope(strings.Fields(webhook.Events), event.Type) {
+			continue
+		}
+
+		deliveries = append(deliveries, database.WebhookDeliveryEntity{
+			WebhookId:     webhook.Id,
+			EventId:       eventId,
+			Event:         event.Type,
+			Payload:       string(payload),
+			NextAttemptAt: now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := self.webhookDao.Enqueue(ctx, deliveries); err != nil {
+		panic(err)
+	}
+}
+
+//==============================================================================
+
+func toWebhook(webhook *database.WebhookEntity) models.Webhook {
+	return models.Webhook{
+		WebhookId: webhook.Id,
+		OwnerType: webhook.OwnerType,
+		OwnerId:   webhook.OwnerId,
+		Url:       webhook.Url,
+		Events:    strings.Fields(webhook.Events),
+		Global:    webhook.Global,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+func toWebhookDelivery(delivery *database.WebhookDeliveryEntity) models.WebhookDelivery {
+	return models.WebhookDelivery{
+		DeliveryId:    delivery.Id,
+		WebhookId:     delivery.WebhookId,
+		EventId:       delivery.EventId,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		NextAttemptAt: delivery.NextAttemptAt,
+		LastStatus:    delivery.LastStatus,
+		LastError:     delivery.LastError,
+		CreatedAt:     delivery.CreatedAt,
+	}
+}
+
+// var _ services.WebhookService = (*WebhookRepository)(nil)
+// var _ services.EventEmitter = (*WebhookEmitter)(nil)
@@ -0,0 +1,77 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/jhamill34/notion-provisioner/internal/models"
+)
+
+// TokenSource supplies the service's own access token, it needs to be
+// granted the user:read scope.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// RemoteUserDirectory reads users from the auth server's SCIM endpoint.
+type RemoteUserDirectory struct {
+	usersUrl    string
+	httpClient  *http.Client
+	tokenSource TokenSource
+}
+
+func NewRemoteUserDirectory(
+	usersUrl string,
+	httpClient *http.Client,
+	tokenSource TokenSource,
+) *RemoteUserDirectory {
+	return &RemoteUserDirectory{usersUrl, httpClient, tokenSource}
+}
+
+// GetEmail implements services.UserDirectory. The primary email is
+// preferred when the user has more than one.
+func (self *RemoteUserDirectory) GetEmail(ctx context.Context, id string) (string, error) {
+	token, err := self.tokenSource.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", self.usersUrl+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	res, err := self.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("user request for %s failed with status %d", id, res.StatusCode)
+	}
+
+	var user models.ScimUser
+	if err := json.NewDecoder(res.Body).Decode(&user); err != nil {
+		return "", err
+	}
+
+	if len(user.Emails) == 0 {
+		return "", fmt.Errorf("user %s has no email", id)
+	}
+
+	for _, email := range user.Emails {
+		if email.Primary {
+			return email.Value, nil
+		}
+	}
+
+	return user.Emails[0].Value, nil
+}
+
+// var _ services.UserDirectory = (*RemoteUserDirectory)(nil)
@@ -0,0 +1,218 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Comparison is a single attribute expression from a SCIM filter such as
+// `userName eq "bjensen"`. Attributes and operators are lower cased since
+// SCIM treats them case insensitively.
+type Comparison struct {
+	Attribute string
+	Operator  string
+	Value     interface{}
+}
+
+// Path is the target of a PATCH operation, for example
+// `emails[type eq "work"].value` has the attribute "emails", a filter
+// selecting the work email and the sub attribute "value".
+type Path struct {
+	Attribute    string
+	Filter       []Comparison
+	SubAttribute string
+}
+
+var operators = map[string]bool{
+	"eq": true,
+	"ne": true,
+	"co": true,
+	"sw": true,
+	"ew": true,
+	"gt": true,
+	"ge": true,
+	"lt": true,
+	"le": true,
+	"pr": true,
+}
+
+// ParseFilter parses a filter made up of comparisons joined with "and".
+// Other logical operators and grouping aren't supported.
+func ParseFilter(filter string) ([]Comparison, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	comparisons := make([]Comparison, 0)
+	for i := 0; i < len(tokens); {
+		if i > 0 {
+			if tokens[i].kind != tokenWord || strings.ToLower(tokens[i].text) != "and" {
+				return nil, fmt.Errorf("unsupported expression %q, only \"and\" is supported", tokens[i].text)
+			}
+			i++
+		}
+
+		if i+1 >= len(tokens) || tokens[i].kind != tokenWord || tokens[i+1].kind != tokenWord {
+			return nil, errors.New("expected an attribute followed by an operator")
+		}
+
+		comparison := Comparison{
+			Attribute: normalizeAttribute(tokens[i].text),
+			Operator:  strings.ToLower(tokens[i+1].text),
+		}
+		i += 2
+
+		if !operators[comparison.Operator] {
+			return nil, fmt.Errorf("unknown operator %q", comparison.Operator)
+		}
+
+		if comparison.Operator != "pr" {
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("missing value for %q", comparison.Attribute)
+			}
+
+			value, err := tokens[i].value()
+			if err != nil {
+				return nil, err
+			}
+
+			comparison.Value = value
+			i++
+		}
+
+		comparisons = append(comparisons, comparison)
+	}
+
+	return comparisons, nil
+}
+
+// ParsePath parses the path of a PATCH operation.
+func ParsePath(path string) (*Path, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, errors.New("empty path")
+	}
+
+	open := strings.Index(path, "[")
+	if open == -1 {
+		return &Path{Attribute: normalizeAttribute(path)}, nil
+	}
+
+	end := strings.LastIndex(path, "]")
+	if end < open {
+		return nil, fmt.Errorf("unterminated filter in %q", path)
+	}
+
+	filter, err := ParseFilter(path[open+1 : end])
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Path{
+		Attribute: normalizeAttribute(path[:open]),
+		Filter:    filter,
+	}
+
+	if rest := path[end+1:]; rest != "" {
+		if !strings.HasPrefix(rest, ".") {
+			return nil, fmt.Errorf("unexpected %q after filter", rest)
+		}
+		result.SubAttribute = strings.ToLower(rest[1:])
+	}
+
+	return result, nil
+}
+
+// normalizeAttribute drops the schema URN from fully qualified attributes
+// and lower cases what's left.
+func normalizeAttribute(attribute string) string {
+	if strings.HasPrefix(strings.ToLower(attribute), "urn:") {
+		attribute = attribute[strings.LastIndex(attribute, ":")+1:]
+	}
+
+	return strings.ToLower(attribute)
+}
+
+//==============================================================================
+
+const (
+	tokenWord = iota
+	tokenString
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+func (self token) value() (interface{}, error) {
+	if self.kind == tokenString {
+		return self.text, nil
+	}
+
+	switch strings.ToLower(self.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	number, err := strconv.ParseFloat(self.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", self.text)
+	}
+
+	return number, nil
+}
+
+func tokenize(input string) ([]token, error) {
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(input); {
+		switch c := input[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(input) && input[end] != '"'; end++ {
+				if input[end] == '\\' {
+					end++
+				}
+			}
+
+			if end >= len(input) {
+				return nil, errors.New("unterminated string")
+			}
+
+			var text string
+			if err := json.Unmarshal([]byte(input[i:end+1]), &text); err != nil {
+				return nil, fmt.Errorf("invalid string %s", input[i:end+1])
+			}
+
+			tokens = append(tokens, token{tokenString, text})
+			i = end + 1
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			return nil, errors.New("grouping and complex attribute filters aren't supported")
+		default:
+			end := i
+			for end < len(input) && !strings.ContainsRune(" \t\n\r\"()[]", rune(input[end])) {
+				end++
+			}
+
+			tokens = append(tokens, token{tokenWord, input[i:end]})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,126 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Part is a piece of a snippet, Match is set on the words the search
+// matched so they can be highlighted.
+type Part struct {
+	Text  string
+	Match bool
+}
+
+// Terms splits a query into the lower case words it's made of, dropping
+// any punctuation.
+func Terms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !isWord(r)
+	})
+}
+
+// Snippet cuts about width characters out of text around the first whole
+// word matching one of the terms and splits it up so the matches can be
+// highlighted. Without a match it's the start of the text.
+func Snippet(text string, terms []string, width int) []Part {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	matches := findMatches(lower, terms)
+
+	start := 0
+	if len(matches) > 0 {
+		start = matches[0][0] - width/4
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	// Don't cut words in half
+	if start > 0 {
+		for start < end && isWord(runes[start-1]) {
+			start++
+		}
+	}
+	if end < len(runes) {
+		for end > start && isWord(runes[end]) {
+			end--
+		}
+	}
+
+	parts := make([]Part, 0)
+	if start > 0 {
+		parts = append(parts, Part{Text: "…"})
+	}
+
+	position := start
+	for _, match := range matches {
+		if match[0] < start {
+			continue
+		}
+		if match[1] > end {
+			break
+		}
+
+		if match[0] > position {
+			parts = append(parts, Part{Text: string(runes[position:match[0]])})
+		}
+		parts = append(parts, Part{Text: string(runes[match[0]:match[1]]), Match: true})
+		position = match[1]
+	}
+
+	if position < end {
+		parts = append(parts, Part{Text: string(runes[position:end])})
+	}
+	if end < len(runes) {
+		parts = append(parts, Part{Text: "…"})
+	}
+
+	return parts
+}
+
+// findMatches returns the [start, end) of every whole word in text that is
+// one of the terms, in order. text and terms are expected to be lower case.
+func findMatches(text []rune, terms []string) [][2]int {
+	matches := make([][2]int, 0)
+
+	for i := 0; i < len(text); i++ {
+		if i > 0 && isWord(text[i-1]) {
+			continue
+		}
+
+		longest := 0
+		for _, term := range terms {
+			length := len([]rune(term))
+			if length <= longest || i+length > len(text) {
+				continue
+			}
+			if i+length < len(text) && isWord(text[i+length]) {
+				continue
+			}
+			if string(text[i:i+length]) == term {
+				longest = length
+			}
+		}
+
+		if longest > 0 {
+			matches = append(matches, [2]int{i, i + longest})
+			i += longest - 1
+		}
+	}
+
+	return matches
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{}},
+		{query: "  ", want: []string{}},
+		{query: "Gopher", want: []string{"gopher"}},
+		{query: `"quoted" AND farm*`, want: []string{"quoted", "and", "farm"}},
+		{query: "café-crème 2024", want: []string{"café", "crème", "2024"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			got := Terms(test.query)
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// render writes the snippet with matches in brackets.
+func render(parts []Part) string {
+	var out strings.Builder
+	for _, part := range parts {
+		if part.Match {
+			out.WriteString("[" + part.Text + "]")
+		} else {
+			out.WriteString(part.Text)
+		}
+	}
+
+	return out.String()
+}
+
+func TestSnippet(t *testing.T) {
+	filler := strings.Repeat("filler words here ", 10)
+
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		width int
+		want  string
+	}{
+		{
+			name:  "short text is kept whole",
+			text:  "The Gopher farm",
+			terms: []string{"gopher"},
+			width: 100,
+			want:  "The [Gopher] farm",
+		},
+		{
+			name:  "every match is highlighted",
+			text:  "gopher and gopher",
+			terms: []string{"gopher"},
+			width: 100,
+			want:  "[gopher] and [gopher]",
+		},
+		{
+			name:  "only whole words match",
+			text:  "gophers like a gopher",
+			terms: []string{"gopher"},
+			width: 100,
+			want:  "gophers like a [gopher]",
+		},
+		{
+			name:  "whitespace is collapsed",
+			text:  "a\n\n  gopher\tfarm",
+			terms: []string{"gopher"},
+			width: 100,
+			want:  "a [gopher] farm",
+		},
+		{
+			name:  "without a match it's the start of the text",
+			text:  "one two three four five",
+			terms: []string{"zebra"},
+			width: 9,
+			want:  "one two…",
+		},
+		{
+			name:  "a match further in is cut around",
+			text:  filler + "the gopher shows up " + filler,
+			terms: []string{"gopher"},
+			width: 40,
+			want:  "…here the [gopher] shows up filler words…",
+		},
+		{
+			name:  "multi-byte text is cut between characters",
+			text:  strings.Repeat("é", 30) + " café " + strings.Repeat("ü", 30),
+			terms: []string{"café"},
+			width: 20,
+			want:  "…[café]…",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := render(Snippet(test.text, test.terms, test.width))
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+
+			if !utf8.ValidString(got) {
+				t.Errorf("snippet isn't valid UTF-8")
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"html/template"
 	"io"
 
 	"github.com/jhamill34/notion-provisioner/internal/models"
@@ -11,6 +12,20 @@ type TemplateService interface {
 	Render(w io.Writer, template string, layout string, model models.TemplateModel) error
 }
 
+// RenderService turns the markdown of posts and comments into HTML that's
+// safe to serve to readers.
+type RenderService interface {
+	// RenderPost renders the post's content, absolute makes relative links
+	// absolute for readers that don't know where the post came from.
+	RenderPost(id, content string, absolute bool) template.HTML
+	RenderPreview(content string) template.HTML
+	RenderComment(content string) template.HTML
+
+	// References finds what the markdown links to, for checking before
+	// it's saved.
+	References(content string) models.References
+}
+
 type Signer interface {
 	Sign(data []byte) (string, error)
 	Verify(data []byte, signature string) error
@@ -18,12 +33,39 @@ type Signer interface {
 
 type AccessControlService interface {
 	Enforce(ctx context.Context, resource string, action string) models.Notifier
+	EnforceWithAttributes(
+		ctx context.Context,
+		resource, action string,
+		attrs models.ResourceAttributes,
+	) models.Notifier
+	// EnforceMany checks the action on each resource, attrs[i] being the
+	// attributes of resources[i]. Nil attrs checks every resource without
+	// attributes, the same as Enforce, so conditions on the owner, org or
+	// visibility don't match.
+	EnforceMany(
+		ctx context.Context,
+		resources []string,
+		action string,
+		attrs []models.ResourceAttributes,
+	) []bool
+	Explain(ctx context.Context, id, resource, action string) *models.PolicyExplanation
+	PolicyClaim(ctx context.Context, id string) *models.PolicyClaim
 	Invalidate(ctx context.Context, id string)
 }
 
+type PolicyValidator interface {
+	Validate(resource, action, effect, condition string) models.Notifier
+	Resources() []models.ResourceDefinition
+}
+
 type SessionService interface {
 	Create(ctx context.Context, data *models.SessionData) string
 	Find(ctx context.Context, id string, data *models.SessionData) models.Notifier
 	UpdateCsrf(ctx context.Context, id, csrfToken string) models.Notifier
 	Destroy(ctx context.Context, id string)
 }
+
+// EventEmitter queues events for delivery to the webhooks subscribed to them.
+type EventEmitter interface {
+	Emit(ctx context.Context, event models.WebhookEvent)
+}
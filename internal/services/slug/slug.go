@@ -0,0 +1,27 @@
+package slug
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Make turns a name into something that can go in a URL: lower case
+// letters and numbers with a single dash between each word.
+func Make(name string) string {
+	var builder strings.Builder
+
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if dash && builder.Len() > 0 {
+				builder.WriteByte('-')
+			}
+			builder.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return builder.String()
+}
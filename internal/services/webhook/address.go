@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+var PrivateAddress = errors.New("webhook address isn't public")
+
+// BLOCKED_PREFIXES are ranges that aren't covered by the checks in netip
+// but still never lead anywhere on the internet.
+var BLOCKED_PREFIXES = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// PublicAddress reports whether webhooks may be sent to ip. Loopback,
+// private and link-local addresses reach things on our side of the network,
+// like the metadata service, so they never are.
+func PublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range BLOCKED_PREFIXES {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PublicHost reports whether every address host resolves to is public. It
+// only tells us about the host right now, the dispatcher checks again on
+// every connection since the DNS answer can change.
+func PublicHost(ctx context.Context, host string) bool {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return PublicAddress(ip)
+	}
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+
+	for _, ip := range ips {
+		if !PublicAddress(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dialPublic is a net.Dialer Control func, it runs once the address has
+// been resolved so a host can't pass PublicHost and then point somewhere
+// private by the time a delivery goes out.
+func dialPublic(network, address string, conn syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+
+	if !PublicAddress(addrPort.Addr()) {
+		return PrivateAddress
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jhamill34/notion-provisioner/internal/config"
+	"github.com/jhamill34/notion-provisioner/internal/database"
+	"github.com/jhamill34/notion-provisioner/internal/database/dao"
+)
+
+const (
+	SIGNATURE_HEADER = "X-Webhook-Signature"
+	EVENT_HEADER     = "X-Webhook-Event"
+	DELIVERY_HEADER  = "X-Webhook-Delivery"
+)
+
+// Dispatcher sends queued deliveries. The queue lives in the database so
+// nothing is lost across restarts, and several dispatchers can run at once
+// since each delivery is claimed before it is sent.
+type Dispatcher struct {
+	webhookDao *dao.WebhookDao
+	httpClient *http.Client
+	cfg        config.WebhookConfig
+}
+
+func NewDispatcher(webhookDao *dao.WebhookDao, cfg config.WebhookConfig) *Dispatcher {
+	// Every connection is checked against the address it actually dials,
+	// and nothing goes through a proxy that would hide it.
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		Control: dialPublic,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Dispatcher{
+		webhookDao: webhookDao,
+		httpClient: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// Don't follow redirects, the endpoint should be registered
+			// with its final URL.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cfg: cfg,
+	}
+}
+
+// Start polls for due deliveries until the context is done.
+func (self *Dispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(self.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		self.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (self *Dispatcher) dispatchDue(ctx context.Context) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	due, err := self.webhookDao.ListDue(ctx, now, self.cfg.BatchSize)
+	if err != nil {
+		log.Printf("Unable to load due webhook deliveries: %v\n", err)
+		return
+	}
+
+	// The lease has to outlast the request so nobody else picks it up
+	// while we're still waiting on the endpoint.
+	leaseUntil := now.Add(2 * self.cfg.Timeout).Truncate(time.Second)
+
+	var wg sync.WaitGroup
+	for i := range due {
+		delivery := &due[i]
+
+		claimed, err := self.webhookDao.Claim(ctx, delivery, leaseUntil)
+		if err != nil {
+			log.Printf("Unable to claim webhook delivery %d: %v\n", delivery.Id, err)
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			self.deliver(ctx, delivery)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (self *Dispatcher) deliver(ctx context.Context, delivery *database.PendingDeliveryEntity) {
+	status, sendErr := self.send(ctx, delivery)
+
+	var err error
+	if sendErr == nil {
+		err = self.webhookDao.MarkDelivered(ctx, delivery.Id, status)
+	} else {
+		attempt := delivery.Attempts + 1
+
+		var nextAttempt *time.Time
+		if attempt < self.cfg.MaxAttempts {
+			next := time.Now().UTC().Add(Backoff(attempt, self.cfg.InitialBackoff, self.cfg.MaxBackoff)).Truncate(time.Second)
+			nextAttempt = &next
+		} else {
+			log.Printf("Webhook delivery %d moved to the dead letter list: %v\n", delivery.Id, sendErr)
+		}
+
+		err = self.webhookDao.MarkFailed(ctx, delivery.Id, status, sendErr.Error(), nextAttempt)
+	}
+
+	if err != nil {
+		log.Printf("Unable to update webhook delivery %d: %v\n", delivery.Id, err)
+	}
+}
+
+func (self *Dispatcher) send(ctx context.Context, delivery *database.PendingDeliveryEntity) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EVENT_HEADER, delivery.Event)
+	req.Header.Set(DELIVERY_HEADER, delivery.EventId)
+	req.Header.Set(SIGNATURE_HEADER, "t="+strconv.FormatInt(timestamp, 10)+",v1="+Sign(delivery.Secret, timestamp, body))
+
+	res, err := self.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint responded with status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// Sign computes the signature receivers use to check a delivery came from
+// us: the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with the
+// webhook's secret. Including the timestamp lets receivers reject replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff doubles the wait after every failed attempt up to max.
+func Backoff(attempt int, initial, max time.Duration) time.Duration {
+	wait := initial
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= max {
+			return max
+		}
+	}
+
+	return wait
+}
@@ -133,9 +133,20 @@ func (m *TokenAuthMiddleware) AuthorizeMiddleware(next http.Handler) http.Handle
 			return
 		}
 
+		// Client tokens identify an app rather than a user so they never
+		// populate user_id
+		if claims.Typ == "client" {
+			ctx := context.WithValue(r.Context(), "client_app_id", claims.Sub)
+			ctx = context.WithValue(ctx, "client_scopes", strings.Fields(claims.Scope))
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 
 		ctx := context.WithValue(r.Context(), "user_id", claims.Sub)
 		ctx = context.WithValue(ctx, "raw_token", token)
+		if claims.Pol != nil {
+			ctx = context.WithValue(ctx, "policy_claim", *claims.Pol)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -153,6 +164,31 @@ func UnauthorizedMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// NewRequireScopeMiddleware only lets through requests made with a client
+// token that was granted one of the scopes.
+func NewRequireScopeMiddleware(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			grantedScopes, ok := r.Context().Value("client_scopes").([]string)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			for _, granted := range grantedScopes {
+				for _, scope := range scopes {
+					if granted == scope {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
+
 func RedirectToIndexMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := r.Context().Value("token")
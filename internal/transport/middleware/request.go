@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestMetadataMiddleware exposes the client IP and the request ID to
+// the services so they can be recorded without depending on chi. It must
+// run after chi's RequestID and RealIP middleware.
+func RequestMetadataMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+
+		ctx := context.WithValue(r.Context(), "request_ip", ip)
+		ctx = context.WithValue(ctx, "request_id", chimiddleware.GetReqID(r.Context()))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
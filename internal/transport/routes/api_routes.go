@@ -0,0 +1,658 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/transport/middleware"
+	"github.com/jhamill34/notion-provisioner/internal/transport/utils"
+)
+
+const (
+	API_DEFAULT_LIMIT = 50
+	API_MAX_LIMIT     = 200
+)
+
+// ApiRoutes exposes the admin features as JSON for automation. Requests
+// are authenticated with a user's bearer token and go through the same
+// services, and therefore the same policies, as the HTML routes.
+type ApiRoutes struct {
+	signer               services.Signer
+	accessControlService services.AccessControlService
+	authService          services.AuthService
+	userService          services.UserService
+	orgService           services.OrganizationService
+	appService           services.ApplicationService
+}
+
+func NewApiRoutes(
+	signer services.Signer,
+	accessControlService services.AccessControlService,
+	authService services.AuthService,
+	userService services.UserService,
+	orgService services.OrganizationService,
+	appService services.ApplicationService,
+) *ApiRoutes {
+	return &ApiRoutes{
+		signer:               signer,
+		accessControlService: accessControlService,
+		authService:          authService,
+		userService:          userService,
+		orgService:           orgService,
+		appService:           appService,
+	}
+}
+
+// Routes implements transport.Router.
+func (self *ApiRoutes) Routes() (string, http.Handler) {
+	router := chi.NewRouter()
+	router.Use(middleware.NewTokenAuthMiddleware(self.signer))
+	router.Use(requireApiUser)
+
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		renderApiError(w, http.StatusNotFound, "not_found", "No such endpoint")
+	})
+	router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		renderApiError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	})
+
+	router.Get("/users", self.ListUsers())
+	router.Get("/users/{id}", self.GetUser())
+	router.Get("/users/{id}/policies", self.ListUserPolicies())
+	router.Post("/users/{id}/policies", self.CreateUserPolicy())
+	router.Delete("/users/{id}/policies/{policyId}", self.DeleteUserPolicy())
+
+	router.Post("/invites", self.InviteUser())
+
+	router.Get("/orgs", self.ListOrgs())
+	router.Post("/orgs", self.CreateOrg())
+	router.Get("/orgs/{id}", self.GetOrg())
+	router.Delete("/orgs/{id}", self.DeleteOrg())
+	router.Get("/orgs/{id}/policies", self.ListOrgPolicies())
+	router.Post("/orgs/{id}/policies", self.CreateOrgPolicy())
+	router.Delete("/orgs/{id}/policies/{policyId}", self.DeleteOrgPolicy())
+	router.Get("/orgs/{id}/members", self.ListOrgMembers())
+	router.Post("/orgs/{id}/invites", self.InviteOrgMember())
+	router.Delete("/orgs/{id}/members/{userId}", self.RemoveOrgMember())
+
+	router.Get("/apps", self.ListApps())
+	router.Post("/apps", self.CreateApp())
+	router.Get("/apps/{id}", self.GetApp())
+	router.Delete("/apps/{id}", self.DeleteApp())
+	router.Post("/apps/{id}/secret", self.RotateAppSecret())
+	router.Put("/apps/{id}/scopes", self.UpdateAppScopes())
+
+	return "/api/v1", router
+}
+
+// Client tokens act on behalf of an application rather than a user so
+// there is nobody to enforce policies against.
+func requireApiUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user_id").(string)
+
+		if !ok || user == "" {
+			renderApiError(w, http.StatusUnauthorized, "unauthorized", "A user's bearer token is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type ApiPolicyRequest struct {
+	Resource  string `json:"resource"`
+	Action    string `json:"action"`
+	Effect    string `json:"effect"`
+	Condition string `json:"condition"`
+}
+
+type ApiInviteRequest struct {
+	Email string `json:"email"`
+}
+
+type ApiOrgRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ApiAppRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	RedirectUri string `json:"redirect_uri"`
+}
+
+type ApiScopesRequest struct {
+	Scopes []string `json:"scopes"`
+}
+
+// ApiAppSecret is the only time a client secret is returned.
+type ApiAppSecret struct {
+	App          *models.App `json:"app"`
+	ClientSecret string      `json:"client_secret"`
+}
+
+//==============================================================================
+// Users
+//==============================================================================
+
+func (self *ApiRoutes) ListUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := apiPage(w, r)
+		if !ok {
+			return
+		}
+
+		users, err := self.userService.ListUsers(r.Context())
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		start, end := page.bounds(len(users))
+		renderApiList(w, users[start:end], page, len(users))
+	}
+}
+
+func (self *ApiRoutes) GetUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := self.userService.GetUser(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, user, http.StatusOK)
+	}
+}
+
+func (self *ApiRoutes) ListUserPolicies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := apiPage(w, r)
+		if !ok {
+			return
+		}
+
+		policies, err := self.userService.ListPolicies(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		start, end := page.bounds(len(policies))
+		renderApiList(w, policies[start:end], page, len(policies))
+	}
+}
+
+func (self *ApiRoutes) CreateUserPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ApiPolicyRequest
+		if !decodeApi(w, r, &request) {
+			return
+		}
+
+		err := self.userService.CreatePolicy(
+			r.Context(),
+			chi.URLParam(r, "id"),
+			request.Resource,
+			request.Action,
+			request.Effect,
+			request.Condition,
+		)
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *ApiRoutes) DeleteUserPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policyId, ok := apiIntParam(w, r, "policyId")
+		if !ok {
+			return
+		}
+
+		if err := self.userService.DeletePolicy(r.Context(), chi.URLParam(r, "id"), policyId); err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *ApiRoutes) InviteUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := self.accessControlService.Enforce(r.Context(), "/auth/invite", "create"); err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		var request ApiInviteRequest
+		if !decodeApi(w, r, &request) {
+			return
+		}
+
+		userId := r.Context().Value("user_id").(string)
+		if err := self.authService.InviteUser(r.Context(), userId, request.Email); err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, request, http.StatusAccepted)
+	}
+}
+
+//==============================================================================
+// Organizations
+//==============================================================================
+
+func (self *ApiRoutes) ListOrgs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := apiPage(w, r)
+		if !ok {
+			return
+		}
+
+		userId := r.Context().Value("user_id").(string)
+		orgs, err := self.orgService.ListUsersOrgs(r.Context(), userId)
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		start, end := page.bounds(len(orgs))
+		renderApiList(w, orgs[start:end], page, len(orgs))
+	}
+}
+
+func (self *ApiRoutes) CreateOrg() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ApiOrgRequest
+		if !decodeApi(w, r, &request) {
+			return
+		}
+
+		if request.Name == "" {
+			renderApiError(w, http.StatusUnprocessableEntity, "invalid_request", "name is required")
+			return
+		}
+
+		userId := r.Context().Value("user_id").(string)
+		org, err := self.orgService.CreateOrganization(r.Context(), userId, request.Name, request.Description)
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, org, http.StatusCreated)
+	}
+}
+
+func (self *ApiRoutes) GetOrg() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		org, err := self.orgService.GetOrganizationBydId(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, org, http.StatusOK)
+	}
+}
+
+func (self *ApiRoutes) DeleteOrg() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := self.orgService.DeleteOrganization(r.Context(), chi.URLParam(r, "id")); err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *ApiRoutes) ListOrgPolicies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := apiPage(w, r)
+		if !ok {
+			return
+		}
+
+		policies, err := self.orgService.ListPolicies(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		start, end := page.bounds(len(policies))
+		renderApiList(w, policies[start:end], page, len(policies))
+	}
+}
+
+func (self *ApiRoutes) CreateOrgPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ApiPolicyRequest
+		if !decodeApi(w, r, &request) {
+			return
+		}
+
+		err := self.orgService.CreatePolicy(
+			r.Context(),
+			chi.URLParam(r, "id"),
+			request.Resource,
+			request.Action,
+			request.Effect,
+			request.Condition,
+		)
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *ApiRoutes) DeleteOrgPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policyId, ok := apiIntParam(w, r, "policyId")
+		if !ok {
+			return
+		}
+
+		if err := self.orgService.DeletePolicy(r.Context(), chi.URLParam(r, "id"), policyId); err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *ApiRoutes) ListOrgMembers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := apiPage(w, r)
+		if !ok {
+			return
+		}
+
+		users, err := self.orgService.ListUsers(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		start, end := page.bounds(len(users))
+		renderApiList(w, users[start:end], page, len(users))
+	}
+}
+
+func (self *ApiRoutes) InviteOrgMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ApiInviteRequest
+		if !decodeApi(w, r, &request) {
+			return
+		}
+
+		if err := self.orgService.InviteUser(r.Context(), chi.URLParam(r, "id"), request.Email); err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, request, http.StatusAccepted)
+	}
+}
+
+func (self *ApiRoutes) RemoveOrgMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := self.orgService.RemoveUser(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "userId"))
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//==============================================================================
+// Applications
+//==============================================================================
+
+func (self *ApiRoutes) ListApps() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, ok := apiPage(w, r)
+		if !ok {
+			return
+		}
+
+		apps, err := self.appService.ListApps(r.Context())
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		start, end := page.bounds(len(apps))
+		renderApiList(w, apps[start:end], page, len(apps))
+	}
+}
+
+func (self *ApiRoutes) CreateApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ApiAppRequest
+		if !decodeApi(w, r, &request) {
+			return
+		}
+
+		if request.Name == "" || request.RedirectUri == "" {
+			renderApiError(w, http.StatusUnprocessableEntity, "invalid_request", "name and redirect_uri are required")
+			return
+		}
+
+		clientSecret := uuid.New().String()
+		app, err := self.appService.CreateApp(
+			r.Context(),
+			uuid.New().String(),
+			clientSecret,
+			request.RedirectUri,
+			request.Name,
+			request.Description,
+		)
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, ApiAppSecret{App: app, ClientSecret: clientSecret}, http.StatusCreated)
+	}
+}
+
+func (self *ApiRoutes) GetApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app, err := self.appService.GetApp(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, app, http.StatusOK)
+	}
+}
+
+func (self *ApiRoutes) DeleteApp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := self.appService.DeleteApp(r.Context(), chi.URLParam(r, "id")); err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *ApiRoutes) RotateAppSecret() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		clientSecret, err := self.appService.NewSecret(r.Context(), id)
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		app, err := self.appService.GetApp(r.Context(), id)
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, ApiAppSecret{App: app, ClientSecret: clientSecret}, http.StatusOK)
+	}
+}
+
+func (self *ApiRoutes) UpdateAppScopes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request ApiScopesRequest
+		if !decodeApi(w, r, &request) {
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		if err := self.appService.UpdateScopes(r.Context(), id, request.Scopes); err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		app, err := self.appService.GetApp(r.Context(), id)
+		if err != nil {
+			renderApiNotifier(w, err)
+			return
+		}
+
+		renderApi(w, app, http.StatusOK)
+	}
+}
+
+// var _ transport.Router = (*ApiRoutes)(nil)
+
+//==============================================================================
+
+type apiPagination struct {
+	offset int
+	limit  int
+}
+
+// bounds clamps the page to a list of the given length.
+func (self apiPagination) bounds(length int) (int, int) {
+	start := self.offset
+	if start > length {
+		start = length
+	}
+
+	end := start + self.limit
+	if end > length {
+		end = length
+	}
+
+	return start, end
+}
+
+func apiPage(w http.ResponseWriter, r *http.Request) (apiPagination, bool) {
+	page := apiPagination{offset: 0, limit: API_DEFAULT_LIMIT}
+
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		parsed, err := strconv.Atoi(offset)
+		if err != nil || parsed < 0 {
+			renderApiError(w, http.StatusBadRequest, "invalid_pagination", "offset must be a positive number")
+			return page, false
+		}
+		page.offset = parsed
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > API_MAX_LIMIT {
+			renderApiError(w, http.StatusBadRequest, "invalid_pagination", "limit must be between 1 and "+strconv.Itoa(API_MAX_LIMIT))
+			return page, false
+		}
+		page.limit = parsed
+	}
+
+	return page, true
+}
+
+func apiIntParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil {
+		renderApiError(w, http.StatusBadRequest, "invalid_request", name+" must be a number")
+		return 0, false
+	}
+
+	return value, true
+}
+
+func decodeApi(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		renderApiError(w, http.StatusBadRequest, "invalid_json", "Request body is not valid JSON")
+		return false
+	}
+
+	return true
+}
+
+func renderApi(w http.ResponseWriter, data interface{}, statusCode int) {
+	utils.RenderJSON(w, models.ApiResponse{Data: data}, statusCode)
+}
+
+func renderApiList(w http.ResponseWriter, data interface{}, page apiPagination, total int) {
+	utils.RenderJSON(w, models.ApiResponse{
+		Data: data,
+		Pagination: &models.ApiPagination{
+			Offset: page.offset,
+			Limit:  page.limit,
+			Total:  total,
+		},
+	}, http.StatusOK)
+}
+
+func renderApiError(w http.ResponseWriter, status int, code, message string) {
+	utils.RenderJSON(w, models.ApiError{
+		Error: models.ApiErrorDetail{
+			Status:  status,
+			Code:    code,
+			Message: message,
+		},
+	}, status)
+}
+
+// renderApiNotifier maps the errors the services return onto HTTP
+// statuses, anything unrecognised is treated as a bad request.
+func renderApiNotifier(w http.ResponseWriter, err models.Notifier) {
+	status, code := http.StatusBadRequest, "bad_request"
+
+	switch err {
+	case services.AccessDenied:
+		status, code = http.StatusForbidden, "forbidden"
+	case services.UserNotFound, services.AccountNotFound, services.OrganizationNotFound, services.AppNotFound:
+		status, code = http.StatusNotFound, "not_found"
+	case services.EmailAlreadyInUse, services.OrganizationNameInUse:
+		status, code = http.StatusConflict, "conflict"
+	case services.UnknownScope:
+		status, code = http.StatusUnprocessableEntity, "invalid_scope"
+	default:
+		if _, ok := err.(*services.PolicyValidationError); ok {
+			status, code = http.StatusUnprocessableEntity, "invalid_policy"
+		}
+	}
+
+	renderApiError(w, status, code, err.Notify().Message)
+}
@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jhamill34/notion-provisioner/internal/config"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/transport/middleware"
+	"github.com/jhamill34/notion-provisioner/internal/transport/utils"
+)
+
+type AuditRoutes struct {
+	notificationConfig config.NotificationsConfig
+	sessionService     services.SessionService
+	templateService    services.TemplateService
+	auditService       services.AuditService
+}
+
+func NewAuditRoutes(
+	notificationConfig config.NotificationsConfig,
+	sessionService services.SessionService,
+	templateService services.TemplateService,
+	auditService services.AuditService,
+) *AuditRoutes {
+	return &AuditRoutes{
+		notificationConfig: notificationConfig,
+		sessionService:     sessionService,
+		templateService:    templateService,
+		auditService:       auditService,
+	}
+}
+
+// Routes implements transport.Router.
+func (self *AuditRoutes) Routes() (string, http.Handler) {
+	router := chi.NewRouter()
+	router.Use(middleware.NewAuthorizeMiddleware(self.sessionService))
+	router.Use(middleware.RedirectToLoginMiddleware)
+
+	router.Get("/", self.ListEntries())
+	router.Get("/export", self.ExportEntries())
+
+	return "/audit", router
+}
+
+type AuditFilterData struct {
+	Actor  string
+	Action string
+	Target string
+	Since  string
+	Until  string
+}
+
+type ListAuditData struct {
+	Filter    AuditFilterData
+	ExportUrl string
+	Entries   []models.AuditEntry
+}
+
+func (self *AuditRoutes) ListEntries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, filter := auditFilter(r)
+
+		entries, err := self.auditService.List(r.Context(), filter)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/auth",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/auth", http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"audit_list.html",
+			"layout",
+			models.NewTemplate(
+				ListAuditData{
+					Filter:    data,
+					ExportUrl: "/audit/export?" + r.URL.RawQuery,
+					Entries:   entries,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+func (self *AuditRoutes) ExportEntries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, filter := auditFilter(r)
+
+		// Nothing is written until access has been checked so the headers
+		// can still be replaced when the export isn't allowed.
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102T150405Z")+`.jsonl"`)
+
+		if err := self.auditService.Export(r.Context(), filter, w); err != nil {
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Disposition")
+			utils.SetNotifications(
+				w,
+				err,
+				"/audit",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/audit", http.StatusFound)
+			return
+		}
+	}
+}
+
+// auditFilter reads the filter from the query string, dates are expected
+// as YYYY-MM-DD and until is inclusive.
+func auditFilter(r *http.Request) (AuditFilterData, models.AuditFilter) {
+	query := r.URL.Query()
+	data := AuditFilterData{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Target: query.Get("target"),
+		Since:  query.Get("since"),
+		Until:  query.Get("until"),
+	}
+
+	filter := models.AuditFilter{
+		Actor:  data.Actor,
+		Action: data.Action,
+		Target: data.Target,
+	}
+
+	if since, err := time.Parse("2006-01-02", data.Since); err == nil {
+		filter.Since = since
+	}
+
+	if until, err := time.Parse("2006-01-02", data.Until); err == nil {
+		filter.Until = until.AddDate(0, 0, 1)
+	}
+
+	return data, filter
+}
@@ -14,6 +14,11 @@ import (
 	"github.com/jhamill34/notion-provisioner/internal/transport/utils"
 )
 
+// AuthResources are the resources and actions enforced by AuthRoutes.
+var AuthResources = []models.ResourceDefinition{
+	{Pattern: "/auth/invite", Actions: []string{"read", "create"}},
+}
+
 type AuthRoutes struct {
 	baseUrl              string
 	notificationConfig   config.NotificationsConfig
@@ -156,6 +161,15 @@ func (self *AuthRoutes) Home() http.HandlerFunc {
 		if err := self.accessControlService.Enforce(r.Context(), "/auth/invite", "read"); err == nil {
 			actions = append(actions, HomeAction{Name: "Invite User", Url: "/auth/invite"})
 		}
+		if err := self.accessControlService.Enforce(r.Context(), "/policyset", "list"); err == nil {
+			actions = append(actions, HomeAction{Name: "Policy Sets", Url: "/policyset"})
+		}
+		if err := self.accessControlService.Enforce(r.Context(), "/audit", "list"); err == nil {
+			actions = append(actions, HomeAction{Name: "Audit Log", Url: "/audit"})
+		}
+		if err := self.accessControlService.Enforce(r.Context(), "/webhook", "list"); err == nil {
+			actions = append(actions, HomeAction{Name: "Webhooks", Url: "/webhook"})
+		}
 
 		user, err := self.authService.GetUserById(r.Context(), user_id)
 		if err != nil {
@@ -1,9 +1,13 @@
 package routes
 
 import (
-	"encoding/base64"
 	"encoding/json"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jhamill34/notion-provisioner/internal/models"
@@ -12,44 +16,92 @@ import (
 	"github.com/jhamill34/notion-provisioner/internal/transport/utils"
 )
 
+const MEDIA_CACHE_CONTROL = "public, max-age=31536000, immutable"
+
 type BlogRoutes struct {
-	postService services.BlogPostService
-	signer      services.Signer
+	postService    services.BlogPostService
+	commentService services.BlogCommentService
+	mediaService   services.MediaService
+	signer         services.Signer
 }
 
 func NewBlogRoutes(
 	postService services.BlogPostService,
+	commentService services.BlogCommentService,
+	mediaService services.MediaService,
 	signer services.Signer,
 ) *BlogRoutes {
 	return &BlogRoutes{
-		postService: postService,
-		signer:      signer,
+		postService:    postService,
+		commentService: commentService,
+		mediaService:   mediaService,
+		signer:         signer,
 	}
 }
 
 // Routes implements transport.Router.
 func (self *BlogRoutes) Routes() (string, http.Handler) {
 	router := chi.NewRouter()
+	// Readers don't need a token but authors use theirs to see drafts
+	router.Use(middleware.NewTokenAuthMiddleware(self.signer))
 
 	router.Get("/blog", self.ListPosts())
+	router.Get("/blog/search", self.SearchPosts())
+	router.Get("/blog/feed", self.FeedPosts())
+	router.Get("/blog/tags", self.ListTags())
+	router.Get("/blog/tags/{slug}", self.GetTag())
 	router.Get("/blog/{id}", self.GetPost())
+	router.Get("/blog/{id}/comments", self.ListComments())
+	router.Get("/blog/{id}/media", self.ListMedia())
+	router.Get("/media/{id}", self.GetMedia())
 
 	router.Group(func(group chi.Router) {
-		group.Use(middleware.NewTokenAuthMiddleware(self.signer))
 		group.Use(middleware.UnauthorizedMiddleware)
 
 		group.Post("/blog", self.CreatePost())
 		group.Put("/blog/{id}", self.UpdatePost())
 		group.Delete("/blog/{id}", self.DeletePost())
+		group.Post("/blog/{id}/preview", self.CreatePreview())
+
+		group.Get("/blog/{id}/revisions", self.ListRevisions())
+		group.Get("/blog/{id}/revisions/diff", self.DiffRevisions())
+		group.Post("/blog/{id}/revisions/{revisionId}/restore", self.RestoreRevision())
+
+		group.Put("/blog/tags/{slug}", self.UpdateTag())
+
+		group.Post("/blog/{id}/comments", self.CreateComment())
+		group.Put("/blog/{id}/comments/{commentId}", self.UpdateComment())
+		group.Delete("/blog/{id}/comments/{commentId}", self.DeleteComment())
+
+		group.Post("/blog/{id}/media", self.UploadMedia())
+		group.Delete("/blog/{id}/media/{mediaId}", self.RemoveMedia())
 	})
 
 	return "/", router
 }
 
+// GetPost finds the post by its id or slug.
 func (self *BlogRoutes) GetPost() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
-		post, err := self.postService.GetPost(r.Context(), id)
+
+		var post *models.PostContent
+		var err models.Notifier
+		if preview := r.URL.Query().Get("preview"); preview != "" {
+			post, err = self.postService.GetPostPreview(r.Context(), id, preview)
+		} else {
+			post, err = self.postService.GetPost(r.Context(), id)
+		}
+
+		if err == services.InvalidPreviewToken {
+			utils.RenderJSON(
+				w,
+				models.ForwardError{Message: err.Notify().Message},
+				http.StatusForbidden,
+			)
+			return
+		}
+
 		if err == services.PostNotFound {
 			utils.RenderJSON(
 				w,
@@ -63,23 +115,191 @@ func (self *BlogRoutes) GetPost() http.HandlerFunc {
 			panic(err)
 		}
 
+		// Old slugs still find the post but send readers to the current one
+		if id != post.Id && id != post.Slug {
+			location := "/blog/" + post.Slug
+			if r.URL.RawQuery != "" {
+				location += "?" + r.URL.RawQuery
+			}
+
+			http.Redirect(w, r, location, http.StatusMovedPermanently)
+			return
+		}
+
 		utils.RenderJSON(w, post, http.StatusOK)
 	}
 }
 
+// ListPosts pages through posts newest first. Use the `next` or `prev`
+// cursor from a response as `after` or `before` to get the adjacent page,
+// `author`, `tag`, `since` and `until` (YYYY-MM-DD, inclusive) filter the
+// list.
 func (self *BlogRoutes) ListPosts() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		posts := self.postService.ListPosts(r.Context())
+		query := r.URL.Query()
+
+		filter := models.PostFilter{
+			Author: query.Get("author"),
+			Tag:    query.Get("tag"),
+		}
+
+		if since, err := time.Parse("2006-01-02", query.Get("since")); err == nil {
+			filter.Since = since
+		}
+
+		if until, err := time.Parse("2006-01-02", query.Get("until")); err == nil {
+			filter.Until = until.AddDate(0, 0, 1)
+		}
+
+		page := models.PageRequest{
+			After:  query.Get("after"),
+			Before: query.Get("before"),
+		}
+
+		if limit := query.Get("limit"); limit != "" {
+			parsed, err := strconv.Atoi(limit)
+			if err != nil || parsed < 1 {
+				utils.RenderJSON(
+					w,
+					models.ForwardError{Message: "limit must be a positive number"},
+					http.StatusBadRequest,
+				)
+				return
+			}
+			page.Limit = parsed
+		}
+
+		posts, err := self.postService.ListPosts(r.Context(), filter, page)
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
 
 		utils.RenderJSON(w, posts, http.StatusOK)
 	}
 }
 
+func (self *BlogRoutes) SearchPosts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		results, err := self.postService.SearchPosts(r.Context(), r.URL.Query().Get("q"))
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, results, http.StatusOK)
+	}
+}
+
+// FeedPosts returns the latest published posts with their full content,
+// narrowed by `tag` or `author`.
+func (self *BlogRoutes) FeedPosts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		posts, err := self.postService.FeedPosts(r.Context(), models.PostFilter{
+			Author: query.Get("author"),
+			Tag:    query.Get("tag"),
+		})
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, posts, http.StatusOK)
+	}
+}
+
+func (self *BlogRoutes) ListTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.RenderJSON(w, self.postService.ListTags(r.Context()), http.StatusOK)
+	}
+}
+
+func (self *BlogRoutes) GetTag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag, err := self.postService.GetTag(r.Context(), chi.URLParam(r, "slug"))
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, tag, http.StatusOK)
+	}
+}
+
+type TagPayload struct {
+	Restricted bool `json:"restricted"`
+}
+
+func (self *BlogRoutes) UpdateTag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload TagPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			utils.RenderJSON(
+				w,
+				models.ForwardError{Message: "Bad Request"},
+				http.StatusBadRequest,
+			)
+			return
+		}
+
+		tag, err := self.postService.UpdateTag(r.Context(), chi.URLParam(r, "slug"), payload.Restricted)
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, tag, http.StatusOK)
+	}
+}
+
 type PostPayload struct {
 	Title     string `json:"title"`
+	Slug      string `json:"slug"`
 	Content   string `json:"content"`
-	Image     string `json:"image"`
-	ImageMIME string `json:"image_mime"`
+	Status    string `json:"status"`
+	PublishAt string `json:"publish_at"`
+
+	// Left alone when missing, an empty list removes every tag
+	Tags []string `json:"tags"`
+}
+
+// publishAt accepts RFC 3339 timestamps as well as the value of a
+// datetime-local input, which has no zone and is treated as UTC.
+func (self *PostPayload) publishAt() (time.Time, bool) {
+	if self.PublishAt == "" {
+		return time.Time{}, true
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04"} {
+		if parsed, err := time.Parse(layout, self.PublishAt); err == nil {
+			return parsed, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// changes collects the tags and status in the payload so they're saved
+// along with the post, it renders an error response when the publish date
+// can't be read.
+func (self *PostPayload) changes(w http.ResponseWriter) (models.PostChanges, bool) {
+	publishAt, ok := self.publishAt()
+	if !ok {
+		utils.RenderJSON(
+			w,
+			models.ForwardError{Message: "Invalid publish date"},
+			http.StatusBadRequest,
+		)
+		return models.PostChanges{}, false
+	}
+
+	return models.PostChanges{
+		Tags:      self.Tags,
+		Status:    self.Status,
+		PublishAt: publishAt,
+	}, true
 }
 
 func (self *BlogRoutes) CreatePost() http.HandlerFunc {
@@ -96,12 +316,81 @@ func (self *BlogRoutes) CreatePost() http.HandlerFunc {
 			return
 		}
 
+		changes, ok := payload.changes(w)
+		if !ok {
+			return
+		}
+
 		post, err := self.postService.CreatePost(
 			r.Context(),
 			payload.Title,
+			payload.Slug,
 			payload.Content,
 			userId,
+			changes,
+		)
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, post, http.StatusCreated)
+	}
+}
+
+func (self *BlogRoutes) UpdatePost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		var payload PostPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			utils.RenderJSON(
+				w,
+				models.ForwardError{Message: "Bad Request"},
+				http.StatusBadRequest,
+			)
+			return
+		}
+
+		changes, ok := payload.changes(w)
+		if !ok {
+			return
+		}
+
+		post, err := self.postService.UpdatePost(
+			r.Context(),
+			id,
+			payload.Title,
+			payload.Slug,
+			payload.Content,
+			changes,
 		)
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, post, http.StatusCreated)
+	}
+}
+
+func (self *BlogRoutes) DeletePost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		err := self.postService.DeletePost(r.Context(), id)
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *BlogRoutes) CreatePreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		preview, err := self.postService.NewPreview(r.Context(), chi.URLParam(r, "id"))
 		if err == services.AccessDenied {
 			utils.RenderJSON(
 				w,
@@ -111,39 +400,101 @@ func (self *BlogRoutes) CreatePost() http.HandlerFunc {
 			return
 		}
 
+		if err == services.PostNotFound {
+			utils.RenderJSON(
+				w,
+				models.ForwardError{Message: "Post Not Found"},
+				http.StatusNotFound,
+			)
+			return
+		}
+
 		if err != nil {
 			panic(err)
 		}
 
-		if payload.Image != "" {
-			imageData, base64Err := base64.StdEncoding.DecodeString(payload.Image)
-			if base64Err != nil {
-				panic(err)
-			}
+		utils.RenderJSON(w, preview, http.StatusCreated)
+	}
+}
 
-			err = self.postService.AddImage(r.Context(), post.Id, payload.ImageMIME, imageData)
-			if err == services.AccessDenied {
-				utils.RenderJSON(
-					w,
-					models.ForwardError{Message: "Access denied"},
-					http.StatusForbidden,
-				)
-				return
-			}
-			if err != nil {
-				panic(err)
-			}
+func (self *BlogRoutes) ListRevisions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		revisions, err := self.postService.ListRevisions(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderBlogError(w, err)
+			return
 		}
 
-		utils.RenderJSON(w, post, http.StatusCreated)
+		utils.RenderJSON(w, revisions, http.StatusOK)
 	}
 }
 
-func (self *BlogRoutes) UpdatePost() http.HandlerFunc {
+// DiffRevisions shows the changes from the `from` revision to the `to`
+// revision.
+func (self *BlogRoutes) DiffRevisions() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		id := chi.URLParam(r, "id")
+		from, fromErr := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+		to, toErr := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+		if fromErr != nil || toErr != nil {
+			utils.RenderJSON(
+				w,
+				models.ForwardError{Message: "Pick two revisions to compare"},
+				http.StatusBadRequest,
+			)
+			return
+		}
 
-		var payload PostPayload
+		diff, err := self.postService.DiffRevisions(r.Context(), chi.URLParam(r, "id"), from, to)
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, diff, http.StatusOK)
+	}
+}
+
+func (self *BlogRoutes) RestoreRevision() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		revisionId, parseErr := strconv.ParseInt(chi.URLParam(r, "revisionId"), 10, 64)
+		if parseErr != nil {
+			renderBlogError(w, services.RevisionNotFound)
+			return
+		}
+
+		post, err := self.postService.RestoreRevision(r.Context(), chi.URLParam(r, "id"), revisionId)
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, post, http.StatusOK)
+	}
+}
+
+func (self *BlogRoutes) ListComments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		comments, err := self.commentService.ListComments(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, comments, http.StatusOK)
+	}
+}
+
+// CommentPayload is a new comment, with ParentId it's a reply. Only the
+// status of an existing comment can be changed.
+type CommentPayload struct {
+	ParentId string `json:"parent_id"`
+	Content  string `json:"content"`
+	Status   string `json:"status"`
+}
+
+func (self *BlogRoutes) CreateComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload CommentPayload
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 			utils.RenderJSON(
 				w,
@@ -153,67 +504,193 @@ func (self *BlogRoutes) UpdatePost() http.HandlerFunc {
 			return
 		}
 
-		post, err := self.postService.UpdatePost(
+		comment, err := self.commentService.CreateComment(
 			r.Context(),
-			id,
-			payload.Title,
+			chi.URLParam(r, "id"),
+			payload.ParentId,
 			payload.Content,
 		)
-		if err == services.AccessDenied {
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, comment, http.StatusCreated)
+	}
+}
+
+func (self *BlogRoutes) UpdateComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload CommentPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 			utils.RenderJSON(
 				w,
-				models.ForwardError{Message: "Access denied"},
-				http.StatusForbidden,
+				models.ForwardError{Message: "Bad Request"},
+				http.StatusBadRequest,
 			)
 			return
 		}
 
+		comment, err := self.commentService.SetCommentStatus(
+			r.Context(),
+			chi.URLParam(r, "id"),
+			chi.URLParam(r, "commentId"),
+			payload.Status,
+		)
 		if err != nil {
-			panic(err)
+			renderBlogError(w, err)
+			return
 		}
-		
-		if payload.Image != "" {
-			imageData, base64Err := base64.StdEncoding.DecodeString(payload.Image)
-			if base64Err != nil {
-				panic(err)
-			}
 
-			err = self.postService.AddImage(r.Context(), post.Id, payload.ImageMIME, imageData)
-			if err == services.AccessDenied {
-				utils.RenderJSON(
-					w,
-					models.ForwardError{Message: "Access denied"},
-					http.StatusForbidden,
-				)
-				return
-			}
-			if err != nil {
-				panic(err)
-			}
+		utils.RenderJSON(w, comment, http.StatusOK)
+	}
+}
+
+func (self *BlogRoutes) DeleteComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := self.commentService.DeleteComment(
+			r.Context(),
+			chi.URLParam(r, "id"),
+			chi.URLParam(r, "commentId"),
+		)
+		if err != nil {
+			renderBlogError(w, err)
+			return
 		}
 
-		utils.RenderJSON(w, post, http.StatusCreated)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func (self *BlogRoutes) DeletePost() http.HandlerFunc {
+func (self *BlogRoutes) ListMedia() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		id := chi.URLParam(r, "id")
+		media, err := self.mediaService.ListPostMedia(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
 
-		err := self.postService.DeletePost(r.Context(), id)
-		if err == services.AccessDenied {
+		utils.RenderJSON(w, media, http.StatusOK)
+	}
+}
+
+// UploadMedia adds an image to the post, `cover=true` also makes it the
+// post's image. The image is either the `file` field of a multipart form
+// or the whole body, whatever type it's sent as is ignored since the
+// content is sniffed.
+func (self *BlogRoutes) UploadMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := uploadBody(r)
+		if !ok {
 			utils.RenderJSON(
 				w,
-				models.ForwardError{Message: "Access denied"},
-				http.StatusForbidden,
+				models.ForwardError{Message: "Bad Request"},
+				http.StatusBadRequest,
 			)
 			return
 		}
 
+		media, err := self.mediaService.UploadPostMedia(
+			r.Context(),
+			chi.URLParam(r, "id"),
+			body,
+			r.URL.Query().Get("cover") == "true",
+		)
 		if err != nil {
-			panic(err)
+			renderBlogError(w, err)
+			return
+		}
+
+		utils.RenderJSON(w, media, http.StatusCreated)
+	}
+}
+
+// uploadBody finds the uploaded file without reading it into memory.
+func uploadBody(r *http.Request) (io.Reader, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, true
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, false
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, false
+		}
+
+		if part.FormName() == "file" {
+			return part, true
+		}
+	}
+}
+
+func (self *BlogRoutes) RemoveMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := self.mediaService.RemovePostMedia(
+			r.Context(),
+			chi.URLParam(r, "id"),
+			chi.URLParam(r, "mediaId"),
+		)
+		if err != nil {
+			renderBlogError(w, err)
+			return
 		}
 
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// GetMedia serves an uploaded file. Media never changes under its id so
+// it can be cached for as long as anyone likes.
+func (self *BlogRoutes) GetMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		media, blob, err := self.mediaService.OpenMedia(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderBlogError(w, err)
+			return
+		}
+		defer blob.Close()
+
+		etag := `"` + media.Id + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", MEDIA_CACHE_CONTROL)
+
+		if strings.Contains(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", media.MimeType)
+		w.Header().Set("Content-Length", strconv.FormatInt(media.Size, 10))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		io.Copy(w, blob)
+	}
+}
+
+func renderBlogError(w http.ResponseWriter, err models.Notifier) {
+	status := http.StatusBadRequest
+	switch err {
+	case services.AccessDenied:
+		status = http.StatusForbidden
+	case services.PostNotFound, services.RevisionNotFound, services.TagNotFound, services.CommentNotFound,
+		services.MediaNotFound:
+		status = http.StatusNotFound
+	case services.SlugInUse:
+		status = http.StatusConflict
+	case services.MediaTooLarge, services.ImageTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	utils.RenderJSON(
+		w,
+		models.ForwardError{Message: err.Notify().Message},
+		status,
+	)
+}
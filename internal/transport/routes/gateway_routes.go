@@ -2,20 +2,23 @@ package routes
 
 import (
 	"bytes"
-	"encoding/base64"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/gomarkdown/markdown"
 	"github.com/google/uuid"
 	"github.com/jhamill34/notion-provisioner/internal/config"
 	"github.com/jhamill34/notion-provisioner/internal/models"
 	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/services/feed"
 	"github.com/jhamill34/notion-provisioner/internal/transport/middleware"
 	"github.com/jhamill34/notion-provisioner/internal/transport/utils"
 )
@@ -23,6 +26,7 @@ import (
 type GatewayRoutes struct {
 	sessionService     services.SessionService
 	templateService    services.TemplateService
+	renderService      services.RenderService
 	httpClient         *http.Client
 	sessionConfig      config.SessionConfig
 	oauthConfig        config.OauthConfig
@@ -34,6 +38,7 @@ type GatewayRoutes struct {
 func NewGatewayRoutes(
 	sessionService services.SessionService,
 	templateService services.TemplateService,
+	renderService services.RenderService,
 	httpClient *http.Client,
 	sessionConfig config.SessionConfig,
 	oauthConfig config.OauthConfig,
@@ -44,6 +49,7 @@ func NewGatewayRoutes(
 	return &GatewayRoutes{
 		sessionService:     sessionService,
 		templateService:    templateService,
+		renderService:      renderService,
 		httpClient:         httpClient,
 		sessionConfig:      sessionConfig,
 		oauthConfig:        oauthConfig,
@@ -64,7 +70,13 @@ func (self *GatewayRoutes) Routes() (string, http.Handler) {
 	router.Get("/logout", self.Logout())
 
 	router.Get("/blog", self.ListPosts())
+	router.Get("/blog/search", self.SearchPosts())
+	router.Get("/blog/feed.rss", self.Feed(feed.WriteRss, "application/rss+xml"))
+	router.Get("/blog/feed.atom", self.Feed(feed.WriteAtom, "application/atom+xml"))
+	router.Get("/blog/tags", self.TagCloud())
+	router.Get("/blog/tag/{slug}", self.TagPosts())
 	router.Get("/blog/{id}", self.GetPost())
+	router.Get("/media/{id}", self.GetMedia())
 
 	router.Group(func(group chi.Router) {
 		group.Use(middleware.RedirectToIndexMiddleware)
@@ -73,8 +85,19 @@ func (self *GatewayRoutes) Routes() (string, http.Handler) {
 
 		group.Get("/blog/{id}/edit", self.EditPost())
 		group.Put("/blog/{id}", self.ProcessEditPost())
+		group.Post("/blog/render", self.ProcessRenderPreview())
+		group.Post("/blog/{id}/preview", self.ProcessPreviewPost())
+
+		group.Get("/blog/{id}/history", self.PostHistory())
+		group.Get("/blog/{id}/history/diff", self.PostDiff())
+		group.Post("/blog/{id}/history/{revisionId}/restore", self.ProcessRestoreRevision())
 
 		group.Delete("/blog/{id}", self.ProcessDeletePost())
+		group.Delete("/blog/{id}/media/{mediaId}", self.ProcessRemoveMedia())
+
+		group.Post("/blog/{id}/comments", self.ProcessNewComment())
+		group.Put("/blog/{id}/comments/{commentId}", self.ProcessModerateComment())
+		group.Delete("/blog/{id}/comments/{commentId}", self.ProcessDeleteComment())
 	})
 
 	return "/", router
@@ -86,33 +109,322 @@ func (self *GatewayRoutes) Index() http.HandlerFunc {
 	}
 }
 
+type PostListData struct {
+	Heading   string
+	Posts     []models.PostStub
+	NextUrl   string
+	PrevUrl   string
+	FeedQuery string
+}
+
 func (self *GatewayRoutes) ListPosts() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var posts []models.PostStub
-		var err *models.Notification
+		self.renderPostList(w, r, nil, "Blog Posts", feedQuery("", r.URL.Query().Get("author")))
+	}
+}
+
+// TagPosts lists the posts with a tag, paged the same way as every post.
+func (self *GatewayRoutes) TagPosts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tagSlug := chi.URLParam(r, "slug")
+		endpoint := "/blog/tags/" + url.PathEscape(tagSlug)
 
+		var tag models.Tag
 		var response bytes.Buffer
-		err = self.forward(r, nil, nil, &response)
-		json.NewDecoder(&response).Decode(&posts)
+		err := self.forward(r, &endpoint, nil, &response)
+		json.NewDecoder(&response).Decode(&tag)
 
-		if err == nil {
-			err = utils.GetNotifications(r)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/blog",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/blog", http.StatusFound)
+			return
+		}
+
+		query := r.URL.Query()
+		query.Set("tag", tag.Slug)
+		endpoint = "/blog?" + query.Encode()
+
+		self.renderPostList(w, r, &endpoint, "Tagged "+tag.Name, feedQuery(tag.Slug, query.Get("author")))
+	}
+}
+
+func (self *GatewayRoutes) renderPostList(
+	w http.ResponseWriter,
+	r *http.Request,
+	endpoint *string,
+	heading string,
+	feedQuery string,
+) {
+	var page models.PostPage
+	var err *models.Notification
+
+	var response bytes.Buffer
+	err = self.forward(r, endpoint, nil, &response)
+	json.NewDecoder(&response).Decode(&page)
+
+	if err == nil {
+		err = utils.GetNotifications(r)
+	}
+
+	data := PostListData{Heading: heading, Posts: page.Posts, FeedQuery: feedQuery}
+	if page.Next != "" {
+		data.NextUrl = pageUrl(r, "after", page.Next)
+	}
+	if page.Prev != "" {
+		data.PrevUrl = pageUrl(r, "before", page.Prev)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	self.templateService.Render(
+		w,
+		"blog_list.html",
+		"layout",
+		models.NewTemplate(data, err),
+	)
+}
+
+type TagCloudItem struct {
+	Tag  models.TagCount
+	Size int
+}
+
+// TagCloud shows every tag in use, sized 1 to 4 by how many posts have
+// the tag compared to the most used one.
+func (self *GatewayRoutes) TagCloud() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var counts []models.TagCount
+		var response bytes.Buffer
+		err := self.forward(r, nil, nil, &response)
+		json.NewDecoder(&response).Decode(&counts)
+
+		most := 1
+		for _, count := range counts {
+			if count.Count > most {
+				most = count.Count
+			}
+		}
+
+		tags := make([]TagCloudItem, len(counts))
+		for i, count := range counts {
+			tags[i] = TagCloudItem{
+				Tag:  count,
+				Size: 1 + (count.Count*3)/most,
+			}
 		}
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		self.templateService.Render(
 			w,
-			"blog_list.html",
+			"blog_tags.html",
 			"layout",
-			models.NewTemplate(&posts, err),
+			models.NewTemplate(tags, err),
 		)
 	}
 }
 
+// pageUrl links to the same list with the cursor swapped out, keeping any
+// filters in the query.
+func pageUrl(r *http.Request, direction, cursor string) string {
+	query := r.URL.Query()
+	query.Del("after")
+	query.Del("before")
+	query.Set(direction, cursor)
+
+	return r.URL.Path + "?" + query.Encode()
+}
+
+type SearchData struct {
+	Query   string
+	Results []models.PostSearchResult
+}
+
+func (self *GatewayRoutes) SearchPosts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := SearchData{Query: r.URL.Query().Get("q")}
+
+		var err *models.Notification
+		if data.Query != "" {
+			var response bytes.Buffer
+			err = self.forward(r, nil, nil, &response)
+			json.NewDecoder(&response).Decode(&data.Results)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"blog_search.html",
+			"layout",
+			models.NewTemplate(data, err),
+		)
+	}
+}
+
+// feedQuery is the query for the feed matching a list of posts, it's
+// empty when the list isn't filtered.
+func feedQuery(tag, author string) string {
+	query := url.Values{}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	if author != "" {
+		query.Set("author", author)
+	}
+
+	if len(query) == 0 {
+		return ""
+	}
+
+	return "?" + query.Encode()
+}
+
+// Feed serves the latest published posts, narrowed by `tag` or `author`,
+// written by write. Readers poll feeds so they're sent with an ETag and
+// Last-Modified for conditional requests.
+func (self *GatewayRoutes) Feed(
+	write func(io.Writer, *feed.Feed) error,
+	contentType string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		tagSlug := query.Get("tag")
+		author := query.Get("author")
+
+		data := feed.Feed{
+			Title:       "Blog Posts",
+			Description: "The latest blog posts",
+			Link:        self.baseUrl + "/blog" + feedQuery("", author),
+			Url:         self.baseUrl + r.URL.RequestURI(),
+		}
+
+		var response bytes.Buffer
+		if tagSlug != "" {
+			var tag models.Tag
+			endpoint := "/blog/tags/" + url.PathEscape(tagSlug)
+			if err := self.forward(r, &endpoint, nil, &response); err != nil {
+				http.Error(w, err.Message, http.StatusNotFound)
+				return
+			}
+			json.NewDecoder(&response).Decode(&tag)
+
+			data.Title = "Tagged " + tag.Name
+			data.Description = "The latest blog posts tagged " + tag.Name
+			data.Link = self.baseUrl + "/blog/tag/" + url.PathEscape(tag.Slug) + feedQuery("", author)
+		}
+
+		var posts []models.PostContent
+		endpoint := "/blog/feed" + feedQuery(tagSlug, author)
+		response.Reset()
+		if err := self.forward(r, &endpoint, nil, &response); err != nil {
+			http.Error(w, err.Message, http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(&response).Decode(&posts)
+
+		// The author is a user id, the posts carry who that is
+		if author != "" && len(posts) > 0 && posts[0].AuthorName != "" {
+			data.Description += " by " + posts[0].AuthorName
+		}
+
+		// An empty feed was last changed whenever, the epoch keeps its
+		// Last-Modified the same between requests
+		data.Updated = time.Unix(0, 0)
+		data.Entries = make([]feed.Entry, len(posts))
+		for i, post := range posts {
+			published, _ := time.Parse(time.RFC3339, post.PublishedAt)
+			updated, _ := time.Parse(time.RFC3339, post.UpdatedAt)
+			if updated.Before(published) {
+				updated = published
+			}
+
+			if updated.After(data.Updated) {
+				data.Updated = updated
+			}
+
+			categories := make([]string, len(post.Tags))
+			for j, tag := range post.Tags {
+				categories[j] = tag.Name
+			}
+
+			data.Entries[i] = feed.Entry{
+				Id:         "urn:uuid:" + post.Id,
+				Title:      post.Title,
+				Link:       self.baseUrl + "/blog/" + post.Slug,
+				Author:     post.AuthorName,
+				Published:  published,
+				Updated:    updated,
+				Categories: categories,
+				Content:    string(self.renderService.RenderPost(post.Id, post.Content, true)),
+			}
+		}
+
+		var body bytes.Buffer
+		if err := write(&body, &data); err != nil {
+			panic(err)
+		}
+
+		sum := sha256.Sum256(body.Bytes())
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+
+		// ServeContent answers If-None-Match and If-Modified-Since with a 304
+		http.ServeContent(w, r, "", data.Updated, bytes.NewReader(body.Bytes()))
+	}
+}
+
 type GetPostData struct {
-	Post models.PostContent
-	Body template.HTML
+	Post      models.PostContent
+	Image     *models.Media
+	Srcset    string
+	Body      template.HTML
+	CsrfToken string
+	SignedIn  bool
+	Comments  []CommentView
+}
+
+// CommentView is a comment with its markdown rendered and what the
+// current user may do with it.
+type CommentView struct {
+	models.Comment
+	Body      template.HTML
+	Replies   []CommentView
+	CsrfToken string
+	Moderator bool
+	CanReply  bool
+}
+
+// commentViews renders the comments for the post page, replies are only
+// offered on approved top level comments.
+func (self *GatewayRoutes) commentViews(list models.CommentList, csrfToken string, signedIn bool) []CommentView {
+	views := make([]CommentView, len(list.Comments))
+	for i, comment := range list.Comments {
+		views[i] = CommentView{
+			Comment:   comment,
+			Body:      self.renderService.RenderComment(comment.Content),
+			Replies:   make([]CommentView, len(comment.Replies)),
+			CsrfToken: csrfToken,
+			Moderator: list.Moderator,
+			CanReply:  signedIn && comment.Status == models.CommentStatusApproved,
+		}
+
+		for j, reply := range comment.Replies {
+			views[i].Replies[j] = CommentView{
+				Comment:   reply,
+				Body:      self.renderService.RenderComment(reply.Content),
+				CsrfToken: csrfToken,
+				Moderator: list.Moderator,
+			}
+		}
+	}
+
+	return views
 }
 
 func (self *GatewayRoutes) GetPost() http.HandlerFunc {
@@ -135,9 +447,55 @@ func (self *GatewayRoutes) GetPost() http.HandlerFunc {
 			return
 		}
 
+		// The app server follows old slugs to the post, send the browser to
+		// the current one
+		if key := chi.URLParam(r, "id"); key != post.Id && key != post.Slug {
+			location := "/blog/" + post.Slug
+			if r.URL.RawQuery != "" {
+				location += "?" + r.URL.RawQuery
+			}
+
+			http.Redirect(w, r, location, http.StatusMovedPermanently)
+			return
+		}
+
+		csrfToken, _ := r.Context().Value("csrf_token").(string)
+		signedIn := r.Context().Value("token") != nil
+
+		// Comments are left off when they can't be loaded rather than
+		// losing the whole post
+		var comments models.CommentList
+		endpoint := "/blog/" + post.Id + "/comments"
+		response.Reset()
+		if err := self.forward(r, &endpoint, nil, &response); err == nil {
+			json.NewDecoder(&response).Decode(&comments)
+		}
+
+		// The image falls back to a plain src when its sizes can't be found
+		var image *models.Media
+		if post.ImageId != "" {
+			var media []models.Media
+			endpoint = "/blog/" + post.Id + "/media"
+			response.Reset()
+			if err := self.forward(r, &endpoint, nil, &response); err == nil {
+				json.NewDecoder(&response).Decode(&media)
+			}
+
+			for i := range media {
+				if media[i].Id == post.ImageId {
+					image = &media[i]
+				}
+			}
+		}
+
 		postData := GetPostData{
-			Post: post,
-			Body: template.HTML(markdown.ToHTML([]byte(post.Content), nil, nil)),
+			Post:      post,
+			Image:     image,
+			Srcset:    srcset(image),
+			Body:      self.renderService.RenderPost(post.Id, post.Content, false),
+			CsrfToken: csrfToken,
+			SignedIn:  signedIn,
+			Comments:  self.commentViews(comments, csrfToken, signedIn),
 		}
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -154,44 +512,405 @@ func (self *GatewayRoutes) GetPost() http.HandlerFunc {
 	}
 }
 
-func (self *GatewayRoutes) EditPost() http.HandlerFunc {
+// srcset lists each of the image's widths, ending with the original.
+func srcset(image *models.Media) string {
+	if image == nil {
+		return ""
+	}
+
+	var sources []string
+	for _, variant := range image.Variants {
+		sources = append(sources, fmt.Sprintf("/media/%s %dw", variant.Id, variant.Width))
+	}
+	sources = append(sources, fmt.Sprintf("/media/%s %dw", image.Id, image.Width))
+
+	return strings.Join(sources, ", ")
+}
+
+func (self *GatewayRoutes) EditPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		csrfToken := r.Context().Value("csrf_token").(string)
+		id := chi.URLParam(r, "id")
+		endpoint := "/blog/" + id
+
+		var post models.PostContent
+
+		var response bytes.Buffer
+		err := self.forward(r, &endpoint, nil, &response)
+		json.NewDecoder(&response).Decode(&post)
+
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/blog",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/blog", http.StatusFound)
+			return
+		}
+
+		var media []models.Media
+		endpoint = "/blog/" + post.Id + "/media"
+		response.Reset()
+		if err := self.forward(r, &endpoint, nil, &response); err == nil {
+			json.NewDecoder(&response).Decode(&media)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"blog_edit.html",
+			"layout",
+			models.NewTemplate(
+				map[string]interface{}{
+					"CsrfToken": csrfToken,
+					"Post":      post,
+					"PublishAt": datetimeLocal(post.PublishedAt),
+					"Tags":      tagNames(post.Tags),
+					"Media":     media,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+type PreviewLinkData struct {
+	Url       string
+	ExpiresAt string
+}
+
+// ProcessPreviewPost asks the app server for a preview token and renders
+// the link into the edit page.
+func (self *GatewayRoutes) ProcessPreviewPost() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		csrfToken := r.URL.Query().Get("csrf_token")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		if userCsrfToken != csrfToken {
+			w.WriteHeader(http.StatusOK)
+			self.templateService.Render(
+				w,
+				"blog_edit.html",
+				"preview_link",
+				models.NewTemplateError(&models.Notification{Message: "Bad Request"}),
+			)
+			return
+		}
+
+		endpoint := "/blog/" + id + "/preview"
+
+		var preview models.PostPreview
+		var response bytes.Buffer
+		err := self.forward(r, &endpoint, nil, &response)
+		json.NewDecoder(&response).Decode(&preview)
+
+		if err != nil {
+			w.WriteHeader(http.StatusOK)
+			self.templateService.Render(
+				w,
+				"blog_edit.html",
+				"preview_link",
+				models.NewTemplateError(err),
+			)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"blog_edit.html",
+			"preview_link",
+			models.NewTemplateData(PreviewLinkData{
+				Url:       self.baseUrl + "/blog/" + id + "?preview=" + url.QueryEscape(preview.Token),
+				ExpiresAt: preview.ExpiresAt,
+			}),
+		)
+	}
+}
+
+type PostHistoryData struct {
+	CsrfToken string
+	PostId    string
+	Revisions []models.PostRevision
+}
+
+func (self *GatewayRoutes) PostHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		csrfToken := r.Context().Value("csrf_token").(string)
+		id := chi.URLParam(r, "id")
+		endpoint := "/blog/" + id + "/revisions"
+
+		var revisions []models.PostRevision
+		var response bytes.Buffer
+		err := self.forward(r, &endpoint, nil, &response)
+		json.NewDecoder(&response).Decode(&revisions)
+
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/blog/"+id+"/edit",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/blog/"+id+"/edit", http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"blog_history.html",
+			"layout",
+			models.NewTemplate(
+				PostHistoryData{
+					CsrfToken: csrfToken,
+					PostId:    id,
+					Revisions: revisions,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+type PostDiffData struct {
+	PostId string
+	Diff   models.PostDiff
+}
+
+func (self *GatewayRoutes) PostDiff() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		query := url.Values{}
+		query.Set("from", r.URL.Query().Get("from"))
+		query.Set("to", r.URL.Query().Get("to"))
+		endpoint := "/blog/" + id + "/revisions/diff?" + query.Encode()
+
+		var diff models.PostDiff
+		var response bytes.Buffer
+		err := self.forward(r, &endpoint, nil, &response)
+		json.NewDecoder(&response).Decode(&diff)
+
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/blog/"+id+"/history",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/blog/"+id+"/history", http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"blog_diff.html",
+			"layout",
+			models.NewTemplate(
+				PostDiffData{
+					PostId: id,
+					Diff:   diff,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+func (self *GatewayRoutes) ProcessRestoreRevision() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		csrfToken := r.URL.Query().Get("csrf_token")
+		if userCsrfToken != csrfToken {
+			utils.SetNotifications(
+				w,
+				&models.Notification{
+					Message: "Bad Request",
+				},
+				"/blog/"+id+"/history",
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", "/blog/"+id+"/history")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		endpoint := "/blog/" + id + "/revisions/" + chi.URLParam(r, "revisionId") + "/restore"
+		err := self.forward(r, &endpoint, nil, nil)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/blog/"+id+"/history",
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", "/blog/"+id+"/history")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		sessionId := r.Context().Value("session_id").(string)
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", "/blog/"+id+"/edit")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *GatewayRoutes) ProcessNewComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		location := "/blog/" + id + "#comments"
+
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		csrfToken := r.FormValue("csrf_token")
+		if userCsrfToken != csrfToken {
+			utils.SetNotifications(
+				w,
+				&models.Notification{
+					Message: "Bad Request",
+				},
+				"/blog/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, location, http.StatusFound)
+			return
+		}
+
+		var payload bytes.Buffer
+		jsonValue := JSONValue{
+			"content":   r.FormValue("content"),
+			"parent_id": r.FormValue("parent_id"),
+		}
+		jsonValue.Encode(&payload)
+
+		endpoint := "/blog/" + id + "/comments"
+		err := self.forward(r, &endpoint, &payload, nil)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/blog/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, location, http.StatusFound)
+			return
+		}
+
+		sessionId := r.Context().Value("session_id").(string)
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		http.Redirect(w, r, location, http.StatusFound)
+	}
+}
+
+// ProcessModerateComment sets the status of a comment to the `status` in
+// the query string.
+func (self *GatewayRoutes) ProcessModerateComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		csrfToken := r.URL.Query().Get("csrf_token")
+		if userCsrfToken != csrfToken {
+			utils.SetNotifications(
+				w,
+				&models.Notification{
+					Message: "Bad Request",
+				},
+				"/blog/"+id,
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", "/blog/"+id+"#comments")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var payload bytes.Buffer
+		jsonValue := JSONValue{"status": r.URL.Query().Get("status")}
+		jsonValue.Encode(&payload)
+
+		endpoint := "/blog/" + id + "/comments/" + chi.URLParam(r, "commentId")
+		err := self.forward(r, &endpoint, &payload, nil)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/blog/"+id,
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", "/blog/"+id+"#comments")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		sessionId := r.Context().Value("session_id").(string)
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", "/blog/"+id+"#comments")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *GatewayRoutes) ProcessDeleteComment() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		csrfToken := r.Context().Value("csrf_token").(string)
 		id := chi.URLParam(r, "id")
-		endpoint := "/blog/" + id
-
-		var post models.PostContent
-
-		var response bytes.Buffer
-		err := self.forward(r, &endpoint, nil, &response)
-		json.NewDecoder(&response).Decode(&post)
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		csrfToken := r.URL.Query().Get("csrf_token")
+		if userCsrfToken != csrfToken {
+			utils.SetNotifications(
+				w,
+				&models.Notification{
+					Message: "Bad Request",
+				},
+				"/blog/"+id,
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", "/blog/"+id+"#comments")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 
+		endpoint := "/blog/" + id + "/comments/" + chi.URLParam(r, "commentId")
+		err := self.forward(r, &endpoint, nil, nil)
 		if err != nil {
 			utils.SetNotifications(
 				w,
 				err,
-				"/blog",
+				"/blog/"+id,
 				self.notificationConfig.Timeout,
 			)
-			http.Redirect(w, r, "/blog", http.StatusFound)
+			w.Header().Set("HX-Redirect", "/blog/"+id+"#comments")
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		self.templateService.Render(
-			w,
-			"blog_edit.html",
-			"layout",
-			models.NewTemplate(
-				map[string]interface{}{
-					"CsrfToken": csrfToken,
-					"Post":      post,
-				},
-				utils.GetNotifications(r),
-			),
-		)
+		sessionId := r.Context().Value("session_id").(string)
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", "/blog/"+id+"#comments")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// datetimeLocal formats an RFC 3339 timestamp for a datetime-local input.
+func datetimeLocal(timestamp string) string {
+	parsed, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return ""
 	}
+
+	return parsed.UTC().Format("2006-01-02T15:04")
 }
 
 func (self *GatewayRoutes) ProcessEditPost() http.HandlerFunc {
@@ -215,18 +934,16 @@ func (self *GatewayRoutes) ProcessEditPost() http.HandlerFunc {
 
 		var payload bytes.Buffer
 		jsonValue := FromUrlValues(r.Form)
-		file, header, fileErr := r.FormFile("image")
-		if fileErr == nil {
-			defer file.Close()
-
-			var image bytes.Buffer
-			io.Copy(&image, file)
-			jsonValue["image"] = base64.StdEncoding.EncodeToString(image.Bytes())
-			jsonValue["image_mime"] = header.Header.Get("Content-Type")
+		if _, ok := r.Form["tags"]; ok {
+			jsonValue["tags"] = tagList(r.FormValue("tags"))
 		}
 
 		jsonValue.Encode(&payload)
 		err := self.forward(r, nil, &payload, nil)
+		if err == nil {
+			err = self.uploadMedia(r, id)
+		}
+
 		if err != nil {
 			utils.SetNotifications(
 				w,
@@ -247,6 +964,185 @@ func (self *GatewayRoutes) ProcessEditPost() http.HandlerFunc {
 	}
 }
 
+// At most this many links and images are looked up on the app server for
+// each preview, the rest aren't checked.
+const MAX_PREVIEW_CHECKS = 25
+
+// PREVIEW_PAGES are the pages under /blog that aren't posts.
+var PREVIEW_PAGES = map[string]bool{
+	"new":       true,
+	"search":    true,
+	"tags":      true,
+	"feed.rss":  true,
+	"feed.atom": true,
+}
+
+// PREVIEW_SCHEMES are the schemes links can use, the rest are removed when
+// the post is rendered.
+var PREVIEW_SCHEMES = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+type PreviewData struct {
+	Body     template.HTML
+	Warnings []string
+}
+
+// ProcessRenderPreview renders the content being edited the same way the
+// post page will, with warnings for images and links that don't go
+// anywhere. The csrf token is checked the same as saving the post but it
+// isn't replaced since nothing is saved.
+func (self *GatewayRoutes) ProcessRenderPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		csrfToken := r.FormValue("csrf_token")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		if userCsrfToken != csrfToken {
+			w.WriteHeader(http.StatusOK)
+			self.templateService.Render(
+				w,
+				"blog_edit.html",
+				"post_preview",
+				models.NewTemplateError(&models.Notification{Message: "Bad Request"}),
+			)
+			return
+		}
+
+		content := r.FormValue("content")
+		data := PreviewData{
+			Body:     self.renderService.RenderPreview(content),
+			Warnings: self.previewWarnings(r, self.renderService.References(content)),
+		}
+
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"blog_edit.html",
+			"post_preview",
+			models.NewTemplateData(data),
+		)
+	}
+}
+
+// previewWarnings looks for images that haven't been uploaded and links to
+// posts or headings that don't exist. Links are resolved the way they
+// will be on the post page, links off the site aren't followed.
+func (self *GatewayRoutes) previewWarnings(r *http.Request, references models.References) []string {
+	warnings := make([]string, 0)
+	page := &url.URL{Path: "/blog/"}
+	checks := 0
+	skipped := false
+	checked := make(map[string]bool)
+
+	anchors := make(map[string]bool)
+	for _, anchor := range references.Anchors {
+		anchors[anchor] = true
+	}
+
+	check := func(path string, exists func() bool) bool {
+		if ok, seen := checked[path]; seen {
+			return ok
+		}
+
+		if checks >= MAX_PREVIEW_CHECKS {
+			skipped = true
+			return true
+		}
+
+		checks++
+		checked[path] = exists()
+		return checked[path]
+	}
+
+	for _, image := range references.Images {
+		link, err := url.Parse(image)
+		if err != nil || (link.Scheme != "" && !PREVIEW_SCHEMES[link.Scheme]) {
+			warnings = append(warnings, fmt.Sprintf("Image %q will be removed", image))
+			continue
+		}
+
+		if link.Host != "" {
+			continue
+		}
+
+		path := page.ResolveReference(link).Path
+		id, ok := strings.CutPrefix(path, "/media/")
+		if !ok || id == "" || strings.Contains(id, "/") {
+			warnings = append(warnings, fmt.Sprintf("Image %q isn't an uploaded image", image))
+			continue
+		}
+
+		if !check(path, func() bool { return self.mediaExists(r, id) }) {
+			warnings = append(warnings, fmt.Sprintf("Image %q hasn't been uploaded", image))
+		}
+	}
+
+	for _, target := range references.Links {
+		link, err := url.Parse(target)
+		if err != nil || (link.Scheme != "" && !PREVIEW_SCHEMES[link.Scheme]) {
+			warnings = append(warnings, fmt.Sprintf("Link %q will be removed", target))
+			continue
+		}
+
+		if link.Host != "" || link.Scheme != "" {
+			continue
+		}
+
+		if link.Path == "" {
+			if link.Fragment != "" && !anchors[link.Fragment] {
+				warnings = append(warnings, fmt.Sprintf("Link %q doesn't match a heading", target))
+			}
+			continue
+		}
+
+		path := page.ResolveReference(link).Path
+		slug, ok := strings.CutPrefix(path, "/blog/")
+		if !ok || slug == "" || strings.Contains(slug, "/") || PREVIEW_PAGES[slug] {
+			continue
+		}
+
+		if !check(path, func() bool { return self.postExists(r, slug) }) {
+			warnings = append(warnings, fmt.Sprintf("Link %q doesn't go to a post", target))
+		}
+	}
+
+	if skipped {
+		warnings = append(
+			warnings,
+			fmt.Sprintf("Only the first %d images and links were checked", MAX_PREVIEW_CHECKS),
+		)
+	}
+
+	return warnings
+}
+
+// mediaExists asks for the media as if it was already cached so the app
+// server answers without sending it.
+func (self *GatewayRoutes) mediaExists(r *http.Request, id string) bool {
+	endpoint := "/media/" + url.PathEscape(id)
+	appReq := self.appRequest(r, http.MethodGet, &endpoint, nil)
+	appReq.Header = appReq.Header.Clone()
+	appReq.Header.Set("If-None-Match", `"`+id+`"`)
+
+	appres, err := self.httpClient.Do(appReq)
+	if err != nil {
+		panic(err)
+	}
+	defer appres.Body.Close()
+
+	return appres.StatusCode == http.StatusOK || appres.StatusCode == http.StatusNotModified
+}
+
+// postExists looks the post up as the author, drafts they can see count.
+func (self *GatewayRoutes) postExists(r *http.Request, slug string) bool {
+	endpoint := "/blog/" + url.PathEscape(slug)
+	return self.send(r, http.MethodGet, &endpoint, "application/json", nil, nil) == nil
+}
+
 func (self *GatewayRoutes) NewPost() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		csrfToken := r.Context().Value("csrf_token").(string)
@@ -286,20 +1182,17 @@ func (self *GatewayRoutes) ProcessNewPost() http.HandlerFunc {
 
 		var payload bytes.Buffer
 		jsonValue := FromUrlValues(r.Form)
-
-		file, header, fileErr := r.FormFile("image")
-		if fileErr == nil {
-			defer file.Close()
-
-			var image bytes.Buffer
-			io.Copy(&image, file)
-			jsonValue["image"] = base64.StdEncoding.EncodeToString(image.Bytes())
-			jsonValue["image_mime"] = header.Header.Get("Content-Type")
+		if _, ok := r.Form["tags"]; ok {
+			jsonValue["tags"] = tagList(r.FormValue("tags"))
 		}
 
 		jsonValue.Encode(&payload)
 
-		err := self.forward(r, nil, &payload, nil)
+		var post models.PostStub
+		var response bytes.Buffer
+		err := self.forward(r, nil, &payload, &response)
+		json.NewDecoder(&response).Decode(&post)
+
 		if err != nil {
 			utils.SetNotifications(
 				w,
@@ -311,6 +1204,19 @@ func (self *GatewayRoutes) ProcessNewPost() http.HandlerFunc {
 			return
 		}
 
+		// The post has been saved by now so it's edited to fix the images
+		if err := self.uploadMedia(r, post.Id); err != nil {
+			editUrl := "/blog/" + post.Id + "/edit"
+			utils.SetNotifications(
+				w,
+				err,
+				editUrl,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, editUrl, http.StatusFound)
+			return
+		}
+
 		sessionId := r.Context().Value("session_id").(string)
 		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
 
@@ -358,6 +1264,108 @@ func (self *GatewayRoutes) ProcessDeletePost() http.HandlerFunc {
 	}
 }
 
+// uploadMedia sends the images in the post form to the app server, the
+// `image` becomes the post's cover and `images` are added alongside it.
+func (self *GatewayRoutes) uploadMedia(r *http.Request, postId string) *models.Notification {
+	if r.MultipartForm == nil {
+		return nil
+	}
+
+	for _, field := range []string{"image", "images"} {
+		endpoint := "/blog/" + url.PathEscape(postId) + "/media"
+		if field == "image" {
+			endpoint += "?cover=true"
+		}
+
+		for _, header := range r.MultipartForm.File[field] {
+			file, err := header.Open()
+			if err != nil {
+				panic(err)
+			}
+
+			notification := self.send(r, http.MethodPost, &endpoint, header.Header.Get("Content-Type"), file, nil)
+			file.Close()
+
+			if notification != nil {
+				return notification
+			}
+		}
+	}
+
+	return nil
+}
+
+func (self *GatewayRoutes) ProcessRemoveMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		editUrl := "/blog/" + id + "/edit"
+
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		csrfToken := r.URL.Query().Get("csrf_token")
+		if userCsrfToken != csrfToken {
+			utils.SetNotifications(
+				w,
+				&models.Notification{
+					Message: "Bad Request",
+				},
+				editUrl,
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", editUrl)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		endpoint := "/blog/" + id + "/media/" + chi.URLParam(r, "mediaId")
+		if err := self.forward(r, &endpoint, nil, nil); err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				editUrl,
+				self.notificationConfig.Timeout,
+			)
+		}
+
+		sessionId := r.Context().Value("session_id").(string)
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", editUrl)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetMedia passes media through from the app server along with the
+// headers that let browsers cache it.
+func (self *GatewayRoutes) GetMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appres, err := self.httpClient.Do(self.appRequest(r, http.MethodGet, nil, nil))
+		if err != nil {
+			panic(err)
+		}
+		defer appres.Body.Close()
+
+		if appres.StatusCode != http.StatusOK && appres.StatusCode != http.StatusNotModified {
+			http.Error(w, "Media not found", http.StatusNotFound)
+			return
+		}
+
+		for _, header := range []string{
+			"Cache-Control",
+			"Content-Length",
+			"Content-Type",
+			"ETag",
+			"X-Content-Type-Options",
+		} {
+			if value := appres.Header.Get(header); value != "" {
+				w.Header().Set(header, value)
+			}
+		}
+
+		w.WriteHeader(appres.StatusCode)
+		io.Copy(w, appres.Body)
+	}
+}
+
 type ForwardError struct {
 	Message string `json:"message"`
 }
@@ -369,6 +1377,27 @@ func (self *ForwardError) Notify() *models.Notification {
 	}
 }
 
+// tagList splits the comma separated tags typed into a form.
+func tagList(value string) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func tagNames(tags []models.Tag) string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+
+	return strings.Join(names, ", ")
+}
+
 type JSONValue map[string]interface{}
 
 func FromUrlValues(values url.Values) JSONValue {
@@ -394,6 +1423,49 @@ func (self *GatewayRoutes) forward(
 	reqData io.Reader,
 	resData io.Writer,
 ) *models.Notification {
+	return self.send(r, r.Method, toUrl, "application/json", reqData, resData)
+}
+
+// send is forward with the method and content type of the request to the
+// app server given instead of taken from r.
+func (self *GatewayRoutes) send(
+	r *http.Request,
+	method string,
+	toUrl *string,
+	contentType string,
+	reqData io.Reader,
+	resData io.Writer,
+) *models.Notification {
+	appReq := self.appRequest(r, method, toUrl, reqData)
+	appReq.Header.Set("Content-Type", contentType)
+
+	appres, err := self.httpClient.Do(appReq)
+	if err != nil {
+		panic(err)
+	}
+
+	if appres.StatusCode >= 200 && appres.StatusCode < 300 {
+		if resData != nil {
+			if _, err := io.Copy(resData, appres.Body); err != nil {
+				panic(err)
+			}
+		}
+		return nil
+	}
+
+	var forwardError models.Notification
+	json.NewDecoder(appres.Body).Decode(&forwardError)
+	return &forwardError
+}
+
+// appRequest builds the request to the app server for r, with its headers
+// and the user's access token.
+func (self *GatewayRoutes) appRequest(
+	r *http.Request,
+	method string,
+	toUrl *string,
+	reqData io.Reader,
+) *http.Request {
 	var endpointString string
 	if toUrl != nil {
 		endpointString = *toUrl
@@ -413,7 +1485,7 @@ func (self *GatewayRoutes) forward(
 
 	appReq, err := http.NewRequestWithContext(
 		r.Context(),
-		r.Method,
+		method,
 		endpoint.String(),
 		reqData,
 	)
@@ -422,29 +1494,12 @@ func (self *GatewayRoutes) forward(
 	}
 	appReq.Header = r.Header
 
-	appReq.Header.Set("Content-Type", "application/json")
 	tokenData, ok := r.Context().Value("token").(*models.AccessTokenResponse)
 	if ok && tokenData != nil {
 		appReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tokenData.AccessToken))
 	}
 
-	appres, err := self.httpClient.Do(appReq)
-	if err != nil {
-		panic(err)
-	}
-
-	if appres.StatusCode >= 200 && appres.StatusCode < 300 {
-		if resData != nil {
-			if _, err := io.Copy(resData, appres.Body); err != nil {
-				panic(err)
-			}
-		}
-		return nil
-	}
-
-	var forwardError models.Notification
-	json.NewDecoder(appres.Body).Decode(&forwardError)
-	return &forwardError
+	return appReq
 }
 
 func (self *GatewayRoutes) Authorize() http.HandlerFunc {
@@ -3,6 +3,7 @@ package routes
 import (
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -18,6 +19,7 @@ type OauthRoutes struct {
 	sessionService     services.SessionService
 	templateService    services.TemplateService
 	notificationConfig config.NotificationsConfig
+	clientScopes       []string
 }
 
 func NewOauthRoutes(
@@ -25,12 +27,14 @@ func NewOauthRoutes(
 	sessionService services.SessionService,
 	templateService services.TemplateService,
 	notificationConfig config.NotificationsConfig,
+	clientScopes []string,
 ) *OauthRoutes {
 	return &OauthRoutes{
 		appService:         appService,
 		sessionService:     sessionService,
 		templateService:    templateService,
 		notificationConfig: notificationConfig,
+		clientScopes:       clientScopes,
 	}
 }
 
@@ -50,6 +54,7 @@ func (r *OauthRoutes) Routes() (string, http.Handler) {
 		group.Get("/application/{id}", r.GetApplication())
 		group.Delete("/application/{id}", r.DeleteApplication())
 		group.Put("/application/{id}/secret", r.NewSecret())
+		group.Post("/application/{id}/scopes", r.UpdateScopes())
 		group.Get("/application", r.ListApplications())
 
 		// The actual Oauth Flow
@@ -137,6 +142,12 @@ func (self *OauthRoutes) ProcessCreateApplication() http.HandlerFunc {
 type GetAppData struct {
 	CsrfToken string
 	App       *models.App
+	Scopes    []ScopeOption
+}
+
+type ScopeOption struct {
+	Name    string
+	Granted bool
 }
 
 func (self *OauthRoutes) GetApplication() http.HandlerFunc {
@@ -161,11 +172,63 @@ func (self *OauthRoutes) GetApplication() http.HandlerFunc {
 			w,
 			"application_detail.html",
 			"layout",
-			models.NewTemplate(GetAppData{userCsrfToken, app}, utils.GetNotifications(r)),
+			models.NewTemplate(
+				GetAppData{userCsrfToken, app, self.scopeOptions(app)},
+				utils.GetNotifications(r),
+			),
 		)
 	}
 }
 
+func (self *OauthRoutes) scopeOptions(app *models.App) []ScopeOption {
+	options := make([]ScopeOption, len(self.clientScopes))
+	for i, scope := range self.clientScopes {
+		options[i] = ScopeOption{Name: scope}
+		for _, granted := range app.Scopes {
+			if granted == scope {
+				options[i].Granted = true
+			}
+		}
+	}
+
+	return options
+}
+
+func (self *OauthRoutes) UpdateScopes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionId := r.Context().Value("session_id").(string)
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		id := chi.URLParam(r, "id")
+		csrfToken := r.FormValue("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/oauth/application/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/oauth/application/"+id, http.StatusFound)
+			return
+		}
+
+		if err := self.appService.UpdateScopes(r.Context(), id, r.Form["scope"]); err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/oauth/application/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/oauth/application/"+id, http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		http.Redirect(w, r, "/oauth/application/"+id, http.StatusFound)
+	}
+}
+
 func (self *OauthRoutes) DeleteApplication() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		sessionId := r.Context().Value("session_id").(string)
@@ -395,6 +458,23 @@ func (self *OauthRoutes) Token() http.HandlerFunc {
 				panic(err)
 			}
 
+			utils.RenderJSON(w, accessTokenResponse, http.StatusOK)
+		case "client_credentials":
+			scopes := strings.Fields(r.FormValue("scope"))
+
+			accessTokenResponse, err := self.appService.NewClientToken(r.Context(), clientId, clientSecret, scopes)
+			if err == services.ScopeNotGranted {
+				log.Println("Scope not granted: ", scopes)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if err != nil {
+				log.Println("Invalid client credentials: ", clientId)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
 			utils.RenderJSON(w, accessTokenResponse, http.StatusOK)
 		default:
 			log.Println("Invalid grant type: ", grantType)
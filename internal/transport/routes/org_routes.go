@@ -18,6 +18,7 @@ type OrganizationRoutes struct {
 	sessionService     services.SessionService
 	templateService    services.TemplateService
 	orgService         services.OrganizationService
+	policyValidator    services.PolicyValidator
 }
 
 func NewOrganizationRoutes(
@@ -25,12 +26,14 @@ func NewOrganizationRoutes(
 	sessionService services.SessionService,
 	templateService services.TemplateService,
 	orgService services.OrganizationService,
+	policyValidator services.PolicyValidator,
 ) *OrganizationRoutes {
 	return &OrganizationRoutes{
 		notificationConfig: notificationConfig,
 		sessionService:     sessionService,
 		templateService:    templateService,
 		orgService:         orgService,
+		policyValidator:    policyValidator,
 	}
 }
 
@@ -143,7 +146,7 @@ func (self *OrganizationRoutes) ProcessCreateOrg() http.HandlerFunc {
 			return
 		}
 
-		err := self.orgService.CreateOrganization(r.Context(), userId, name, description)
+		_, err := self.orgService.CreateOrganization(r.Context(), userId, name, description)
 		if err != nil {
 			utils.SetNotifications(
 				w,
@@ -283,6 +286,12 @@ type CreateInOrgData struct {
 	OrgId     string
 }
 
+type CreateOrgPolicyData struct {
+	CsrfToken string
+	OrgId     string
+	Form      PolicyFormData
+}
+
 func (self *OrganizationRoutes) CreateOrgPolicy() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userCsrfToken := r.Context().Value("csrf_token").(string)
@@ -295,9 +304,10 @@ func (self *OrganizationRoutes) CreateOrgPolicy() http.HandlerFunc {
 			"org_policy_create.html",
 			"layout",
 			models.NewTemplate(
-				CreateInOrgData{
+				CreateOrgPolicyData{
 					CsrfToken: userCsrfToken,
 					OrgId:     orgId,
+					Form:      NewPolicyFormData(self.policyValidator),
 				},
 				utils.GetNotifications(r),
 			),
@@ -313,6 +323,7 @@ func (self *OrganizationRoutes) ProcessCreateOrgPolicy() http.HandlerFunc {
 		resource := r.FormValue("resource")
 		action := r.FormValue("action")
 		effect := r.FormValue("effect")
+		condition := r.FormValue("condition")
 		orgId := chi.URLParam(r, "id")
 
 		csrfToken := r.FormValue("csrf_token")
@@ -328,7 +339,7 @@ func (self *OrganizationRoutes) ProcessCreateOrgPolicy() http.HandlerFunc {
 			return
 		}
 
-		err := self.orgService.CreatePolicy(r.Context(), orgId, resource, action, effect)
+		err := self.orgService.CreatePolicy(r.Context(), orgId, resource, action, effect, condition)
 
 		if err != nil {
 			utils.SetNotifications(
@@ -2,8 +2,10 @@ package routes
 
 import (
 	"net/http"
+	"sort"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jhamill34/notion-provisioner/internal/models"
 	"github.com/jhamill34/notion-provisioner/internal/services"
 	"github.com/jhamill34/notion-provisioner/internal/services/rbac"
 	"github.com/jhamill34/notion-provisioner/internal/transport/middleware"
@@ -36,9 +38,11 @@ func (self *PolicyRoutes) Routes() (string, http.Handler) {
 	router := chi.NewRouter()
 	router.Use(middleware.NewAuthorizeMiddleware(self.sessionService))
 	router.Use(middleware.NewTokenAuthMiddleware(self.signer))
-	router.Use(middleware.UnauthorizedMiddleware)
 
-	router.Get("/", self.ListMyPolicies())
+	router.With(middleware.UnauthorizedMiddleware).Get("/", self.ListMyPolicies())
+
+	// Other services fetch any user's policies with their own client token
+	router.With(middleware.NewRequireScopeMiddleware("policy:read")).Get("/{id}", self.GetUserPolicies())
 	return "/policy", router
 }
 
@@ -61,4 +65,49 @@ func (self *PolicyRoutes) ListMyPolicies() http.HandlerFunc {
 	}
 }
 
+func (self *PolicyRoutes) GetUserPolicies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := chi.URLParam(r, "id")
+
+		response, err := self.policyProvider.GetPolicies(r.Context(), userId)
+		if err != nil {
+			utils.RenderJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		utils.RenderJSON(w, response, http.StatusOK)
+	}
+}
+
 // var _ transport.Router = (*PolicyRoutes)(nil)
+
+//==============================================================================
+
+// PolicyFormData backs the policy_fields component used by every form
+// that creates a policy, offering the known resources and actions as
+// autocomplete suggestions.
+type PolicyFormData struct {
+	Resources []models.ResourceDefinition
+	Actions   []string
+}
+
+func NewPolicyFormData(policyValidator services.PolicyValidator) PolicyFormData {
+	resources := policyValidator.Resources()
+
+	seen := make(map[string]bool)
+	actions := make([]string, 0)
+	for _, resource := range resources {
+		for _, action := range resource.Actions {
+			if !seen[action] {
+				seen[action] = true
+				actions = append(actions, action)
+			}
+		}
+	}
+	sort.Strings(actions)
+
+	return PolicyFormData{
+		Resources: resources,
+		Actions:   actions,
+	}
+}
@@ -0,0 +1,568 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jhamill34/notion-provisioner/internal/config"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/transport/middleware"
+	"github.com/jhamill34/notion-provisioner/internal/transport/utils"
+)
+
+const maxPolicySetDocumentSize = 1 << 20
+
+type PolicySetRoutes struct {
+	notificationConfig config.NotificationsConfig
+	sessionService     services.SessionService
+	templateService    services.TemplateService
+	policySetService   services.PolicySetService
+	policyValidator    services.PolicyValidator
+}
+
+func NewPolicySetRoutes(
+	notificationConfig config.NotificationsConfig,
+	sessionService services.SessionService,
+	templateService services.TemplateService,
+	policySetService services.PolicySetService,
+	policyValidator services.PolicyValidator,
+) *PolicySetRoutes {
+	return &PolicySetRoutes{
+		notificationConfig: notificationConfig,
+		sessionService:     sessionService,
+		templateService:    templateService,
+		policySetService:   policySetService,
+		policyValidator:    policyValidator,
+	}
+}
+
+// Routes implements transport.Router.
+func (self *PolicySetRoutes) Routes() (string, http.Handler) {
+	router := chi.NewRouter()
+	router.Use(middleware.NewAuthorizeMiddleware(self.sessionService))
+	router.Use(middleware.RedirectToLoginMiddleware)
+
+	router.Get("/", self.ListSets())
+
+	router.Get("/new", self.CreateSet())
+	router.Post("/", self.ProcessCreateSet())
+
+	router.Get("/import", self.ImportSet())
+	router.Post("/import", self.ProcessImportSet())
+
+	router.Get("/{id}", self.GetSet())
+	router.Delete("/{id}", self.DeleteSet())
+	router.Get("/{id}/export", self.ExportSet())
+
+	router.Get("/{id}/policy/new", self.CreateSetPolicy())
+	router.Post("/{id}/policy", self.ProcessCreateSetPolicy())
+	router.Delete("/{id}/policy/{policyId}", self.DeleteSetPolicy())
+
+	router.Post("/{id}/user", self.AttachUser())
+	router.Delete("/{id}/user/{userId}", self.DetachUser())
+	router.Post("/{id}/org", self.AttachOrg())
+	router.Delete("/{id}/org/{orgId}", self.DetachOrg())
+
+	return "/policyset", router
+}
+
+type ListPolicySetsData struct {
+	CsrfToken string
+	Sets      []models.PolicySet
+}
+
+func (self *PolicySetRoutes) ListSets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		sets, err := self.policySetService.ListSets(r.Context())
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/auth",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/auth", http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"policyset_list.html",
+			"layout",
+			models.NewTemplate(
+				ListPolicySetsData{
+					CsrfToken: userCsrfToken,
+					Sets:      sets,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+func (self *PolicySetRoutes) CreateSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"policyset_create.html",
+			"layout",
+			models.NewTemplate(
+				map[string]string{
+					"CsrfToken": userCsrfToken,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+func (self *PolicySetRoutes) ProcessCreateSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionId := r.Context().Value("session_id").(string)
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		name := r.FormValue("name")
+		description := r.FormValue("description")
+		csrfToken := r.FormValue("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/policyset/new",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/new", http.StatusFound)
+			return
+		}
+
+		set, err := self.policySetService.CreateSet(r.Context(), name, description)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset/new",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/new", http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+		http.Redirect(w, r, "/policyset/"+set.SetId, http.StatusFound)
+	}
+}
+
+func (self *PolicySetRoutes) ImportSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"policyset_import.html",
+			"layout",
+			models.NewTemplate(
+				map[string]string{
+					"CsrfToken": userCsrfToken,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+func (self *PolicySetRoutes) ProcessImportSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionId := r.Context().Value("session_id").(string)
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxPolicySetDocumentSize)
+		if err := r.ParseMultipartForm(maxPolicySetDocumentSize); err != nil && err != http.ErrNotMultipart {
+			utils.SetNotifications(
+				w,
+				services.InvalidPolicySetDocument,
+				"/policyset/import",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/import", http.StatusFound)
+			return
+		}
+
+		csrfToken := r.FormValue("csrf_token")
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/policyset/import",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/import", http.StatusFound)
+			return
+		}
+
+		// An uploaded file takes precedence over the pasted document.
+		document := []byte(r.FormValue("document"))
+		if file, _, err := r.FormFile("file"); err == nil {
+			defer file.Close()
+
+			document, err = io.ReadAll(file)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		set, err := self.policySetService.Import(r.Context(), document)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset/import",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/import", http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+		http.Redirect(w, r, "/policyset/"+set.SetId, http.StatusFound)
+	}
+}
+
+type GetPolicySetData struct {
+	CsrfToken string
+	Set       *models.PolicySet
+	Users     []models.User
+	Orgs      []models.Organization
+}
+
+func (self *PolicySetRoutes) GetSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		id := chi.URLParam(r, "id")
+
+		set, err := self.policySetService.GetSet(r.Context(), id)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset", http.StatusFound)
+			return
+		}
+
+		// Attachments are only shown to those allowed to see them.
+		users, _ := self.policySetService.ListUsers(r.Context(), id)
+		orgs, _ := self.policySetService.ListOrgs(r.Context(), id)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"policyset_detail.html",
+			"layout",
+			models.NewTemplate(
+				GetPolicySetData{
+					CsrfToken: userCsrfToken,
+					Set:       set,
+					Users:     users,
+					Orgs:      orgs,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+func (self *PolicySetRoutes) DeleteSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		sessionId := r.Context().Value("session_id").(string)
+
+		id := chi.URLParam(r, "id")
+		csrfToken := r.URL.Query().Get("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/policyset/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+			return
+		}
+
+		err := self.policySetService.DeleteSet(r.Context(), id)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset", http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", "/policyset")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *PolicySetRoutes) ExportSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		document, err := self.policySetService.Export(r.Context(), id)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Content-Disposition", `attachment; filename="policyset-`+id+`.yaml"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(document)
+	}
+}
+
+type CreateInPolicySetData struct {
+	CsrfToken string
+	SetId     string
+	Form      PolicyFormData
+}
+
+func (self *PolicySetRoutes) CreateSetPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		id := chi.URLParam(r, "id")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"policyset_policy_create.html",
+			"layout",
+			models.NewTemplate(
+				CreateInPolicySetData{
+					CsrfToken: userCsrfToken,
+					SetId:     id,
+					Form:      NewPolicyFormData(self.policyValidator),
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+func (self *PolicySetRoutes) ProcessCreateSetPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		sessionId := r.Context().Value("session_id").(string)
+
+		resource := r.FormValue("resource")
+		action := r.FormValue("action")
+		effect := r.FormValue("effect")
+		condition := r.FormValue("condition")
+		id := chi.URLParam(r, "id")
+
+		csrfToken := r.FormValue("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/policyset/"+id+"/policy/new",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id+"/policy/new", http.StatusFound)
+			return
+		}
+
+		err := self.policySetService.CreatePolicy(r.Context(), id, resource, action, effect, condition)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset/"+id+"/policy/new",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id+"/policy/new", http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+		http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+	}
+}
+
+func (self *PolicySetRoutes) DeleteSetPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		sessionId := r.Context().Value("session_id").(string)
+
+		id := chi.URLParam(r, "id")
+		policyId, parseIntErr := strconv.ParseInt(chi.URLParam(r, "policyId"), 10, 64)
+		if parseIntErr != nil {
+			panic(parseIntErr)
+		}
+
+		csrfToken := r.URL.Query().Get("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/policyset/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+			return
+		}
+
+		err := self.policySetService.DeletePolicy(r.Context(), id, int(policyId))
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", "/policyset/"+id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//==============================================================================
+// Attachments
+//==============================================================================
+
+func (self *PolicySetRoutes) AttachUser() http.HandlerFunc {
+	return self.attach(func(r *http.Request, id, targetId string) models.Notifier {
+		return self.policySetService.AttachToUser(r.Context(), id, targetId)
+	})
+}
+
+func (self *PolicySetRoutes) DetachUser() http.HandlerFunc {
+	return self.detach("userId", func(r *http.Request, id, targetId string) models.Notifier {
+		return self.policySetService.DetachFromUser(r.Context(), id, targetId)
+	})
+}
+
+func (self *PolicySetRoutes) AttachOrg() http.HandlerFunc {
+	return self.attach(func(r *http.Request, id, targetId string) models.Notifier {
+		return self.policySetService.AttachToOrg(r.Context(), id, targetId)
+	})
+}
+
+func (self *PolicySetRoutes) DetachOrg() http.HandlerFunc {
+	return self.detach("orgId", func(r *http.Request, id, targetId string) models.Notifier {
+		return self.policySetService.DetachFromOrg(r.Context(), id, targetId)
+	})
+}
+
+type attachmentHandler func(r *http.Request, id, targetId string) models.Notifier
+
+func (self *PolicySetRoutes) attach(handler attachmentHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		sessionId := r.Context().Value("session_id").(string)
+
+		id := chi.URLParam(r, "id")
+		targetId := r.FormValue("target_id")
+		csrfToken := r.FormValue("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/policyset/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+			return
+		}
+
+		if err := handler(r, id, targetId); err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+		http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+	}
+}
+
+func (self *PolicySetRoutes) detach(param string, handler attachmentHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		sessionId := r.Context().Value("session_id").(string)
+
+		id := chi.URLParam(r, "id")
+		targetId := chi.URLParam(r, param)
+		csrfToken := r.URL.Query().Get("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/policyset/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+			return
+		}
+
+		if err := handler(r, id, targetId); err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/policyset/"+id,
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/policyset/"+id, http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", "/policyset/"+id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,351 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/transport/middleware"
+)
+
+// Used when a list request doesn't say how many resources it wants.
+const SCIM_DEFAULT_COUNT = 100
+
+const SCIM_CONTENT_TYPE = "application/scim+json"
+
+type ScimRoutes struct {
+	signer      services.Signer
+	scimService services.ScimService
+}
+
+func NewScimRoutes(
+	signer services.Signer,
+	scimService services.ScimService,
+) *ScimRoutes {
+	return &ScimRoutes{
+		signer:      signer,
+		scimService: scimService,
+	}
+}
+
+// Routes implements transport.Router.
+func (self *ScimRoutes) Routes() (string, http.Handler) {
+	router := chi.NewRouter()
+	router.Use(middleware.NewTokenAuthMiddleware(self.signer))
+
+	// Other services look up a user's details with the read only scope
+	router.With(middleware.NewRequireScopeMiddleware("scim", "user:read")).Get("/Users/{id}", self.GetUser())
+
+	router.Group(func(group chi.Router) {
+		group.Use(middleware.NewRequireScopeMiddleware("scim"))
+
+		group.Get("/ServiceProviderConfig", self.ServiceProviderConfig())
+
+		group.Get("/Users", self.ListUsers())
+		group.Post("/Users", self.CreateUser())
+		group.Put("/Users/{id}", self.ReplaceUser())
+		group.Patch("/Users/{id}", self.PatchUser())
+		group.Delete("/Users/{id}", self.DeactivateUser())
+
+		group.Get("/Groups", self.ListGroups())
+		group.Post("/Groups", self.CreateGroup())
+		group.Get("/Groups/{id}", self.GetGroup())
+		group.Put("/Groups/{id}", self.ReplaceGroup())
+		group.Patch("/Groups/{id}", self.PatchGroup())
+		group.Delete("/Groups/{id}", self.DeleteGroup())
+	})
+
+	return "/scim/v2", router
+}
+
+func (self *ScimRoutes) ServiceProviderConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderScim(w, map[string]interface{}{
+			"schemas":        []string{models.ScimServiceProviderConfigSchema},
+			"patch":          map[string]bool{"supported": true},
+			"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+			"filter":         map[string]interface{}{"supported": true, "maxResults": 200},
+			"changePassword": map[string]bool{"supported": true},
+			"sort":           map[string]bool{"supported": false},
+			"etag":           map[string]bool{"supported": false},
+			"authenticationSchemes": []map[string]string{
+				{
+					"type":        "oauthbearertoken",
+					"name":        "OAuth Bearer Token",
+					"description": "A client_credentials token granted the scim scope",
+				},
+			},
+		}, http.StatusOK)
+	}
+}
+
+//==============================================================================
+// Users
+//==============================================================================
+
+func (self *ScimRoutes) ListUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, ok := scimQuery(w, r)
+		if !ok {
+			return
+		}
+
+		response, err := self.scimService.ListUsers(r.Context(), query)
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		renderScim(w, response, http.StatusOK)
+	}
+}
+
+func (self *ScimRoutes) GetUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := self.scimService.GetUser(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		renderScim(w, user, http.StatusOK)
+	}
+}
+
+func (self *ScimRoutes) CreateUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.ScimUser
+		if !decodeScim(w, r, &request) {
+			return
+		}
+
+		user, err := self.scimService.CreateUser(r.Context(), &request)
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		w.Header().Set("Location", user.Meta.Location)
+		renderScim(w, user, http.StatusCreated)
+	}
+}
+
+func (self *ScimRoutes) ReplaceUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.ScimUser
+		if !decodeScim(w, r, &request) {
+			return
+		}
+
+		user, err := self.scimService.ReplaceUser(r.Context(), chi.URLParam(r, "id"), &request)
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		renderScim(w, user, http.StatusOK)
+	}
+}
+
+func (self *ScimRoutes) PatchUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.ScimPatchRequest
+		if !decodeScim(w, r, &request) {
+			return
+		}
+
+		user, err := self.scimService.PatchUser(r.Context(), chi.URLParam(r, "id"), request.Operations)
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		renderScim(w, user, http.StatusOK)
+	}
+}
+
+func (self *ScimRoutes) DeactivateUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := self.scimService.DeactivateUser(r.Context(), chi.URLParam(r, "id")); err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//==============================================================================
+// Groups
+//==============================================================================
+
+func (self *ScimRoutes) ListGroups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, ok := scimQuery(w, r)
+		if !ok {
+			return
+		}
+
+		response, err := self.scimService.ListGroups(r.Context(), query)
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		renderScim(w, response, http.StatusOK)
+	}
+}
+
+func (self *ScimRoutes) GetGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, err := self.scimService.GetGroup(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		renderScim(w, group, http.StatusOK)
+	}
+}
+
+func (self *ScimRoutes) CreateGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.ScimGroup
+		if !decodeScim(w, r, &request) {
+			return
+		}
+
+		group, err := self.scimService.CreateGroup(r.Context(), &request)
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		w.Header().Set("Location", group.Meta.Location)
+		renderScim(w, group, http.StatusCreated)
+	}
+}
+
+func (self *ScimRoutes) ReplaceGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.ScimGroup
+		if !decodeScim(w, r, &request) {
+			return
+		}
+
+		group, err := self.scimService.ReplaceGroup(r.Context(), chi.URLParam(r, "id"), &request)
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		renderScim(w, group, http.StatusOK)
+	}
+}
+
+func (self *ScimRoutes) PatchGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.ScimPatchRequest
+		if !decodeScim(w, r, &request) {
+			return
+		}
+
+		group, err := self.scimService.PatchGroup(r.Context(), chi.URLParam(r, "id"), request.Operations)
+		if err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		renderScim(w, group, http.StatusOK)
+	}
+}
+
+func (self *ScimRoutes) DeleteGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := self.scimService.DeleteGroup(r.Context(), chi.URLParam(r, "id")); err != nil {
+			renderScimError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// var _ transport.Router = (*ScimRoutes)(nil)
+
+//==============================================================================
+
+func scimQuery(w http.ResponseWriter, r *http.Request) (models.ScimQuery, bool) {
+	values := r.URL.Query()
+	query := models.ScimQuery{
+		Filter:     values.Get("filter"),
+		StartIndex: 1,
+		Count:      SCIM_DEFAULT_COUNT,
+	}
+
+	if startIndex := values.Get("startIndex"); startIndex != "" {
+		parsed, err := strconv.Atoi(startIndex)
+		if err != nil {
+			renderScimError(w, services.NewScimServiceError(400, "invalidValue", "startIndex must be a number"))
+			return query, false
+		}
+		query.StartIndex = parsed
+	}
+
+	if count := values.Get("count"); count != "" {
+		parsed, err := strconv.Atoi(count)
+		if err != nil {
+			renderScimError(w, services.NewScimServiceError(400, "invalidValue", "count must be a number"))
+			return query, false
+		}
+		query.Count = parsed
+	}
+
+	if excluded := values.Get("excludedAttributes"); excluded != "" {
+		query.ExcludedAttributes = strings.Split(excluded, ",")
+	}
+
+	return query, true
+}
+
+func decodeScim(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		renderScimError(w, services.NewScimServiceError(400, "invalidSyntax", "Request body is not valid JSON"))
+		return false
+	}
+
+	return true
+}
+
+func renderScim(w http.ResponseWriter, data interface{}, statusCode int) {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", SCIM_CONTENT_TYPE)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func renderScimError(w http.ResponseWriter, err models.Notifier) {
+	status := http.StatusBadRequest
+	scimType := ""
+	if scimErr, ok := err.(*services.ScimServiceError); ok {
+		status = scimErr.Status
+		scimType = scimErr.ScimType
+	}
+
+	renderScim(w, models.ScimError{
+		Schemas:  []string{models.ScimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   err.Notify().Message,
+	}, status)
+}
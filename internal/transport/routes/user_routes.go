@@ -18,6 +18,7 @@ type UserRoutes struct {
 	sessionService     services.SessionService
 	templateService    services.TemplateService
 	userService        services.UserService
+	policyValidator    services.PolicyValidator
 }
 
 func NewUserRoutes(
@@ -25,12 +26,14 @@ func NewUserRoutes(
 	sessionService services.SessionService,
 	templateService services.TemplateService,
 	userService services.UserService,
+	policyValidator services.PolicyValidator,
 ) *UserRoutes {
 	return &UserRoutes{
 		notificationConfig: notificationConfig,
 		sessionService:     sessionService,
 		templateService:    templateService,
 		userService:        userService,
+		policyValidator:    policyValidator,
 	}
 }
 
@@ -44,6 +47,7 @@ func (self *UserRoutes) Routes() (string, http.Handler) {
 	router.Get("/{id}/policy", self.ListPolicies())
 	router.Post("/{id}/policy", self.ProcessCreatePolicy())
 	router.Get("/{id}/policy/new", self.CreatePolicy())
+	router.Get("/{id}/policy/explain", self.ExplainPolicy())
 	router.Delete("/{id}/policy/{policyId}", self.DeletePolicy())
 
 	return "/user", router
@@ -150,6 +154,7 @@ func (self *UserRoutes) ListPolicies() http.HandlerFunc {
 type NewPolicyData struct {
 	UserId    string
 	CsrfToken string
+	Form      PolicyFormData
 }
 
 func (self *UserRoutes) CreatePolicy() http.HandlerFunc {
@@ -162,7 +167,7 @@ func (self *UserRoutes) CreatePolicy() http.HandlerFunc {
 			w,
 			"users_policy_create.html",
 			"layout",
-			models.NewTemplate(NewPolicyData{userId, userCsrfToken}, utils.GetNotifications(r)),
+			models.NewTemplate(NewPolicyData{userId, userCsrfToken, NewPolicyFormData(self.policyValidator)}, utils.GetNotifications(r)),
 		)
 	}
 }
@@ -176,6 +181,7 @@ func (self *UserRoutes) ProcessCreatePolicy() http.HandlerFunc {
 		resource := r.FormValue("resource")
 		action := r.FormValue("action")
 		effect := r.FormValue("effect")
+		condition := r.FormValue("condition")
 		csrfToken := r.FormValue("csrf_token")
 
 		if csrfToken != userCsrfToken {
@@ -189,7 +195,7 @@ func (self *UserRoutes) ProcessCreatePolicy() http.HandlerFunc {
 			return
 		}
 
-		if err := self.userService.CreatePolicy(r.Context(), userId, resource, action, effect); err != nil {
+		if err := self.userService.CreatePolicy(r.Context(), userId, resource, action, effect, condition); err != nil {
 			utils.SetNotifications(
 				w,
 				err,
@@ -257,3 +263,48 @@ func (self *UserRoutes) DeletePolicy() http.HandlerFunc {
 	}
 }
 
+type ExplainPolicyData struct {
+	UserId      string
+	Resource    string
+	Action      string
+	Explanation *models.PolicyExplanation
+}
+
+func (self *UserRoutes) ExplainPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := chi.URLParam(r, "id")
+		resource := r.URL.Query().Get("resource")
+		action := r.URL.Query().Get("action")
+
+		data := ExplainPolicyData{
+			UserId:   userId,
+			Resource: resource,
+			Action:   action,
+		}
+
+		if resource != "" && action != "" {
+			explanation, err := self.userService.ExplainPolicy(r.Context(), userId, resource, action)
+			if err != nil {
+				utils.SetNotifications(
+					w,
+					err,
+					"/user/"+userId+"/policy",
+					self.notificationConfig.Timeout,
+				)
+				http.Redirect(w, r, "/user/"+userId+"/policy", http.StatusFound)
+				return
+			}
+
+			data.Explanation = explanation
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"users_policy_explain.html",
+			"layout",
+			models.NewTemplate(data, utils.GetNotifications(r)),
+		)
+	}
+}
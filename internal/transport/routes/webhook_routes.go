@@ -0,0 +1,349 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jhamill34/notion-provisioner/internal/config"
+	"github.com/jhamill34/notion-provisioner/internal/models"
+	"github.com/jhamill34/notion-provisioner/internal/services"
+	"github.com/jhamill34/notion-provisioner/internal/transport/middleware"
+	"github.com/jhamill34/notion-provisioner/internal/transport/utils"
+)
+
+type WebhookRoutes struct {
+	notificationConfig config.NotificationsConfig
+	sessionService     services.SessionService
+	templateService    services.TemplateService
+	webhookService     services.WebhookService
+}
+
+func NewWebhookRoutes(
+	notificationConfig config.NotificationsConfig,
+	sessionService services.SessionService,
+	templateService services.TemplateService,
+	webhookService services.WebhookService,
+) *WebhookRoutes {
+	return &WebhookRoutes{
+		notificationConfig: notificationConfig,
+		sessionService:     sessionService,
+		templateService:    templateService,
+		webhookService:     webhookService,
+	}
+}
+
+// Routes implements transport.Router.
+func (self *WebhookRoutes) Routes() (string, http.Handler) {
+	router := chi.NewRouter()
+	router.Use(middleware.NewAuthorizeMiddleware(self.sessionService))
+	router.Use(middleware.RedirectToLoginMiddleware)
+
+	router.Get("/", self.ListWebhooks())
+
+	router.Get("/new", self.CreateWebhook())
+	router.Post("/", self.ProcessCreateWebhook())
+
+	router.Get("/dead", self.ListDeadDeliveries())
+
+	router.Get("/{id}", self.GetWebhook())
+	router.Delete("/{id}", self.DeleteWebhook())
+	router.Put("/{id}/delivery/{deliveryId}/retry", self.RetryDelivery())
+
+	return "/webhook", router
+}
+
+type ListWebhooksData struct {
+	CsrfToken string
+	Webhooks  []models.Webhook
+}
+
+func (self *WebhookRoutes) ListWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		webhooks, err := self.webhookService.ListWebhooks(r.Context())
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/auth",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/auth", http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"webhook_list.html",
+			"layout",
+			models.NewTemplate(
+				ListWebhooksData{
+					CsrfToken: userCsrfToken,
+					Webhooks:  webhooks,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+type CreateWebhookData struct {
+	CsrfToken string
+	Events    []string
+}
+
+func (self *WebhookRoutes) CreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"webhook_create.html",
+			"layout",
+			models.NewTemplate(
+				CreateWebhookData{
+					CsrfToken: userCsrfToken,
+					Events:    models.WebhookEvents,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+type WebhookSecretData struct {
+	Webhook *models.Webhook
+	Secret  string
+}
+
+func (self *WebhookRoutes) ProcessCreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionId := r.Context().Value("session_id").(string)
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		ownerType := r.FormValue("owner_type")
+		ownerId := r.FormValue("owner_id")
+		url := r.FormValue("url")
+		csrfToken := r.FormValue("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/webhook/new",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/webhook/new", http.StatusFound)
+			return
+		}
+
+		webhook, secret, err := self.webhookService.CreateWebhook(
+			r.Context(),
+			ownerType,
+			ownerId,
+			url,
+			r.Form["event"],
+		)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/webhook/new",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/webhook/new", http.StatusFound)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"webhook_secret.html",
+			"layout",
+			models.NewTemplateData(WebhookSecretData{webhook, secret}),
+		)
+	}
+}
+
+type GetWebhookData struct {
+	CsrfToken  string
+	Webhook    *models.Webhook
+	Deliveries []models.WebhookDelivery
+}
+
+func (self *WebhookRoutes) GetWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		id := chi.URLParam(r, "id")
+
+		webhook, err := self.webhookService.GetWebhook(r.Context(), id)
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/webhook",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/webhook", http.StatusFound)
+			return
+		}
+
+		deliveries, err := self.webhookService.ListDeliveries(r.Context(), id)
+		if err != nil {
+			deliveries = []models.WebhookDelivery{}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"webhook_detail.html",
+			"layout",
+			models.NewTemplate(
+				GetWebhookData{
+					CsrfToken:  userCsrfToken,
+					Webhook:    webhook,
+					Deliveries: deliveries,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+type ListDeadDeliveriesData struct {
+	CsrfToken  string
+	Deliveries []models.WebhookDelivery
+}
+
+func (self *WebhookRoutes) ListDeadDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+
+		deliveries, err := self.webhookService.ListDeadDeliveries(r.Context())
+		if err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/webhook",
+				self.notificationConfig.Timeout,
+			)
+			http.Redirect(w, r, "/webhook", http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		self.templateService.Render(
+			w,
+			"webhook_dead.html",
+			"layout",
+			models.NewTemplate(
+				ListDeadDeliveriesData{
+					CsrfToken:  userCsrfToken,
+					Deliveries: deliveries,
+				},
+				utils.GetNotifications(r),
+			),
+		)
+	}
+}
+
+func (self *WebhookRoutes) DeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		sessionId := r.Context().Value("session_id").(string)
+
+		id := chi.URLParam(r, "id")
+		csrfToken := r.URL.Query().Get("csrf_token")
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				"/webhook/"+id,
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", "/webhook/"+id)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if err := self.webhookService.DeleteWebhook(r.Context(), id); err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				"/webhook",
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", "/webhook")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", "/webhook")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RetryDelivery puts a dead delivery back on the queue and sends the
+// browser back to the page it came from.
+func (self *WebhookRoutes) RetryDelivery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userCsrfToken := r.Context().Value("csrf_token").(string)
+		sessionId := r.Context().Value("session_id").(string)
+
+		id := chi.URLParam(r, "id")
+		deliveryId, parseIntErr := strconv.ParseInt(chi.URLParam(r, "deliveryId"), 10, 64)
+		if parseIntErr != nil {
+			panic(parseIntErr)
+		}
+
+		csrfToken := r.URL.Query().Get("csrf_token")
+		returnTo := "/webhook/" + id
+		if r.URL.Query().Get("from") == "dead" {
+			returnTo = "/webhook/dead"
+		}
+
+		if csrfToken != userCsrfToken {
+			utils.SetNotifications(
+				w,
+				utils.NewGenericMessage("bad request, please try again."),
+				returnTo,
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", returnTo)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if err := self.webhookService.RetryDelivery(r.Context(), id, deliveryId); err != nil {
+			utils.SetNotifications(
+				w,
+				err,
+				returnTo,
+				self.notificationConfig.Timeout,
+			)
+			w.Header().Set("HX-Redirect", returnTo)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		self.sessionService.UpdateCsrf(r.Context(), sessionId, uuid.New().String())
+
+		w.Header().Set("HX-Redirect", returnTo)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
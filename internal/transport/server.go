@@ -14,6 +14,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
 	"github.com/jhamill34/notion-provisioner/internal/config"
+	transportmiddleware "github.com/jhamill34/notion-provisioner/internal/transport/middleware"
 )
 
 type Router interface {
@@ -41,6 +42,7 @@ func NewServer(
 	// TODO: Add header for Content Security Policy (CSP)? 
 	router.Use(middleware.RequestID)
 	router.Use(middleware.RealIP)
+	router.Use(transportmiddleware.RequestMetadataMiddleware)
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.Timeout(60 * time.Second))
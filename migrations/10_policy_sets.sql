@@ -0,0 +1,44 @@
+create table if not exists policy_set (
+	id varchar(36) primary key not null,
+	name varchar(255) not null,
+	description text
+);
+
+create unique index idx_policy_set_name on policy_set (name);
+
+create table if not exists policy_set_permission (
+	id int primary key not null auto_increment,
+	set_id varchar(36) not null,
+	resource text not null,
+	action text not null,
+	effect text not null,
+
+	foreign key (set_id) references policy_set(id)
+);
+
+create table if not exists user_policy_set (
+	id int primary key not null auto_increment,
+	user_id varchar(36) not null,
+	set_id varchar(36) not null,
+
+	foreign key (user_id) references user(id),
+	foreign key (set_id) references policy_set(id)
+);
+
+create unique index idx_user_policy_set_ids on user_policy_set (user_id, set_id);
+
+create table if not exists organization_policy_set (
+	id int primary key not null auto_increment,
+	org_id varchar(36) not null,
+	set_id varchar(36) not null,
+
+	foreign key (org_id) references organization(id),
+	foreign key (set_id) references policy_set(id)
+);
+
+create unique index idx_organization_policy_set_ids on organization_policy_set (org_id, set_id);
+
+grant select, insert, update, delete on `datadb`.`policy_set` to `auth_user`@`%`;
+grant select, insert, update, delete on `datadb`.`policy_set_permission` to `auth_user`@`%`;
+grant select, insert, update, delete on `datadb`.`user_policy_set` to `auth_user`@`%`;
+grant select, insert, update, delete on `datadb`.`organization_policy_set` to `auth_user`@`%`;
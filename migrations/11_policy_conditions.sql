@@ -0,0 +1,3 @@
+alter table user_permission add column cond varchar(1024) not null default '';
+alter table organization_permission add column cond varchar(1024) not null default '';
+alter table policy_set_permission add column cond varchar(1024) not null default '';
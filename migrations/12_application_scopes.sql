@@ -0,0 +1 @@
+alter table application add column scopes varchar(1024) not null default '';
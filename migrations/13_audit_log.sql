@@ -0,0 +1,17 @@
+create table if not exists audit_log (
+	id bigint primary key not null auto_increment,
+	actor varchar(255) not null,
+	action varchar(64) not null,
+	target varchar(255) not null default '',
+	detail text not null,
+	ip varchar(64) not null default '',
+	request_id varchar(128) not null default '',
+	created_at timestamp not null default current_timestamp
+);
+
+create index idx_audit_log_actor on audit_log (actor);
+create index idx_audit_log_action on audit_log (action);
+create index idx_audit_log_target on audit_log (target);
+
+-- The auth service may only append to the audit log
+grant select, insert on `datadb`.`audit_log` to `auth_user`@`%`;
@@ -0,0 +1,38 @@
+create table if not exists webhook (
+	id varchar(36) primary key not null,
+	owner_type varchar(16) not null,
+	owner_id varchar(36) not null,
+	url text not null,
+	secret varchar(255) not null,
+	events varchar(1024) not null default '',
+	created_at timestamp not null default current_timestamp
+);
+
+create index idx_webhook_owner on webhook (owner_type, owner_id);
+
+create table if not exists webhook_delivery (
+	id bigint primary key not null auto_increment,
+	webhook_id varchar(36) not null,
+	event_id varchar(36) not null,
+	event varchar(64) not null,
+	payload mediumtext not null,
+	status varchar(16) not null default 'pending',
+	attempts int not null default 0,
+	next_attempt_at timestamp not null default current_timestamp,
+	last_status int not null default 0,
+	last_error varchar(1024) not null default '',
+	created_at timestamp not null default current_timestamp,
+	updated_at timestamp not null default current_timestamp on update current_timestamp,
+
+	foreign key (webhook_id) references webhook(id) on delete cascade
+);
+
+create index idx_webhook_delivery_due on webhook_delivery (status, next_attempt_at);
+create index idx_webhook_delivery_webhook on webhook_delivery (webhook_id, id);
+
+grant select, insert, update, delete on `datadb`.`webhook` to `auth_user`@`%`;
+grant select, insert, update, delete on `datadb`.`webhook_delivery` to `auth_user`@`%`;
+
+-- The app service only queues deliveries, the auth service sends them
+grant select on `datadb`.`webhook` to `app_user`@`%`;
+grant insert on `datadb`.`webhook_delivery` to `app_user`@`%`;
@@ -0,0 +1,7 @@
+alter table user add column active boolean not null default true;
+alter table user add column external_id varchar(255) not null default '';
+
+alter table organization add column external_id varchar(255) not null default '';
+
+create index idx_user_external_id on user (external_id);
+create index idx_organization_external_id on organization (external_id);
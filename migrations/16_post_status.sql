@@ -0,0 +1,7 @@
+alter table post add column status varchar(16) not null default 'draft';
+alter table post add column published_at timestamp null default null;
+
+-- Everything written before drafts existed was already public
+update post set status = 'published', published_at = created_at;
+
+create index idx_post_status_published on post (status, published_at);
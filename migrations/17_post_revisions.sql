@@ -0,0 +1,18 @@
+create table if not exists post_revision (
+	id bigint primary key not null auto_increment,
+	post_id varchar(36) not null,
+	title varchar(255) not null,
+	content text not null,
+	author varchar(36) not null,
+	created_at timestamp not null default current_timestamp,
+
+	foreign key (post_id) references post(id) on delete cascade
+);
+
+create index idx_post_revision_post on post_revision (post_id, id);
+
+-- Start every existing post's history with what it looks like today
+insert into post_revision (post_id, title, content, author, created_at)
+select id, title, content, author, updated_at from post;
+
+grant select, insert, delete on `datadb`.`post_revision` to `app_user`@`%`;
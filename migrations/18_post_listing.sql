@@ -0,0 +1,2 @@
+-- Listing pages for one author
+create index idx_post_author on post (author);
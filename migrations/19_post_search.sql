@@ -0,0 +1,5 @@
+-- Searches match on both columns and rank title matches above content ones,
+-- MATCH needs an index with exactly the columns it's given
+create fulltext index ft_post_title_content on post (title, content);
+create fulltext index ft_post_title on post (title);
+create fulltext index ft_post_content on post (content);
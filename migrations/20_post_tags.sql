@@ -0,0 +1,22 @@
+create table if not exists tag (
+	slug varchar(64) primary key not null,
+	name varchar(64) not null,
+
+	-- Only users allowed to apply the tag may add it to or remove it from posts
+	restricted boolean not null default false,
+	created_at timestamp not null default current_timestamp
+);
+
+create table if not exists post_tag (
+	post_id varchar(36) not null,
+	tag_slug varchar(64) not null,
+
+	primary key (post_id, tag_slug),
+	foreign key (post_id) references post(id) on delete cascade,
+	foreign key (tag_slug) references tag(slug) on delete cascade
+);
+
+create index idx_post_tag_tag on post_tag (tag_slug, post_id);
+
+grant select, insert, update, delete on `datadb`.`tag` to `app_user`@`%`;
+grant select, insert, delete on `datadb`.`post_tag` to `app_user`@`%`;
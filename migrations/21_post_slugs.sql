@@ -0,0 +1,16 @@
+-- Existing posts keep their id as the slug until the author picks one
+alter table post add column slug varchar(255) null;
+update post set slug = id;
+alter table post modify column slug varchar(255) not null;
+create unique index idx_post_slug on post (slug);
+
+-- Slugs a post used to have so old links can be redirected
+create table if not exists post_slug_history (
+	slug varchar(255) primary key not null,
+	post_id varchar(36) not null,
+	created_at timestamp not null default current_timestamp,
+
+	foreign key (post_id) references post(id) on delete cascade
+);
+
+grant select, insert, delete on `datadb`.`post_slug_history` to `app_user`@`%`;
@@ -0,0 +1,21 @@
+create table if not exists comment (
+	id varchar(36) primary key not null,
+	post_id varchar(36) not null,
+
+	-- Replies only go one level deep so the parent is always a top level comment
+	parent_id varchar(36) null,
+	author varchar(36) not null,
+	content text not null,
+
+	-- pending until a moderator approves it or marks it as spam
+	status varchar(16) not null default 'pending',
+	created_at timestamp not null default current_timestamp,
+	updated_at timestamp not null default current_timestamp,
+
+	foreign key (post_id) references post(id) on delete cascade,
+	foreign key (parent_id) references comment(id) on delete cascade
+);
+
+create index idx_comment_post on comment (post_id, created_at);
+
+grant select, insert, update, delete on `datadb`.`comment` to `app_user`@`%`;
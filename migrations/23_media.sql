@@ -0,0 +1,35 @@
+-- Media is stored under the sha256 of its content, the bytes themselves are
+-- kept in the blob store rather than the database
+create table if not exists media (
+	id varchar(64) primary key not null,
+	mime_type varchar(128) not null,
+	size bigint not null,
+	width int not null,
+	height int not null,
+
+	-- A smaller copy for lists of posts, it's media of its own
+	thumbnail_id varchar(64) null,
+	created_by varchar(36) not null,
+	created_at timestamp not null default current_timestamp,
+
+	foreign key (thumbnail_id) references media(id)
+);
+
+create table if not exists post_media (
+	post_id varchar(36) not null,
+	media_id varchar(64) not null,
+	created_at timestamp not null default current_timestamp,
+
+	primary key (post_id, media_id),
+	foreign key (post_id) references post(id) on delete cascade,
+	foreign key (media_id) references media(id)
+);
+
+-- The image shown above the post and in lists, one of the post's media.
+-- The old image columns are moved into the blob store by the app server
+-- when it starts and can be dropped once that's happened everywhere.
+alter table post add column image_id varchar(64) null;
+alter table post add foreign key (image_id) references media(id);
+
+grant select, insert on `datadb`.`media` to `app_user`@`%`;
+grant select, insert, delete on `datadb`.`post_media` to `app_user`@`%`;
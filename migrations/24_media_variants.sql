@@ -0,0 +1,13 @@
+-- Smaller copies of an image for srcset, each is media of its own. An image
+-- only has the widths that are narrower than it.
+create table if not exists media_variant (
+	media_id varchar(64) not null,
+	width int not null,
+	variant_id varchar(64) not null,
+
+	primary key (media_id, width),
+	foreign key (media_id) references media(id),
+	foreign key (variant_id) references media(id)
+);
+
+grant select, insert on `datadb`.`media_variant` to `app_user`@`%`;
@@ -0,0 +1,4 @@
+-- Global webhooks receive events from every organization, only admins can
+-- create them. Application webhooks made before this stop receiving events
+-- until an admin creates them again.
+alter table webhook add column global boolean not null default false;